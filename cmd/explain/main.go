@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/explain"
+)
+
+func main() {
+	opts := explain.Options{}
+
+	flag.StringVar(&opts.Manifest, "f", "", "manifest file of the pod or workload to explain")
+	flag.StringVar(&opts.ParentDir, "parent", "", "manifest file or directory of the parent objects")
+	flag.StringVar(
+		&opts.VirtualDir,
+		"virtual",
+		"",
+		"manifest file or directory of the virtual objects",
+	)
+	flag.StringVar(
+		&opts.TargetNamespace,
+		"target-namespace",
+		"",
+		"host namespace of the vcluster, inferred from the parent objects if unset",
+	)
+	flag.StringVar(
+		&opts.VClusterName,
+		"vcluster-name",
+		explain.DefaultVClusterName,
+		"name of the vcluster",
+	)
+
+	flag.Parse()
+
+	if opts.Manifest == "" {
+		fmt.Fprintln(os.Stderr, "a manifest must be provided with -f")
+		flag.Usage()
+		os.Exit(2) //nolint:gomnd
+	}
+
+	result, err := explain.Explain(context.Background(), opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = result.Write(os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/webhook"
+
+	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimeclientconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+)
+
+func main() {
+	var configPath string
+
+	flag.StringVar(&configPath, "config", "", "path of the webhook configuration file")
+
+	flag.Parse()
+
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "a configuration file must be provided with -config")
+		flag.Usage()
+		os.Exit(2) //nolint:gomnd
+	}
+
+	err := run(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(configPath string) error {
+	config, err := webhook.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := ctrlruntimeclientconfig.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	// parent objects are read directly, not cached, only the objects pods reference are fetched
+	client, err := ctrlruntimeclient.New(
+		restConfig,
+		ctrlruntimeclient.Options{Scheme: clientgoscheme.Scheme},
+	)
+	if err != nil {
+		return err
+	}
+
+	log := vclustersdklog.New(webhook.Name)
+
+	wh, err := webhook.New(config, client, client, log)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"serving webhook on '%s', health and metrics on '%s'",
+		config.BindAddress,
+		config.HealthBindAddress,
+	)
+
+	return webhook.Serve(signals.SetupSignalHandler(), config, wh.Handler())
+}
@@ -8,9 +8,21 @@ import (
 func main() {
 	ctx := vclustersdkplugin.MustInit()
 
-	for _, hook := range hooks.GetAllHooks(ctx) {
+	hooks.StartMetricsServer(ctx.Context)
+
+	allHooks, err := hooks.LoadAllHooks(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, hook := range allHooks {
 		vclustersdkplugin.MustRegister(hook)
 	}
 
+	err = hooks.RegisterDriftController(ctx)
+	if err != nil {
+		panic(err)
+	}
+
 	vclustersdkplugin.MustStart()
 }
@@ -0,0 +1,457 @@
+// Package drift detects pods that use outdated parent objects. Pods mutated with
+// mutator.Options.Checksums record the checksum of every substituted parent object, the drift
+// Reconciler watches those parent objects and compares the recorded checksums against the
+// current parent objects. Parent objects used as environment variables (or volumes with sub
+// paths) are only read when a container starts, so drifted pods keep using the data they started
+// with until they are restarted. Drift is reported as events on the virtual pods and in the
+// metrics served by mutator.MetricsHandler, and virtual workloads annotated with
+// RolloutAnnotation are restarted.
+package drift
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// ControllerName is the name of the drift controller, it is the source of its events.
+	ControllerName = "prefer-parent-resources-drift"
+
+	// EventReasonParentDrifted is the reason of the events recorded on virtual pods whose parent
+	// objects changed since the pods were created.
+	EventReasonParentDrifted = "ParentObjectDrifted"
+
+	// parentsIndex is the pod field index of the checksum keys of the parent objects of pods.
+	parentsIndex = "preferParentChecksums"
+)
+
+// Drift is a parent object that changed since it was substituted on a pod.
+type Drift struct {
+	// Kind is the name of the kind of the parent object, for example "configmap".
+	Kind string
+	// Name is the name of the parent object.
+	Name string
+	// Recorded is the checksum recorded on the pod.
+	Recorded mutator.Checksum
+	// Current is the checksum of the current parent object, it is empty if the parent object was
+	// deleted.
+	Current mutator.Checksum
+	// Deleted is true if the parent object no longer exists.
+	Deleted bool
+}
+
+// String returns a human-readable description of the drift.
+func (d Drift) String() string {
+	if d.Deleted {
+		return fmt.Sprintf(
+			"parent %s '%s' was deleted since the pod was created",
+			d.Kind,
+			d.Name,
+		)
+	}
+
+	return fmt.Sprintf(
+		"parent %s '%s' changed since the pod was created (resource version '%s' -> '%s')",
+		d.Kind,
+		d.Name,
+		d.Recorded.ResourceVersion,
+		d.Current.ResourceVersion,
+	)
+}
+
+// Options configure a Reconciler.
+type Options struct {
+	// Client reads the pods and the metadata of the parent objects, generally the cached client
+	// of the manager the Reconciler is set up with.
+	Client ctrlruntimeclient.Reader
+	// ParentReader reads full parent objects, generally a reader that is not cached, so that the
+	// data of parent objects is not kept in memory.
+	ParentReader ctrlruntimeclient.Reader
+	// Namespace is the namespace of the pods and their parent objects, the host namespace of the
+	// vcluster.
+	Namespace string
+	// ChecksumKey is the key the data of parent objects is hashed with, it must be the
+	// mutator.Options.ChecksumKey the checksums of the pods were recorded with.
+	ChecksumKey []byte
+	// Recorder records events on the virtual pods of drifted pods. If nil no events are recorded.
+	Recorder record.EventRecorder
+	// Logger is the logger of the Reconciler, if nil nothing is logged.
+	Logger mutator.Logger
+	// VirtualClient reads virtual pods and the workloads owning them, and restarts workloads
+	// annotated with RolloutAnnotation when the parent objects of their pods drift. If nil no
+	// workloads are restarted.
+	VirtualClient ctrlruntimeclient.Client
+	// RolloutInterval is the minimum interval between two restarts of the same workload.
+	RolloutInterval time.Duration
+	// RolloutLimiter limits the restarts of all workloads, so that a frequently changing parent
+	// object used by many workloads does not restart them all at once. If nil restarts are only
+	// limited by the RolloutInterval.
+	RolloutLimiter *rate.Limiter
+}
+
+// Reconciler reconciles pods that record parent object checksums, reporting the parent objects
+// that changed since the pods were created.
+type Reconciler struct {
+	client       ctrlruntimeclient.Reader
+	parentReader ctrlruntimeclient.Reader
+	namespace    string
+	checksumKey  []byte
+	recorder     record.EventRecorder
+	log          mutator.Logger
+
+	virtualClient   ctrlruntimeclient.Client
+	rolloutInterval time.Duration
+	rolloutLimiter  *rate.Limiter
+
+	lock sync.Mutex
+	// drifted holds the current checksums of the drifted parent objects reported per pod, so that
+	// each change is only reported once.
+	drifted map[types.NamespacedName]map[string]mutator.Checksum
+}
+
+// New returns a Reconciler with the given options.
+func New(opts *Options) *Reconciler {
+	registerMetrics()
+
+	log := opts.Logger
+	if log == nil {
+		log = nopLogger{}
+	}
+
+	return &Reconciler{
+		client:       opts.Client,
+		parentReader: opts.ParentReader,
+		namespace:    opts.Namespace,
+		checksumKey:  opts.ChecksumKey,
+		recorder:     opts.Recorder,
+		log:          log,
+		drifted:      map[types.NamespacedName]map[string]mutator.Checksum{},
+
+		virtualClient:   opts.VirtualClient,
+		rolloutInterval: opts.RolloutInterval,
+		rolloutLimiter:  opts.RolloutLimiter,
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+
+func (nopLogger) Infof(string, ...interface{}) {}
+
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// SetupWithManager indexes the pods of mgr by the parent objects they record checksums of, and
+// registers the Reconciler as controller of mgr. Pods are reconciled when they change and when
+// one of their parent objects changes, parent objects are only watched by their metadata.
+func (r *Reconciler) SetupWithManager(ctx context.Context, mgr ctrlruntime.Manager) error {
+	err := mgr.GetFieldIndexer().IndexField(ctx, &corev1.Pod{}, parentsIndex, indexParents)
+	if err != nil {
+		return err
+	}
+
+	b := ctrlruntime.NewControllerManagedBy(mgr).
+		Named(ControllerName).
+		For(
+			&corev1.Pod{},
+			builder.WithPredicates(predicate.NewPredicateFuncs(r.hasChecksums)),
+		)
+
+	for _, kind := range mutator.RegisteredKinds() {
+		if _, ok := kind.(mutator.ParentHasher); !ok {
+			continue
+		}
+
+		obj := &metav1.PartialObjectMetadata{}
+		obj.SetGroupVersionKind(kind.GroupVersionKind())
+
+		b = b.Watches(
+			&source.Kind{Type: obj},
+			handler.EnqueueRequestsFromMapFunc(r.podsOf(kind)),
+		)
+	}
+
+	return b.Complete(r)
+}
+
+// hasChecksums returns true if obj is in the namespace of the Reconciler and records checksums.
+func (r *Reconciler) hasChecksums(obj ctrlruntimeclient.Object) bool {
+	_, ok := obj.GetAnnotations()[mutator.ChecksumsAnnotation]
+
+	return ok && obj.GetNamespace() == r.namespace
+}
+
+// indexParents returns the checksum keys of the parent objects of the pod obj.
+func indexParents(obj ctrlruntimeclient.Object) []string {
+	checksums, err := mutator.GetChecksums(obj)
+	if err != nil {
+		return nil
+	}
+
+	keys := make([]string, 0, len(checksums))
+
+	for key := range checksums {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// podsOf returns a handler.MapFunc returning the requests of the pods recording checksums of the
+// parent object of the given kind.
+func (r *Reconciler) podsOf(kind mutator.ReferenceableKind) handler.MapFunc {
+	return func(obj ctrlruntimeclient.Object) []reconcile.Request {
+		pods := &corev1.PodList{}
+
+		err := r.client.List(
+			context.Background(),
+			pods,
+			ctrlruntimeclient.InNamespace(r.namespace),
+			ctrlruntimeclient.MatchingFields{
+				parentsIndex: mutator.ChecksumKey(kind.Name(), obj.GetName()),
+			},
+		)
+		if err != nil {
+			r.log.Errorf(
+				"failed listing pods of parent %s '%s', error: '%s'",
+				kind.Name(),
+				obj.GetName(),
+				err,
+			)
+
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0, len(pods.Items))
+
+		for i := range pods.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: ctrlruntimeclient.ObjectKeyFromObject(&pods.Items[i]),
+			})
+		}
+
+		return requests
+	}
+}
+
+// Reconcile checks the parent objects of the pod of the request, reports newly drifted parent
+// objects, and restarts the workload owning the virtual pod if it opted in to rollouts.
+func (r *Reconciler) Reconcile(
+	ctx context.Context,
+	req reconcile.Request,
+) (reconcile.Result, error) {
+	pod := &corev1.Pod{}
+
+	err := r.client.Get(ctx, req.NamespacedName, pod)
+	if apimachineryerrors.IsNotFound(err) {
+		r.forget(req.NamespacedName)
+
+		return reconcile.Result{}, nil
+	}
+
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	drifts, err := r.Check(ctx, pod)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	r.report(pod, drifts)
+
+	if len(drifts) == 0 {
+		return reconcile.Result{}, nil
+	}
+
+	return r.rollout(ctx, pod, drifts)
+}
+
+// Check compares the checksums recorded on the pod against the current parent objects, and
+// returns the parent objects that changed (or were deleted) since, sorted by kind and name.
+// Checksums of unknown kinds are ignored, an error is returned if a parent object cannot be read.
+func (r *Reconciler) Check(ctx context.Context, pod *corev1.Pod) ([]Drift, error) {
+	checksums, err := mutator.GetChecksums(pod)
+	if err != nil {
+		r.log.Errorf(
+			"invalid annotation '%s' on pod '%s/%s', ignoring it, error: '%s'",
+			mutator.ChecksumsAnnotation,
+			pod.Namespace,
+			pod.Name,
+			err,
+		)
+
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(checksums))
+
+	for key := range checksums {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var drifts []Drift
+
+	for _, key := range keys {
+		kindName, name, ok := mutator.ParseChecksumKey(key)
+		if !ok {
+			continue
+		}
+
+		kind, ok := mutator.GetKind(kindName)
+		if !ok {
+			r.log.Debugf("ignoring checksum of parent object of unknown kind '%s'", kindName)
+
+			continue
+		}
+
+		d, err := r.checkParent(ctx, kind, name, checksums[key])
+		if err != nil {
+			return nil, err
+		}
+
+		if d != nil {
+			drifts = append(drifts, *d)
+		}
+	}
+
+	return drifts, nil
+}
+
+// checkParent compares the checksum recorded of the parent object name against the current
+// parent object, and returns the drift, or nil if the data of the parent object did not change.
+// The parent object is only read in full if its resource version changed, its data is then hashed
+// and compared against the recorded hash, so that changes of the metadata only are not drift.
+func (r *Reconciler) checkParent(
+	ctx context.Context,
+	kind mutator.ReferenceableKind,
+	name string,
+	recorded mutator.Checksum,
+) (*Drift, error) {
+	key := types.NamespacedName{Namespace: r.namespace, Name: name}
+	d := &Drift{Kind: kind.Name(), Name: name, Recorded: recorded}
+
+	meta := &metav1.PartialObjectMetadata{}
+	meta.SetGroupVersionKind(kind.GroupVersionKind())
+
+	err := r.client.Get(ctx, key, meta)
+	if apimachineryerrors.IsNotFound(err) {
+		d.Deleted = true
+
+		return d, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.GetResourceVersion() == recorded.ResourceVersion {
+		return nil, nil
+	}
+
+	parent, err := kind.GetParent(ctx, r.parentReader, key)
+	if apimachineryerrors.IsNotFound(err) {
+		d.Deleted = true
+
+		return d, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	current, ok := mutator.NewChecksum(kind, parent, r.checksumKey)
+	if !ok || current.Hash == recorded.Hash {
+		// only the metadata of the parent object changed
+		return nil, nil
+	}
+
+	d.Current = current
+
+	return d, nil
+}
+
+// report records an event and the metrics for each drift of the pod not reported before, and
+// updates the drifted pods metric.
+func (r *Reconciler) report(pod *corev1.Pod, drifts []Drift) {
+	key := ctrlruntimeclient.ObjectKeyFromObject(pod)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	reported := r.drifted[key]
+	current := map[string]mutator.Checksum{}
+
+	for _, d := range drifts {
+		checksumKey := mutator.ChecksumKey(d.Kind, d.Name)
+
+		current[checksumKey] = d.Current
+
+		if previous, ok := reported[checksumKey]; ok && previous == d.Current {
+			continue
+		}
+
+		r.log.Infof("pod '%s/%s' drifted: %s", pod.Namespace, pod.Name, d)
+
+		recordDrift(d.Kind)
+		r.recordVirtualEvent(pod, d)
+	}
+
+	if len(current) == 0 {
+		delete(r.drifted, key)
+	} else {
+		r.drifted[key] = current
+	}
+
+	setDriftedPods(len(r.drifted))
+}
+
+// forget drops the drift reported for the (deleted) pod key.
+func (r *Reconciler) forget(key types.NamespacedName) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.drifted, key)
+
+	setDriftedPods(len(r.drifted))
+}
+
+// recordVirtualEvent records a warning event for the drift d on the virtual pod of the pod.
+func (r *Reconciler) recordVirtualEvent(pod *corev1.Pod, d Drift) {
+	if r.recorder == nil {
+		return
+	}
+
+	r.recorder.Event(
+		&corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       pod.Annotations[mutator.VirtualNameAnnotation],
+			Namespace:  pod.Annotations[mutator.VirtualNamespaceAnnotation],
+		},
+		corev1.EventTypeWarning,
+		EventReasonParentDrifted,
+		d.String()+", restart the pod to use the current parent object",
+	)
+}
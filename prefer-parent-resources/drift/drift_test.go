@@ -0,0 +1,292 @@
+package drift_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/drift"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimeclientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	namespace   = "test"
+	checksumKey = "somechecksumkey"
+)
+
+func newPod(t *testing.T, parent *corev1.ConfigMap) *corev1.Pod {
+	t.Helper()
+
+	checksum, _ := mutator.NewChecksum(mutator.ConfigMapKind{}, parent, []byte(checksumKey))
+
+	b, err := json.Marshal(map[string]mutator.Checksum{
+		mutator.ChecksumKey("configmap", parent.Name): checksum,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "somepod-x-default-x-suffix",
+			Namespace: namespace,
+			Annotations: map[string]string{
+				mutator.VirtualNameAnnotation:      "somepod",
+				mutator.VirtualNamespaceAnnotation: "default",
+				mutator.ChecksumsAnnotation:        string(b),
+			},
+		},
+	}
+}
+
+// changeFunc changes the parent configmap cm after the checksums of the pod were recorded.
+type changeFunc func(ctx context.Context, c ctrlruntimeclient.Client, cm *corev1.ConfigMap) error
+
+func TestReconcile(t *testing.T) {
+	cases := map[string]struct {
+		description    string
+		change         changeFunc
+		expectedDrifts int
+		expectedEvents int
+	}{
+		"unchanged": {
+			description: "validate that unchanged parent objects are not reported",
+		},
+		"data-changed": {
+			description: "validate that parent objects whose data changed are reported once",
+			change: func(
+				ctx context.Context,
+				c ctrlruntimeclient.Client,
+				cm *corev1.ConfigMap,
+			) error {
+				cm.Data["somekey"] = "someotherval"
+
+				return c.Update(ctx, cm)
+			},
+			expectedDrifts: 1,
+			expectedEvents: 1,
+		},
+		"metadata-changed": {
+			description: "validate that parent objects whose metadata only changed are not " +
+				"reported",
+			change: func(
+				ctx context.Context,
+				c ctrlruntimeclient.Client,
+				cm *corev1.ConfigMap,
+			) error {
+				cm.Labels = map[string]string{"somelabel": "someval"}
+
+				return c.Update(ctx, cm)
+			},
+		},
+		"deleted": {
+			description: "validate that deleted parent objects are reported once",
+			change: func(
+				ctx context.Context,
+				c ctrlruntimeclient.Client,
+				cm *corev1.ConfigMap,
+			) error {
+				return c.Delete(ctx, cm)
+			},
+			expectedDrifts: 1,
+			expectedEvents: 1,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			ctx := context.Background()
+
+			scheme := runtime.NewScheme()
+
+			err := clientgoscheme.AddToScheme(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := ctrlruntimeclientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: namespace},
+					Data:       map[string]string{"somekey": "someval"},
+				},
+			).Build()
+
+			cm := &corev1.ConfigMap{}
+
+			err = c.Get(
+				ctx,
+				ctrlruntimeclient.ObjectKey{Namespace: namespace, Name: "someconfigmap"},
+				cm,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pod := newPod(t, cm)
+
+			err = c.Create(ctx, pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if testCase.change != nil {
+				err = testCase.change(ctx, c, cm)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			recorder := record.NewFakeRecorder(10)
+
+			r := drift.New(&drift.Options{
+				Client:       c,
+				ParentReader: c,
+				Namespace:    namespace,
+				ChecksumKey:  []byte(checksumKey),
+				Recorder:     recorder,
+			})
+
+			drifts, err := r.Check(ctx, pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(drifts) != testCase.expectedDrifts {
+				t.Fatalf("expected %d drifts, got %v", testCase.expectedDrifts, drifts)
+			}
+
+			// reconciling twice must not report the same drift twice
+			for i := 0; i < 2; i++ {
+				_, err = r.Reconcile(
+					ctx,
+					reconcile.Request{NamespacedName: ctrlruntimeclient.ObjectKeyFromObject(pod)},
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			events := drainEvents(recorder)
+
+			if len(events) != testCase.expectedEvents {
+				t.Fatalf("expected %d events, got %v", testCase.expectedEvents, events)
+			}
+
+			for _, event := range events {
+				if !strings.HasPrefix(
+					event,
+					corev1.EventTypeWarning+" "+drift.EventReasonParentDrifted,
+				) {
+					t.Fatalf("unexpected event '%s'", event)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	ctx := context.Background()
+
+	scheme := runtime.NewScheme()
+
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := ctrlruntimeclientfake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: namespace},
+			Data:       map[string][]byte{"somekey": []byte("someval")},
+		},
+	).Build()
+
+	secret := &corev1.Secret{}
+
+	err = c.Get(ctx, ctrlruntimeclient.ObjectKey{Namespace: namespace, Name: "somesecret"}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum, ok := mutator.NewChecksum(mutator.SecretKind{}, secret, []byte(checksumKey))
+	if !ok {
+		t.Fatal("expected a checksum of the secret")
+	}
+
+	b, err := json.Marshal(map[string]mutator.Checksum{
+		mutator.ChecksumKey("secret", secret.Name): checksum,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pod := newPod(t, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap"}})
+	pod.Annotations[mutator.ChecksumsAnnotation] = string(b)
+
+	r := drift.New(&drift.Options{
+		Client:       c,
+		ParentReader: c,
+		Namespace:    namespace,
+		ChecksumKey:  []byte(checksumKey),
+		Recorder:     record.NewFakeRecorder(10),
+	})
+
+	check := func(expectedDrifts int) {
+		t.Helper()
+
+		drifts, err := r.Check(ctx, pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(drifts) != expectedDrifts {
+			t.Fatalf("expected %d drifts, got %v", expectedDrifts, drifts)
+		}
+	}
+
+	check(0)
+
+	// changes of the metadata only change the resource version but not the hash of the data
+	secret.Labels = map[string]string{"somelabel": "someval"}
+
+	err = c.Update(ctx, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check(0)
+
+	secret.Data["somekey"] = []byte("someotherval")
+
+	err = c.Update(ctx, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check(1)
+}
+
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
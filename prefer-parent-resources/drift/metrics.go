@@ -0,0 +1,69 @@
+package drift
+
+import (
+	"sync"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "prefer_parent_resources"
+
+	rolloutOutcomeRestarted = "restarted"
+	rolloutOutcomeDeferred  = "deferred"
+)
+
+//nolint:gochecknoglobals
+var (
+	parentDriftsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "parent_drifts_total",
+			Help: "Number of parent objects detected to have changed since they were " +
+				"substituted on a pod, by kind.",
+		},
+		[]string{"kind"},
+	)
+
+	driftedPods = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "drifted_pods",
+			Help:      "Number of pods using parent objects that changed since the pods were created.",
+		},
+	)
+
+	rolloutsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rollouts_total",
+			Help: "Number of restarts of virtual workloads due to drifted parent objects, by " +
+				"workload kind and outcome.",
+		},
+		[]string{"kind", "outcome"},
+	)
+
+	registerMetricsOnce sync.Once
+)
+
+// registerMetrics registers the drift metrics with the registry served by
+// mutator.MetricsHandler, once.
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		mutator.MustRegisterMetrics(parentDriftsTotal, driftedPods, rolloutsTotal)
+	})
+}
+
+func recordDrift(kind string) {
+	parentDriftsTotal.WithLabelValues(kind).Inc()
+}
+
+func setDriftedPods(n int) {
+	driftedPods.Set(float64(n))
+}
+
+func recordRollout(kind, outcome string) {
+	rolloutsTotal.WithLabelValues(kind, outcome).Inc()
+}
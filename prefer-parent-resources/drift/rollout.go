@@ -0,0 +1,250 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// RolloutAnnotation is the annotation virtual deployments, statefulsets and daemonsets opt in
+	// to automatic restarts with, the workload is restarted when a parent object used by one of
+	// its pods drifts if the annotation is set to "true".
+	RolloutAnnotation = "vcluster.loft.sh/prefer-parent-rollout"
+
+	// RestartedAtAnnotation is the pod template annotation patched to restart a workload, it holds
+	// the time of the restart in RFC3339 format.
+	RestartedAtAnnotation = "vcluster.loft.sh/prefer-parent-restarted-at"
+
+	// EventReasonRollout is the reason of the events recorded on restarted virtual workloads.
+	EventReasonRollout = "ParentObjectRollout"
+
+	// DefaultRolloutInterval is the default minimum interval between two restarts of the same
+	// workload.
+	DefaultRolloutInterval = 10 * time.Minute
+)
+
+// rollout restarts the virtual workload owning the virtual pod of the pod whose parent objects
+// drifted, if the workload opted in with the RolloutAnnotation. Restarts are skipped if the
+// workload was restarted since the pod was created, and deferred if the workload was restarted
+// less than the rollout interval ago or the rollout limiter does not allow a restart yet.
+func (r *Reconciler) rollout(
+	ctx context.Context,
+	pod *corev1.Pod,
+	drifts []Drift,
+) (reconcile.Result, error) {
+	if r.virtualClient == nil {
+		return reconcile.Result{}, nil
+	}
+
+	workload, err := r.getWorkload(ctx, pod)
+	if err != nil || workload == nil {
+		return reconcile.Result{}, err
+	}
+
+	if workload.GetAnnotations()[RolloutAnnotation] != "true" {
+		return reconcile.Result{}, nil
+	}
+
+	kind := workload.GetObjectKind().GroupVersionKind().Kind
+	template := podTemplateOf(workload)
+
+	restartedAt, err := time.Parse(time.RFC3339, template.Annotations[RestartedAtAnnotation])
+	if err == nil {
+		if restartedAt.After(pod.CreationTimestamp.Time) {
+			// the pod predates the last restart, it is already being replaced
+			return reconcile.Result{}, nil
+		}
+
+		if wait := r.rolloutInterval - time.Since(restartedAt); wait > 0 {
+			r.log.Debugf(
+				"deferring restart of %s '%s/%s', restarted less than %s ago",
+				kind,
+				workload.GetNamespace(),
+				workload.GetName(),
+				r.rolloutInterval,
+			)
+
+			recordRollout(kind, rolloutOutcomeDeferred)
+
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	if r.rolloutLimiter != nil {
+		reservation := r.rolloutLimiter.Reserve()
+
+		if wait := reservation.Delay(); wait > 0 {
+			reservation.Cancel()
+
+			r.log.Debugf(
+				"deferring restart of %s '%s/%s', rollouts are rate limited",
+				kind,
+				workload.GetNamespace(),
+				workload.GetName(),
+			)
+
+			recordRollout(kind, rolloutOutcomeDeferred)
+
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+	}
+
+	patch := ctrlruntimeclient.MergeFrom(workload.DeepCopyObject().(ctrlruntimeclient.Object))
+
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+
+	template.Annotations[RestartedAtAnnotation] = time.Now().Format(time.RFC3339)
+
+	err = r.virtualClient.Patch(ctx, workload, patch)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	r.log.Infof(
+		"restarted %s '%s/%s', parent objects of pod '%s/%s' drifted",
+		kind,
+		workload.GetNamespace(),
+		workload.GetName(),
+		pod.Namespace,
+		pod.Name,
+	)
+
+	recordRollout(kind, rolloutOutcomeRestarted)
+	r.recordRolloutEvent(workload, kind, drifts)
+
+	return reconcile.Result{}, nil
+}
+
+// getWorkload returns the virtual deployment, statefulset or daemonset controlling the virtual
+// pod of the pod, nil is returned if the virtual pod does not exist or is controlled by something
+// else.
+func (r *Reconciler) getWorkload(
+	ctx context.Context,
+	pod *corev1.Pod,
+) (ctrlruntimeclient.Object, error) {
+	vPod := &corev1.Pod{}
+
+	err := r.virtualClient.Get(
+		ctx,
+		types.NamespacedName{
+			Namespace: pod.Annotations[mutator.VirtualNamespaceAnnotation],
+			Name:      pod.Annotations[mutator.VirtualNameAnnotation],
+		},
+		vPod,
+	)
+	if err != nil {
+		return nil, ctrlruntimeclient.IgnoreNotFound(err)
+	}
+
+	owner := metav1.GetControllerOf(vPod)
+	if owner == nil {
+		return nil, nil
+	}
+
+	if owner.Kind == "ReplicaSet" {
+		rs := &appsv1.ReplicaSet{}
+
+		err = r.virtualClient.Get(
+			ctx,
+			types.NamespacedName{Namespace: vPod.Namespace, Name: owner.Name},
+			rs,
+		)
+		if err != nil {
+			return nil, ctrlruntimeclient.IgnoreNotFound(err)
+		}
+
+		owner = metav1.GetControllerOf(rs)
+		if owner == nil {
+			return nil, nil
+		}
+	}
+
+	var workload ctrlruntimeclient.Object
+
+	switch owner.Kind {
+	case "Deployment":
+		workload = &appsv1.Deployment{}
+	case "StatefulSet":
+		workload = &appsv1.StatefulSet{}
+	case "DaemonSet":
+		workload = &appsv1.DaemonSet{}
+	default:
+		return nil, nil
+	}
+
+	err = r.virtualClient.Get(
+		ctx,
+		types.NamespacedName{Namespace: vPod.Namespace, Name: owner.Name},
+		workload,
+	)
+	if apimachineryerrors.IsNotFound(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// typed objects read through a client do not necessarily have their kind set
+	workload.GetObjectKind().SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind(owner.Kind))
+
+	return workload, nil
+}
+
+// podTemplateOf returns the pod template of the workload returned by getWorkload.
+func podTemplateOf(workload ctrlruntimeclient.Object) *corev1.PodTemplateSpec {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	case *appsv1.DaemonSet:
+		return &w.Spec.Template
+	}
+
+	return nil
+}
+
+// recordRolloutEvent records a normal event for the restart of the virtual workload.
+func (r *Reconciler) recordRolloutEvent(
+	workload ctrlruntimeclient.Object,
+	kind string,
+	drifts []Drift,
+) {
+	if r.recorder == nil {
+		return
+	}
+
+	parents := make([]string, 0, len(drifts))
+
+	for _, d := range drifts {
+		parents = append(parents, fmt.Sprintf("%s '%s'", d.Kind, d.Name))
+	}
+
+	r.recorder.Event(
+		&corev1.ObjectReference{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       kind,
+			Name:       workload.GetName(),
+			Namespace:  workload.GetNamespace(),
+			UID:        workload.GetUID(),
+		},
+		corev1.EventTypeNormal,
+		EventReasonRollout,
+		"restarted to use the current parent "+strings.Join(parents, ", "),
+	)
+}
@@ -0,0 +1,291 @@
+package drift_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/drift"
+
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimeclientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       kind,
+			Name:       name,
+			UID:        "someuid",
+			Controller: boolPtr(true),
+		},
+	}
+}
+
+// newWorkloads returns the virtual pod "somepod" controlled by the given workload kind, the
+// objects in between and the workload, annotated with the given annotations.
+func newWorkloads(
+	kind string,
+	annotations, templateAnnotations map[string]string,
+) []ctrlruntimeclient.Object {
+	meta := metav1.ObjectMeta{
+		Name:        "someworkload",
+		Namespace:   "default",
+		Annotations: annotations,
+	}
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Annotations: templateAnnotations},
+	}
+
+	vPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "somepod",
+			Namespace:       "default",
+			OwnerReferences: controllerRef(kind, "someworkload"),
+		},
+	}
+
+	switch kind {
+	case "StatefulSet":
+		return []ctrlruntimeclient.Object{
+			vPod,
+			&appsv1.StatefulSet{
+				ObjectMeta: meta,
+				Spec:       appsv1.StatefulSetSpec{Template: template},
+			},
+		}
+	case "DaemonSet":
+		return []ctrlruntimeclient.Object{
+			vPod,
+			&appsv1.DaemonSet{
+				ObjectMeta: meta,
+				Spec:       appsv1.DaemonSetSpec{Template: template},
+			},
+		}
+	}
+
+	vPod.OwnerReferences = controllerRef("ReplicaSet", "someworkload-abcde")
+
+	return []ctrlruntimeclient.Object{
+		vPod,
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "someworkload-abcde",
+				Namespace:       "default",
+				OwnerReferences: controllerRef("Deployment", "someworkload"),
+			},
+		},
+		&appsv1.Deployment{
+			ObjectMeta: meta,
+			Spec:       appsv1.DeploymentSpec{Template: template},
+		},
+	}
+}
+
+// getRestartedAt returns the RestartedAtAnnotation of the pod template of the workload kind.
+func getRestartedAt(t *testing.T, c ctrlruntimeclient.Client, kind string) string {
+	t.Helper()
+
+	var (
+		workload ctrlruntimeclient.Object
+		template *corev1.PodTemplateSpec
+	)
+
+	switch kind {
+	case "StatefulSet":
+		sts := &appsv1.StatefulSet{}
+		workload, template = sts, &sts.Spec.Template
+	case "DaemonSet":
+		ds := &appsv1.DaemonSet{}
+		workload, template = ds, &ds.Spec.Template
+	default:
+		deploy := &appsv1.Deployment{}
+		workload, template = deploy, &deploy.Spec.Template
+	}
+
+	err := c.Get(
+		context.Background(),
+		ctrlruntimeclient.ObjectKey{Namespace: "default", Name: "someworkload"},
+		workload,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return template.Annotations[drift.RestartedAtAnnotation]
+}
+
+func TestRollout(t *testing.T) {
+	optedIn := map[string]string{drift.RolloutAnnotation: "true"}
+	created := time.Now().Add(-time.Minute)
+
+	cases := map[string]struct {
+		description         string
+		kind                string
+		annotations         map[string]string
+		templateAnnotations map[string]string
+		limited             bool
+		expectedRestart     bool
+		expectedRequeue     bool
+	}{
+		"deployment": {
+			description:     "validate that opted in deployments are restarted",
+			kind:            "Deployment",
+			annotations:     optedIn,
+			expectedRestart: true,
+		},
+		"statefulset": {
+			description:     "validate that opted in statefulsets are restarted",
+			kind:            "StatefulSet",
+			annotations:     optedIn,
+			expectedRestart: true,
+		},
+		"daemonset": {
+			description:     "validate that opted in daemonsets are restarted",
+			kind:            "DaemonSet",
+			annotations:     optedIn,
+			expectedRestart: true,
+		},
+		"not-opted-in": {
+			description: "validate that workloads without the rollout annotation are not " +
+				"restarted",
+			kind: "Deployment",
+		},
+		"already-restarted": {
+			description: "validate that workloads restarted since the pod was created are not " +
+				"restarted again",
+			kind:        "Deployment",
+			annotations: optedIn,
+			templateAnnotations: map[string]string{
+				drift.RestartedAtAnnotation: created.Add(time.Second * 30).Format(time.RFC3339),
+			},
+		},
+		"interval": {
+			description: "validate that workloads restarted less than the rollout interval ago " +
+				"are deferred",
+			kind:        "Deployment",
+			annotations: optedIn,
+			templateAnnotations: map[string]string{
+				drift.RestartedAtAnnotation: created.Add(-time.Minute).Format(time.RFC3339),
+			},
+			expectedRequeue: true,
+		},
+		"rate-limited": {
+			description:     "validate that restarts exceeding the rollout limiter are deferred",
+			kind:            "Deployment",
+			annotations:     optedIn,
+			limited:         true,
+			expectedRequeue: true,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			ctx := context.Background()
+
+			scheme := runtime.NewScheme()
+
+			err := clientgoscheme.AddToScheme(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "someconfigmap",
+					Namespace:       namespace,
+					ResourceVersion: "1",
+				},
+				Data: map[string]string{"somekey": "someval"},
+			}
+
+			pod := newPod(t, cm)
+			pod.CreationTimestamp = metav1.NewTime(created)
+
+			cm.ResourceVersion = ""
+			cm.Data["somekey"] = "someotherval"
+
+			pClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(cm, pod).
+				Build()
+			vClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(
+					newWorkloads(
+						testCase.kind,
+						testCase.annotations,
+						testCase.templateAnnotations,
+					)...,
+				).
+				Build()
+
+			limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+			if testCase.limited {
+				limiter.Allow()
+			}
+
+			recorder := record.NewFakeRecorder(10)
+
+			r := drift.New(&drift.Options{
+				Client:          pClient,
+				ParentReader:    pClient,
+				Namespace:       namespace,
+				Recorder:        recorder,
+				VirtualClient:   vClient,
+				RolloutInterval: drift.DefaultRolloutInterval,
+				RolloutLimiter:  limiter,
+			})
+
+			res, err := r.Reconcile(
+				ctx,
+				reconcile.Request{NamespacedName: ctrlruntimeclient.ObjectKeyFromObject(pod)},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (res.RequeueAfter > 0) != testCase.expectedRequeue {
+				t.Fatalf("expected requeue %t, got %s", testCase.expectedRequeue, res.RequeueAfter)
+			}
+
+			restartedAt := getRestartedAt(t, vClient, testCase.kind)
+			restarted := restartedAt != testCase.templateAnnotations[drift.RestartedAtAnnotation]
+
+			if restarted != testCase.expectedRestart {
+				t.Fatalf("expected restart %t, got '%s'", testCase.expectedRestart, restartedAt)
+			}
+
+			var rolloutEvents int
+
+			for _, event := range drainEvents(recorder) {
+				if strings.HasPrefix(
+					event,
+					corev1.EventTypeNormal+" "+drift.EventReasonRollout,
+				) {
+					rolloutEvents++
+				}
+			}
+
+			if restarted != (rolloutEvents == 1) {
+				t.Fatalf("expected restart %t, got %d rollout events", restarted, rolloutEvents)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package explain
+
+import "errors"
+
+var (
+	// ErrInvalidManifest is an error returned when a manifest file cannot be decoded.
+	ErrInvalidManifest = errors.New("errInvalidManifest")
+	// ErrNoPod is an error returned when the manifest holds neither a pod nor a workload with a
+	// pod template.
+	ErrNoPod = errors.New("errNoPod")
+	// ErrTargetNamespace is an error returned when the target (host) namespace is not set and
+	// cannot be inferred from the parent objects.
+	ErrTargetNamespace = errors.New("errTargetNamespace")
+)
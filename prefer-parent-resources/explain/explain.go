@@ -0,0 +1,386 @@
+// Package explain simulates the prefer parent hooks offline: it runs the real hooks against fake
+// parent and virtual clusters loaded from manifests, and reports the physical pod the hooks
+// produce along with the decision made for every reference of the pod.
+package explain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdkhook "github.com/loft-sh/vcluster-sdk/hook"
+	vclustersdksyncer "github.com/loft-sh/vcluster-sdk/syncer"
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	corev1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimeclientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultVClusterName is the vcluster name used if Options.VClusterName is not set.
+	DefaultVClusterName = "vcluster"
+
+	defaultNamespace = "default"
+	tableEmptyValue  = "-"
+)
+
+// Options are the inputs of Explain.
+type Options struct {
+	// Manifest is the path of the manifest file holding the pod to explain, or a workload
+	// (deployment, statefulset, daemonset, replicaset, job or cronjob) whose pod template is
+	// explained. The first such object of the file is used.
+	Manifest string
+	// ParentDir is the path of the manifest file or directory of the parent objects, the objects
+	// in the host namespace of the vcluster.
+	ParentDir string
+	// VirtualDir is the path of the manifest file or directory of the virtual objects, the objects
+	// in the vcluster. It is optional.
+	VirtualDir string
+	// TargetNamespace is the host namespace of the vcluster. If empty it is inferred from the
+	// parent objects, which must then all be in the same namespace.
+	TargetNamespace string
+	// VClusterName is the name of the vcluster, the suffix of the names vcluster translates. If
+	// empty DefaultVClusterName is used.
+	VClusterName string
+}
+
+// Result is the outcome of Explain.
+type Result struct {
+	// Pod is the physical pod as mutated by the hooks, nil if a hook rejected the pod.
+	Pod *corev1.Pod
+	// Rejection is the error a hook rejected the pod with, if any.
+	Rejection error
+	// Decisions are the decisions the hooks made for the references of the pod, in order.
+	Decisions []mutator.Decision
+}
+
+// Explain translates the pod of the manifest as vcluster would, and runs the pod hooks returned
+// by hooks.LoadAllHooks on the physical pod, in registration order, against fake clusters holding
+// the parent and virtual objects. The hooks are configured by the environment as in the plugin,
+// names and label keys are translated for the vcluster name.
+func Explain(ctx context.Context, opts Options) (*Result, error) {
+	scheme := runtime.NewScheme()
+
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	vPod, err := loadPod(scheme, opts.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	parentObjs, err := loadOptionalObjects(scheme, opts.ParentDir)
+	if err != nil {
+		return nil, err
+	}
+
+	virtualObjs, err := loadOptionalObjects(scheme, opts.VirtualDir)
+	if err != nil {
+		return nil, err
+	}
+
+	targetNamespace := opts.TargetNamespace
+	if targetNamespace == "" {
+		targetNamespace, err = inferTargetNamespace(parentObjs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	vclusterName := opts.VClusterName
+	if vclusterName == "" {
+		vclusterName = DefaultVClusterName
+	}
+
+	defaultNamespaces(parentObjs, targetNamespace)
+	defaultNamespaces(virtualObjs, vPod.Namespace)
+
+	pClient := ctrlruntimeclientfake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(parentObjs...).
+		Build()
+	vClient := ctrlruntimeclientfake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(virtualObjs...).
+		Build()
+
+	err = vClient.Create(ctx, vPod.DeepCopy())
+	if err != nil && !apimachineryerrors.IsAlreadyExists(err) {
+		return nil, err
+	}
+
+	registerCtx := &vclustersdksyncercontext.RegisterContext{
+		Context: ctx,
+		Options: &vclustersdksyncercontext.VirtualClusterOptions{
+			Name:            vclusterName,
+			TargetNamespace: targetNamespace,
+		},
+		TargetNamespace:  targetNamespace,
+		CurrentNamespace: targetNamespace,
+		VirtualManager:   &offlineManager{client: vClient, scheme: scheme},
+		PhysicalManager:  &offlineManager{client: pClient, scheme: scheme},
+	}
+
+	allHooks, err := hooks.LoadAllHooks(registerCtx, hooks.WithVClusterName(vclusterName))
+	if err != nil {
+		return nil, err
+	}
+
+	return RunHooks(ctx, allHooks, physicalPod(vPod, targetNamespace, vclusterName))
+}
+
+// RunHooks runs the pod hooks of allHooks on the physical pod in sequence, each mutating the pod
+// returned by the previous hook, and records the decisions they make. The last pod is set as the
+// result pod, or if a hook returns an error the error is set as the result rejection. An error is
+// only returned if a hook does not return a pod.
+func RunHooks(
+	ctx context.Context,
+	allHooks []vclustersdksyncer.Base,
+	pod *corev1.Pod,
+) (*Result, error) {
+	r := &Result{}
+
+	ctx = mutator.WithDecisionRecorder(ctx, func(d mutator.Decision) {
+		r.Decisions = append(r.Decisions, d)
+	})
+
+	for _, h := range allHooks {
+		clientHook, ok := h.(vclustersdkhook.ClientHook)
+		if !ok {
+			continue
+		}
+
+		if _, ok = clientHook.Resource().(*corev1.Pod); !ok {
+			continue
+		}
+
+		createHook, ok := h.(vclustersdkhook.MutateCreatePhysical)
+		if !ok {
+			continue
+		}
+
+		mutated, err := createHook.MutateCreatePhysical(ctx, pod)
+		if err != nil {
+			r.Rejection = fmt.Errorf("hook '%s': %w", h.Name(), err)
+
+			return r, nil
+		}
+
+		pod, ok = mutated.(*corev1.Pod)
+		if !ok {
+			return nil, fmt.Errorf("%w: hook '%s'", mutator.ErrWrongResourceType, h.Name())
+		}
+	}
+
+	r.Pod = pod
+
+	return r, nil
+}
+
+// loadPod returns the virtual pod of the first pod or workload in the manifest file at path.
+func loadPod(scheme *runtime.Scheme, path string) (*corev1.Pod, error) {
+	objs, err := loadObjects(scheme, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range objs {
+		pod := podFromObject(obj)
+		if pod == nil {
+			continue
+		}
+
+		if pod.Namespace == "" {
+			pod.Namespace = defaultNamespace
+		}
+
+		return pod, nil
+	}
+
+	return nil, fmt.Errorf("%w: manifest '%s'", ErrNoPod, path)
+}
+
+// loadOptionalObjects returns the objects of the manifests at path, or none if path is empty.
+func loadOptionalObjects(
+	scheme *runtime.Scheme,
+	path string,
+) ([]ctrlruntimeclient.Object, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	return loadObjects(scheme, path)
+}
+
+// inferTargetNamespace returns the namespace of the parent objects, if they are all in the same
+// namespace.
+func inferTargetNamespace(parentObjs []ctrlruntimeclient.Object) (string, error) {
+	namespaces := map[string]bool{}
+
+	for _, obj := range parentObjs {
+		if obj.GetNamespace() != "" {
+			namespaces[obj.GetNamespace()] = true
+		}
+	}
+
+	if len(namespaces) != 1 {
+		found := make([]string, 0, len(namespaces))
+		for namespace := range namespaces {
+			found = append(found, namespace)
+		}
+
+		sort.Strings(found)
+
+		return "", fmt.Errorf(
+			"%w: parent objects are in namespaces %v, set the target namespace",
+			ErrTargetNamespace,
+			found,
+		)
+	}
+
+	for namespace := range namespaces {
+		return namespace, nil
+	}
+
+	return "", nil
+}
+
+// defaultNamespaces sets the namespace of the objects without one to namespace.
+func defaultNamespaces(objs []ctrlruntimeclient.Object, namespace string) {
+	for _, obj := range objs {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+	}
+}
+
+// physicalPod returns the pod the vcluster vclusterName creates in the targetNamespace for the
+// virtual pod vPod: the pod and the objects it references are renamed to their translated names,
+// the keys of its labels are translated, and the pod is annotated with its virtual name and
+// namespace.
+func physicalPod(vPod *corev1.Pod, targetNamespace, vclusterName string) *corev1.Pod {
+	physicalName := hooks.PhysicalNameFor(vclusterName)
+	physicalLabelKey := hooks.PhysicalLabelKeyFor(vclusterName)
+
+	pod := vPod.DeepCopy()
+
+	pod.Name = physicalName(vPod.Name, vPod.Namespace)
+	pod.Namespace = targetNamespace
+	pod.ResourceVersion = ""
+	pod.UID = ""
+
+	if vPod.Labels != nil {
+		pod.Labels = map[string]string{}
+
+		for k, v := range vPod.Labels {
+			pod.Labels[physicalLabelKey(k)] = v
+		}
+	}
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+
+	pod.Annotations[vclustersdksyncertranslator.NameAnnotation] = vPod.Name
+	pod.Annotations[vclustersdksyncertranslator.NamespaceAnnotation] = vPod.Namespace
+
+	for _, kind := range mutator.RegisteredKinds() {
+		refs := kind.FindReferences(&pod.Spec)
+
+		for i := range refs {
+			name := kind.GetName(&pod.Spec, &refs[i])
+			if name == "" {
+				continue
+			}
+
+			kind.SetName(
+				&pod.Spec,
+				&refs[i],
+				physicalName(name, vPod.Namespace),
+			)
+		}
+	}
+
+	return pod
+}
+
+// Write writes the result to w: the physical pod as YAML (or the rejection), followed by a table
+// of the decisions.
+func (r *Result) Write(w io.Writer) error {
+	if r.Rejection != nil {
+		_, err := fmt.Fprintf(w, "# pod rejected: %s\n", r.Rejection)
+		if err != nil {
+			return err
+		}
+	} else {
+		b, err := yaml.Marshal(r.Pod)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:gomnd
+
+	_, err = fmt.Fprintln(tw, "HOOK\tKIND\tLOCATION\tFROM\tPARENT\tOUTCOME\tREASON")
+	if err != nil {
+		return err
+	}
+
+	for _, d := range r.Decisions {
+		_, err = fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.Hook,
+			d.Kind,
+			d.Location,
+			d.From,
+			tableValue(d.Parent),
+			d.Outcome,
+			tableValue(decisionReason(d)),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+// decisionReason returns the reason of the decision d, or, for substituted references whose parent
+// object shadows a virtual object holding different data, how the parent object differs from it.
+func decisionReason(d mutator.Decision) string {
+	if d.Reason != "" || d.Diff == nil {
+		return d.Reason
+	}
+
+	return fmt.Sprintf("shadows the virtual %s, the parent %s", d.Kind, d.Diff)
+}
+
+func tableValue(v string) string {
+	if v == "" {
+		return tableEmptyValue
+	}
+
+	return v
+}
@@ -0,0 +1,158 @@
+package explain_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/explain"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+)
+
+const exampleDir = "../../examples/prefer-parent-configmap-and-secret"
+
+const enforcedParentSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: real-secret
+  namespace: my-vcluster
+  annotations:
+    prefer-parent/enforced: "true"
+    prefer-parent/allowed-namespaces: someothernamespace
+data:
+  somekey: c29tZXZhbA==
+`
+
+// writeManifest writes content to the file name in a temporary directory and returns its path.
+func writeManifest(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestExplain(t *testing.T) {
+	suffix := vclustersdktranslate.Suffix
+
+	cases := map[string]struct {
+		description string
+		opts        explain.Options
+		expected    map[string]string
+		expectedErr error
+		rejected    bool
+	}{
+		"example": {
+			description: "validate the decisions for the configmap and secret example",
+			opts: explain.Options{
+				Manifest:     exampleDir + "/vcluster-manifests/deployment.yaml",
+				ParentDir:    exampleDir + "/parent-manifests",
+				VirtualDir:   exampleDir + "/vcluster-manifests",
+				VClusterName: "my-vcluster",
+			},
+			expected: map[string]string{
+				"container 'debian-envs' env 'config'":         mutator.MutationOutcomeSubstituted,
+				"container 'debian-envs' env 'virtual-config'": mutator.MutationOutcomeNotFound,
+				"volume 'virtual-configmap'":                   mutator.MutationOutcomeNotFound,
+				"volume 'configmap'":                           mutator.MutationOutcomeSubstituted,
+				"container 'debian-envs' env 'secret'":         mutator.MutationOutcomeSubstituted,
+				"container 'debian-envs' env 'virtual-secret'": mutator.MutationOutcomeNotFound,
+				"volume 'virtual-secret'":                      mutator.MutationOutcomeNotFound,
+				"volume 'secret'":                              mutator.MutationOutcomeSubstituted,
+			},
+		},
+		"rejected": {
+			description: "validate that pods rejected by the hooks are reported",
+			opts: explain.Options{
+				Manifest:  exampleDir + "/vcluster-manifests/deployment.yaml",
+				ParentDir: writeManifest(t, "secret.yaml", enforcedParentSecret),
+			},
+			rejected: true,
+		},
+		"no-target-namespace": {
+			description: "validate that the target namespace is required without parent objects",
+			opts: explain.Options{
+				Manifest: exampleDir + "/vcluster-manifests/deployment.yaml",
+			},
+			expectedErr: explain.ErrTargetNamespace,
+		},
+		"no-pod": {
+			description: "validate that manifests without a pod are rejected",
+			opts: explain.Options{
+				Manifest:  exampleDir + "/vcluster-manifests/configmap.yaml",
+				ParentDir: exampleDir + "/parent-manifests",
+			},
+			expectedErr: explain.ErrNoPod,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			result, err := explain.Explain(context.Background(), testCase.opts)
+
+			if vclustersdktranslate.Suffix != suffix {
+				t.Fatalf("expected translate suffix '%s', got '%s'", suffix, vclustersdktranslate.Suffix)
+			}
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("expected error '%v', got '%v'", testCase.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if testCase.rejected {
+				if !errors.Is(result.Rejection, mutator.ErrParentRequired) || result.Pod != nil {
+					t.Fatalf("expected pod rejected, got rejection '%v'", result.Rejection)
+				}
+
+				return
+			}
+
+			if result.Rejection != nil {
+				t.Fatal(result.Rejection)
+			}
+
+			actual := map[string]string{}
+
+			for _, d := range result.Decisions {
+				actual[d.Location] = d.Outcome
+			}
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"actual and expected decisions do not match\n%s",
+					cmp.Diff(actual, testCase.expected),
+				)
+			}
+
+			out := &bytes.Buffer{}
+
+			err = result.Write(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(out.String(), "secretName: real-secret\n") {
+				t.Fatalf("expected substituted secret in output, got:\n%s", out.String())
+			}
+		})
+	}
+}
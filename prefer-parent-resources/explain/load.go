@@ -0,0 +1,215 @@
+package explain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	apimachineryyaml "k8s.io/apimachinery/pkg/util/yaml"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const decodeBufferSize = 4096
+
+// manifestExtensions are the extensions of the files loaded from manifest directories.
+//
+//nolint:gochecknoglobals
+var manifestExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// loadObjects loads the objects of the YAML or JSON (multi document) manifest file at path, or of
+// all manifest files in the directory at path, in file name order. Objects of kinds unknown to
+// scheme are ignored, the hooks being simulated only read kinds of the scheme.
+func loadObjects(scheme *runtime.Scheme, path string) ([]ctrlruntimeclient.Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+
+	if info.IsDir() {
+		files, err = manifestFiles(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var objs []ctrlruntimeclient.Object
+
+	for _, file := range files {
+		b, err := os.ReadFile(file) //nolint:gosec
+		if err != nil {
+			return nil, err
+		}
+
+		fileObjs, err := decodeObjects(scheme, b)
+		if err != nil {
+			return nil, fmt.Errorf("%w: file '%s': %s", ErrInvalidManifest, file, err)
+		}
+
+		objs = append(objs, fileObjs...)
+	}
+
+	return objs, nil
+}
+
+// manifestFiles returns the manifest files of the directory dir, sorted by name.
+func manifestFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+
+	for _, entry := range entries {
+		if entry.IsDir() || !manifestExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			continue
+		}
+
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// decodeObjects decodes the YAML or JSON documents in b to typed objects of scheme. Empty
+// documents and objects of kinds unknown to scheme are skipped, "List" objects are flattened.
+func decodeObjects(scheme *runtime.Scheme, b []byte) ([]ctrlruntimeclient.Object, error) {
+	decoder := apimachineryyaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), decodeBufferSize)
+
+	var objs []ctrlruntimeclient.Object
+
+	for {
+		u := &unstructured.Unstructured{}
+
+		err := decoder.Decode(&u.Object)
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(u.Object) == 0 {
+			continue
+		}
+
+		if u.IsList() {
+			err = u.EachListItem(func(item runtime.Object) error {
+				obj, itemErr := toTyped(scheme, item.(*unstructured.Unstructured))
+				if obj != nil {
+					objs = append(objs, obj)
+				}
+
+				return itemErr
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		obj, err := toTyped(scheme, u)
+		if err != nil {
+			return nil, err
+		}
+
+		if obj != nil {
+			objs = append(objs, obj)
+		}
+	}
+}
+
+// toTyped converts u to the typed object of its kind, or returns nil if scheme does not know
+// the kind.
+func toTyped(
+	scheme *runtime.Scheme,
+	u *unstructured.Unstructured,
+) (ctrlruntimeclient.Object, error) {
+	gvk := u.GroupVersionKind()
+	if gvk.Kind == "" {
+		return nil, fmt.Errorf("%w: object '%s' has no kind", ErrInvalidManifest, u.GetName())
+	}
+
+	if !scheme.Recognizes(gvk) {
+		return nil, nil
+	}
+
+	typed, err := scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, typed)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, ok := typed.(ctrlruntimeclient.Object)
+	if !ok {
+		return nil, nil
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	return obj, nil
+}
+
+// podFromObject returns the virtual pod the object obj (a pod or a workload with a pod template)
+// creates, or nil if obj is neither. Pods created from a template are named after the workload.
+func podFromObject(obj ctrlruntimeclient.Object) *corev1.Pod {
+	var template *corev1.PodTemplateSpec
+
+	switch o := obj.(type) {
+	case *corev1.Pod:
+		pod := o.DeepCopy()
+		pod.TypeMeta = podTypeMeta()
+
+		return pod
+	case *appsv1.Deployment:
+		template = &o.Spec.Template
+	case *appsv1.StatefulSet:
+		template = &o.Spec.Template
+	case *appsv1.DaemonSet:
+		template = &o.Spec.Template
+	case *appsv1.ReplicaSet:
+		template = &o.Spec.Template
+	case *batchv1.Job:
+		template = &o.Spec.Template
+	case *batchv1.CronJob:
+		template = &o.Spec.JobTemplate.Spec.Template
+	default:
+		return nil
+	}
+
+	pod := &corev1.Pod{
+		TypeMeta:   podTypeMeta(),
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+
+	pod.Name = obj.GetName()
+	pod.Namespace = obj.GetNamespace()
+
+	return pod
+}
+
+func podTypeMeta() metav1.TypeMeta {
+	return metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"}
+}
@@ -0,0 +1,33 @@
+package explain
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// offlineManager is the manager of a cluster simulated by a client, it provides the client, the
+// scheme and the readers the hooks are created with. Events are not recorded. Every other method
+// of the manager panics, the hooks are never started.
+type offlineManager struct {
+	ctrlruntime.Manager
+	client ctrlruntimeclient.Client
+	scheme *runtime.Scheme
+}
+
+func (m *offlineManager) GetClient() ctrlruntimeclient.Client {
+	return m.client
+}
+
+func (m *offlineManager) GetAPIReader() ctrlruntimeclient.Reader {
+	return m.client
+}
+
+func (m *offlineManager) GetScheme() *runtime.Scheme {
+	return m.scheme
+}
+
+func (m *offlineManager) GetEventRecorderFor(string) record.EventRecorder {
+	return nil
+}
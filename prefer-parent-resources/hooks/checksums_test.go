@@ -0,0 +1,99 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPreferParentResourcesChecksums(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		checksums   string
+		hookDryRun  string
+		expected    bool
+	}{
+		"checksums": {
+			description: "validate that the checksums of substituted parent objects are recorded",
+			checksums:   "true",
+			expected:    true,
+		},
+		"no-checksums": {
+			description: "validate that no checksums are recorded unless enabled",
+		},
+		"dry-run": {
+			description: "validate that no checksums are recorded for references left unchanged " +
+				"in dry run mode",
+			checksums:  "true",
+			hookDryRun: "true",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv(hooks.ChecksumsEnv, testCase.checksums)
+			t.Setenv(hooks.ChecksumKeyEnv, "somechecksumkey")
+			t.Setenv("PREFER_PARENT_RESOURCES_HOOK_DRY_RUN", testCase.hookDryRun)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap)
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				scheme,
+				newDryRunTestVirtualPod(),
+			)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), newDryRunTestPod(nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual, err := mutator.GetChecksums(res.(*corev1.Pod))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := map[string]mutator.Checksum{}
+
+			if testCase.expected {
+				parent := &corev1.ConfigMap{}
+
+				err = pClient.Get(
+					context.Background(),
+					ctrlruntimeclient.ObjectKeyFromObject(someconfigmap),
+					parent,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				checksum, _ := mutator.NewChecksum(
+					mutator.ConfigMapKind{},
+					parent,
+					[]byte("somechecksumkey"),
+				)
+
+				expected[mutator.ChecksumKey("configmap", "someconfigmap")] = checksum
+			}
+
+			if !cmp.Equal(actual, expected) {
+				t.Fatalf(
+					"actual and expected checksums do not match\n%s",
+					cmp.Diff(actual, expected),
+				)
+			}
+		})
+	}
+}
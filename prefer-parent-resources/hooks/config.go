@@ -0,0 +1,167 @@
+package hooks
+
+import (
+	"crypto/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
+)
+
+const (
+	// ReservedNamesEnv is the environment variable holding (comma separated) names of parent
+	// objects that are never substituted, in addition to the built-in reserved names.
+	ReservedNamesEnv = "PREFER_PARENT_RESERVED_NAMES"
+	// ReservedSecretTypesEnv is the environment variable holding (comma separated) types of
+	// parent secrets that are never substituted, in addition to the built-in reserved types.
+	ReservedSecretTypesEnv = "PREFER_PARENT_RESERVED_SECRET_TYPES"
+	// ChecksumsEnv is the environment variable enabling the recording of the checksums of
+	// substituted parent objects on pods, and the drift controller reporting pods whose parent
+	// objects changed since.
+	ChecksumsEnv = "PREFER_PARENT_CHECKSUMS"
+	// ChecksumKeyEnv is the environment variable holding the key the data of parent objects is
+	// hashed with for ChecksumsEnv, generally set from a secret of the plugin. If unset a key is
+	// generated when the plugin starts, the checksums recorded before a restart then no longer
+	// match, and pods whose parent objects are updated in any way are reported as drifted.
+	ChecksumKeyEnv = "PREFER_PARENT_CHECKSUM_KEY"
+	// DiffShadowedEnv is the environment variable disabling, if set to false, the comparison of
+	// substituted parent objects with the virtual objects they shadow, the keys they differ by are
+	// reported in events, decisions and dry run annotations. The comparison is enabled by default.
+	DiffShadowedEnv = "PREFER_PARENT_DIFF_SHADOWED"
+	// RolloutsEnv is the environment variable enabling the restart of virtual workloads annotated
+	// with drift.RolloutAnnotation when parent objects used by their pods drift, it requires
+	// ChecksumsEnv to be enabled.
+	RolloutsEnv = "PREFER_PARENT_ROLLOUTS"
+	// RolloutIntervalEnv is the environment variable holding the minimum interval between two
+	// restarts of the same virtual workload, drift.DefaultRolloutInterval if unset.
+	RolloutIntervalEnv = "PREFER_PARENT_ROLLOUT_INTERVAL"
+	// RolloutsPerMinuteEnv is the environment variable holding the maximum number of restarts of
+	// virtual workloads per minute, across all workloads, DefaultRolloutsPerMinute if unset.
+	RolloutsPerMinuteEnv = "PREFER_PARENT_ROLLOUTS_PER_MINUTE"
+
+	// DefaultRolloutsPerMinute is the maximum number of restarts of virtual workloads per minute
+	// when RolloutsPerMinuteEnv is not set.
+	DefaultRolloutsPerMinute = 5
+
+	dryRunEnvSetting        = "DRY_RUN"
+	failurePolicyEnvSetting = "FAILURE_POLICY"
+	enabledEnvSetting       = "ENABLED"
+	requireGrantsEnvSetting = "REQUIRE_GRANTS"
+	enforcedEnvSetting      = "ENFORCED"
+	enforcedNamesEnvSetting = "ENFORCED_NAMES"
+	enforcedKindsEnvSetting = "ENFORCED_KINDS"
+)
+
+//nolint:gochecknoglobals
+var (
+	generatedChecksumKey     []byte
+	generatedChecksumKeyOnce sync.Once
+)
+
+// hookEnvKey returns the environment variable key for the given setting of the named hook, for
+// example the "DRY_RUN" setting of the "prefer-parent-configmaps-hook" hook is read from the
+// "PREFER_PARENT_CONFIGMAPS_HOOK_DRY_RUN" environment variable.
+func hookEnvKey(hookName, setting string) string {
+	return strings.ToUpper(strings.ReplaceAll(hookName, "-", "_")) + "_" + setting
+}
+
+// getBoolEnv returns the boolean value of the environment variable key, or fallback if the
+// variable is unset or cannot be parsed as a boolean.
+func getBoolEnv(log vclustersdklog.Logger, key string, fallback bool) bool {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Errorf(
+			"invalid boolean value '%s' for environment variable '%s', using default '%t'",
+			v,
+			key,
+			fallback,
+		)
+
+		return fallback
+	}
+
+	return b
+}
+
+// getDurationEnv returns the duration value of the environment variable key, or fallback if the
+// variable is unset or cannot be parsed as a (positive) duration.
+func getDurationEnv(log vclustersdklog.Logger, key string, fallback time.Duration) time.Duration {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Errorf(
+			"invalid duration value '%s' for environment variable '%s', using default '%s'",
+			v,
+			key,
+			fallback,
+		)
+
+		return fallback
+	}
+
+	return d
+}
+
+// getIntEnv returns the integer value of the environment variable key, or fallback if the
+// variable is unset or cannot be parsed as a (positive) integer.
+func getIntEnv(log vclustersdklog.Logger, key string, fallback int) int {
+	v, ok := os.LookupEnv(key)
+	if !ok || v == "" {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil || i <= 0 {
+		log.Errorf(
+			"invalid integer value '%s' for environment variable '%s', using default '%d'",
+			v,
+			key,
+			fallback,
+		)
+
+		return fallback
+	}
+
+	return i
+}
+
+// getListEnv returns the comma separated values of the environment variable key, surrounding
+// whitespace and empty values are dropped. Nil is returned if the variable is unset or empty.
+func getListEnv(key string) []string {
+	return mutator.SplitList(os.Getenv(key))
+}
+
+// getChecksumKey returns the key of ChecksumKeyEnv, or a random key generated once per process if
+// the variable is unset, so that all hooks and the drift controller share the key.
+func getChecksumKey(log vclustersdklog.Logger) []byte {
+	if v := os.Getenv(ChecksumKeyEnv); v != "" {
+		return []byte(v)
+	}
+
+	generatedChecksumKeyOnce.Do(func() {
+		generatedChecksumKey = make([]byte, 32)
+
+		_, err := rand.Read(generatedChecksumKey)
+		if err != nil {
+			log.Errorf("failed generating checksum key, error: '%s'", err)
+
+			generatedChecksumKey = nil
+		}
+	})
+
+	return generatedChecksumKey
+}
@@ -0,0 +1,111 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDecisionRecorder(t *testing.T) {
+	const (
+		configMapEnv    = "container 'somecontainer' env 'env-from-real-configmap'"
+		configMapVolume = "volume 'somevolume'"
+		secretEnv       = "container 'somecontainer' env 'env-from-real-secret'"
+		secretVolume    = "volume 'somesecretvolume'"
+	)
+
+	cases := map[string]struct {
+		description    string
+		env            map[string]string
+		podAnnotations map[string]string
+		pClientObjs    []runtime.Object
+		expected       map[string]string
+	}{
+		"substituted": {
+			description: "validate that substituted references are recorded",
+			pClientObjs: []runtime.Object{someconfigmap, newEnforcedTestSecret(nil, "somekey")},
+			expected: map[string]string{
+				configMapEnv:    mutator.MutationOutcomeSubstituted,
+				configMapVolume: mutator.MutationOutcomeSubstituted,
+				secretEnv:       mutator.MutationOutcomeSubstituted,
+				secretVolume:    mutator.MutationOutcomeSubstituted,
+			},
+		},
+		"not-substituted": {
+			description:    "validate that the outcomes of references not substituted are recorded",
+			podAnnotations: map[string]string{mutator.SkipPreferConfigMapsHook: "1"},
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(
+					map[string]string{mutator.AllowedNamespacesAnnotation: "someothernamespace"},
+					"somekey",
+				),
+			},
+			expected: map[string]string{
+				configMapEnv:    mutator.DecisionOutcomeSkipped,
+				configMapVolume: mutator.DecisionOutcomeSkipped,
+				secretEnv:       mutator.MutationOutcomeDenied,
+				secretVolume:    mutator.MutationOutcomeDenied,
+			},
+		},
+		"dry-run": {
+			description: "validate that dry run references are recorded",
+			env:         map[string]string{"PREFER_PARENT_RESOURCES_HOOK_DRY_RUN": "true"},
+			pClientObjs: []runtime.Object{someconfigmap},
+			expected: map[string]string{
+				configMapEnv:    mutator.MutationOutcomeDryRun,
+				configMapVolume: mutator.MutationOutcomeDryRun,
+				secretEnv:       mutator.MutationOutcomeNotFound,
+				secretVolume:    mutator.MutationOutcomeNotFound,
+			},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			for k, v := range testCase.env {
+				t.Setenv(k, v)
+			}
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+			h := hooks.NewPreferParentResourcesHook(
+				vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient),
+			)
+
+			pod := newResourcesTestPod()
+
+			for k, v := range testCase.podAnnotations {
+				pod.Annotations[k] = v
+			}
+
+			actual := map[string]string{}
+
+			ctx := mutator.WithDecisionRecorder(context.Background(), func(d mutator.Decision) {
+				actual[d.Location] = d.Outcome
+			})
+
+			_, err := h.MutateCreatePhysical(ctx, pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"actual and expected decisions do not match\n%s",
+					cmp.Diff(actual, testCase.expected),
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPreferParentResourcesDiffShadowed(t *testing.T) {
+	const configMapEnv = "container 'somecontainer' env 'env-from-real-configmap'"
+
+	cases := map[string]struct {
+		description  string
+		diffShadowed string
+		expected     *mutator.ObjectDiff
+	}{
+		"default": {
+			description: "validate that substituted parent objects are compared with the virtual " +
+				"objects they shadow by default",
+			expected: &mutator.ObjectDiff{Added: []string{"somekey"}, Removed: []string{"virtualkey"}},
+		},
+		"disabled": {
+			description:  "validate that nothing is compared if disabled",
+			diffShadowed: "false",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv(hooks.DiffShadowedEnv, testCase.diffShadowed)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap)
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				scheme,
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "test"},
+					Data:       map[string]string{"virtualkey": "someval"},
+				},
+			)
+
+			h := hooks.NewPreferParentResourcesHook(
+				vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient),
+			)
+
+			var actual *mutator.ObjectDiff
+
+			ctx := mutator.WithDecisionRecorder(context.Background(), func(d mutator.Decision) {
+				if d.Location == configMapEnv {
+					actual = d.Diff
+				}
+			})
+
+			_, err := h.MutateCreatePhysical(ctx, newResourcesTestPod())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"actual and expected diffs do not match\n%s",
+					cmp.Diff(actual, testCase.expected),
+				)
+			}
+		})
+	}
+}
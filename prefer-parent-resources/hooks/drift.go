@@ -0,0 +1,49 @@
+package hooks
+
+import (
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/drift"
+
+	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+	"golang.org/x/time/rate"
+)
+
+// RegisterDriftController registers the drift.Reconciler with the physical manager of ctx if
+// ChecksumsEnv is enabled, so that pods whose parent objects changed since they were created are
+// reported on their virtual pods. If RolloutsEnv is enabled as well, virtual workloads that opted
+// in are restarted, limited by RolloutIntervalEnv and RolloutsPerMinuteEnv. This must be called
+// before the managers are started.
+func RegisterDriftController(ctx *vclustersdksyncercontext.RegisterContext) error {
+	log := vclustersdklog.New(drift.ControllerName)
+
+	if !getBoolEnv(log, ChecksumsEnv, false) {
+		return nil
+	}
+
+	log.Infof("registering drift controller %s", drift.ControllerName)
+
+	opts := &drift.Options{
+		Client:       ctx.PhysicalManager.GetClient(),
+		ParentReader: ctx.PhysicalManager.GetAPIReader(),
+		Namespace:    ctx.TargetNamespace,
+		ChecksumKey:  getChecksumKey(log),
+		Recorder:     ctx.VirtualManager.GetEventRecorderFor(drift.ControllerName),
+		Logger:       log,
+	}
+
+	if getBoolEnv(log, RolloutsEnv, false) {
+		perMinute := getIntEnv(log, RolloutsPerMinuteEnv, DefaultRolloutsPerMinute)
+
+		opts.VirtualClient = ctx.VirtualManager.GetClient()
+		opts.RolloutInterval = getDurationEnv(
+			log,
+			RolloutIntervalEnv,
+			drift.DefaultRolloutInterval,
+		)
+		opts.RolloutLimiter = rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), perMinute)
+	}
+
+	return drift.New(opts).SetupWithManager(ctx.Context, ctx.PhysicalManager)
+}
@@ -0,0 +1,196 @@
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newDryRunTestPod(annotations map[string]string) *corev1.Pod {
+	podAnnotations := map[string]string{
+		vclustersdksyncertranslator.NameAnnotation:      "somepod",
+		vclustersdksyncertranslator.NamespaceAnnotation: "test",
+	}
+
+	for k, v := range annotations {
+		podAnnotations[k] = v
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "somepod",
+			Namespace:   "test",
+			Annotations: podAnnotations,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "somecontainer",
+					Image: "someimage:latest",
+					Env: []corev1.EnvVar{
+						{
+							Name: "env-from-real-configmap",
+							ValueFrom: &corev1.EnvVarSource{
+								ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: "someconfigmap-x-test-x-suffix",
+									},
+									Key:      "somekey",
+									Optional: falsePtr(),
+								},
+							},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{{
+				Name: "somevolume",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "someconfigmap-x-test-x-suffix",
+						},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestPreferParentConfigmapsDryRun(t *testing.T) {
+	const dryRunAnnotation = mutator.DryRunAnnotationPrefix + "prefer-parent-configmaps-hook"
+
+	substitutions := []mutator.Substitution{
+		{
+			Kind:      "configmap",
+			Container: "somecontainer",
+			Env:       "env-from-real-configmap",
+			From:      "someconfigmap-x-test-x-suffix",
+			To:        "someconfigmap",
+		},
+		{
+			Kind:   "configmap",
+			Volume: "somevolume",
+			From:   "someconfigmap-x-test-x-suffix",
+			To:     "someconfigmap",
+		},
+	}
+
+	cases := map[string]struct {
+		description           string
+		hookDryRun            string
+		podAnnotations        map[string]string
+		expectedName          string
+		expectedSubstitutions []mutator.Substitution
+	}{
+		"hook-dry-run": {
+			description:           "validate that a hook in dry run mode leaves references unchanged",
+			hookDryRun:            "true",
+			expectedName:          "someconfigmap-x-test-x-suffix",
+			expectedSubstitutions: substitutions,
+		},
+		"pod-dry-run": {
+			description: "validate that the pod dry run annotation enables dry run mode",
+			podAnnotations: map[string]string{
+				mutator.DryRunPreferConfigMapsHook: "true",
+			},
+			expectedName:          "someconfigmap-x-test-x-suffix",
+			expectedSubstitutions: substitutions,
+		},
+		"pod-overrides-hook-dry-run": {
+			description: "validate that the pod dry run annotation overrides the hook setting",
+			hookDryRun:  "true",
+			podAnnotations: map[string]string{
+				mutator.DryRunPreferConfigMapsHook: "false",
+			},
+			expectedName: "someconfigmap",
+		},
+		"no-dry-run": {
+			description:  "validate that references are substituted outside of dry run mode",
+			expectedName: "someconfigmap",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv("PREFER_PARENT_CONFIGMAPS_HOOK_DRY_RUN", testCase.hookDryRun)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap)
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				scheme,
+				newDryRunTestVirtualPod(),
+			)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentConfigmapsHook(ctx)
+
+			res, err := h.MutateCreatePhysical(
+				context.Background(),
+				newDryRunTestPod(testCase.podAnnotations),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resPod := res.(*corev1.Pod)
+
+			envName := resPod.Spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name
+			volName := resPod.Spec.Volumes[0].ConfigMap.Name
+
+			if envName != testCase.expectedName || volName != testCase.expectedName {
+				t.Fatalf(
+					"got env '%s' volume '%s', want '%s'",
+					envName,
+					volName,
+					testCase.expectedName,
+				)
+			}
+
+			recorded, ok := resPod.Annotations[dryRunAnnotation]
+			if testCase.expectedSubstitutions == nil {
+				if ok {
+					t.Fatalf("unexpected dry run annotation '%s'", recorded)
+				}
+
+				return
+			}
+
+			var actual []mutator.Substitution
+
+			err = json.Unmarshal([]byte(recorded), &actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(actual, testCase.expectedSubstitutions) {
+				t.Fatalf(
+					"actual and expected substitutions do not match\n%s",
+					cmp.Diff(actual, testCase.expectedSubstitutions),
+				)
+			}
+		})
+	}
+}
+
+func newDryRunTestVirtualPod() *corev1.Pod {
+	vPod := newDryRunTestPod(nil)
+
+	vPod.Annotations = nil
+	vPod.Spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name = "someconfigmap"
+	vPod.Spec.Volumes[0].ConfigMap.Name = "someconfigmap"
+
+	return vPod
+}
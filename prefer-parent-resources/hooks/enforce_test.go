@@ -0,0 +1,249 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newEnforcedTestSecret returns the parent secret "somesecret" with the given annotations and
+// data keys.
+func newEnforcedTestSecret(annotations map[string]string, keys ...string) *corev1.Secret {
+	secret := somesecret.DeepCopy()
+	secret.Annotations = annotations
+	secret.Data = map[string][]byte{}
+
+	for _, key := range keys {
+		secret.Data[key] = []byte("someval")
+	}
+
+	return secret
+}
+
+func TestEnforcedParents(t *testing.T) {
+	enforced := map[string]string{mutator.EnforcedAnnotation: "true"}
+	skip := map[string]string{mutator.SkipPreferSecretsHook: "1"}
+
+	cases := map[string]struct {
+		description    string
+		env            map[string]string
+		podAnnotations map[string]string
+		pClientObjs    []runtime.Object
+		expected       []string
+		expectedErr    bool
+	}{
+		"skipped": {
+			description:    "validate that skipped references to parents that are not enforced are kept",
+			podAnnotations: skip,
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(nil, "somekey"),
+			},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"enforced-parent-skipped": {
+			description: "validate that skipped references are not looked up, so enforced " +
+				"parents do not override the skip annotation",
+			podAnnotations: skip,
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(enforced, "somekey"),
+			},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"enforced-parent-denied": {
+			description: "validate that pods are rejected if an enforced parent cannot be used",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(
+					map[string]string{
+						mutator.EnforcedAnnotation:          "true",
+						mutator.AllowedNamespacesAnnotation: "someothernamespace",
+					},
+					"somekey",
+				),
+			},
+			expectedErr: true,
+		},
+		"enforced-hook-skipped": {
+			description:    "validate that the skip annotation is ignored by enforced hooks",
+			env:            map[string]string{"PREFER_PARENT_RESOURCES_HOOK_ENFORCED": "true"},
+			podAnnotations: skip,
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(nil, "somekey"),
+			},
+			expected: []string{"someconfigmap", "someconfigmap", "somesecret", "somesecret"},
+		},
+		"enforced-hook-names-skipped": {
+			description: "validate that the skip annotation is ignored for the parents an " +
+				"enforced hook is scoped to",
+			env: map[string]string{
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED":       "true",
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED_NAMES": "somesecret",
+			},
+			podAnnotations: skip,
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(nil, "somekey"),
+			},
+			expected: []string{"someconfigmap", "someconfigmap", "somesecret", "somesecret"},
+		},
+		"enforced-hook-names-other-name": {
+			description: "validate that hooks enforced for some names do not reject pods whose " +
+				"other parents do not exist",
+			env: map[string]string{
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED":       "true",
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED_NAMES": "someconfigmap",
+			},
+			pClientObjs: []runtime.Object{someconfigmap},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"enforced-hook-kinds-not-found": {
+			description: "validate that hooks enforced for some kinds reject pods whose parents " +
+				"of those kinds do not exist",
+			env: map[string]string{
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED":       "true",
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED_KINDS": "secret",
+			},
+			pClientObjs: []runtime.Object{someconfigmap},
+			expectedErr: true,
+		},
+		"enforced-hook-kinds-other-kind": {
+			description: "validate that hooks enforced for some kinds do not reject pods whose " +
+				"parents of other kinds do not exist",
+			env: map[string]string{
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED":       "true",
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED_KINDS": "configmap",
+			},
+			pClientObjs: []runtime.Object{someconfigmap},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"enforced-hook-not-found": {
+			description: "validate that enforced hooks reject pods whose parents do not exist",
+			env:         map[string]string{"PREFER_PARENT_RESOURCES_HOOK_ENFORCED": "true"},
+			pClientObjs: []runtime.Object{someconfigmap},
+			expectedErr: true,
+		},
+		"enforced-hook-reserved-name": {
+			description: "validate that enforced hooks do not reject pods using reserved names",
+			env: map[string]string{
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED": "true",
+				hooks.ReservedNamesEnv:                  "somesecret",
+			},
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newEnforcedTestSecret(nil, "somekey"),
+			},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"enforced-hook-reserved-type": {
+			description: "validate that enforced hooks do not reject pods using reserved types",
+			env:         map[string]string{"PREFER_PARENT_RESOURCES_HOOK_ENFORCED": "true"},
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newReservedTestSecret("somesecret", corev1.SecretTypeServiceAccountToken),
+			},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"enforced-hook-dry-run": {
+			description: "validate that enforced hooks do not reject pods in dry run mode",
+			env: map[string]string{
+				"PREFER_PARENT_RESOURCES_HOOK_ENFORCED": "true",
+				"PREFER_PARENT_RESOURCES_HOOK_DRY_RUN":  "true",
+			},
+			pClientObjs: []runtime.Object{someconfigmap},
+			expected: []string{
+				"someconfigmap-x-test-x-suffix",
+				"someconfigmap-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			for k, v := range testCase.env {
+				t.Setenv(k, v)
+			}
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			pod := newResourcesTestPod()
+
+			for k, v := range testCase.podAnnotations {
+				pod.Annotations[k] = v
+			}
+
+			res, err := h.MutateCreatePhysical(context.Background(), pod)
+
+			if testCase.expectedErr {
+				if !errors.Is(err, mutator.ErrParentRequired) {
+					t.Fatalf("expected ErrParentRequired, got '%v'", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := resourcesTestNames(res.(*corev1.Pod))
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"actual and expected names do not match\n%s",
+					cmp.Diff(actual, testCase.expected),
+				)
+			}
+		})
+	}
+}
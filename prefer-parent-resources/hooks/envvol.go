@@ -2,68 +2,21 @@ package hooks
 
 import (
 	"context"
-	"fmt"
+	"os"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
 
 	vclustersdkhook "github.com/loft-sh/vcluster-sdk/hook"
 	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
 	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
 	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
 	corev1 "k8s.io/api/core/v1"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-type envMutatorFunc func(
-	ctx context.Context,
-	log vclustersdklog.Logger,
-	physicalClient ctrlruntimeclient.Client,
-	physicalNamespace string,
-	atPos []EnvAtPos,
-	pod, vPod *corev1.Pod,
-) *corev1.Pod
-
-type volMutatorFunc func(
-	ctx context.Context,
-	log vclustersdklog.Logger,
-	physicalClient ctrlruntimeclient.Client,
-	physicalNamespace string,
-	atPos []VolAtPos, pod, vPod *corev1.Pod,
-) *corev1.Pod
-
-func newEnvVolMutatingHook(
-	ctx *vclustersdksyncercontext.RegisterContext,
-	name, ignoreAnnotation string,
-	mutateType ctrlruntimeclient.Object,
-	envMutator envMutatorFunc,
-	volMutator volMutatorFunc,
-) EnvVolMutatingHook {
-	log := vclustersdklog.New(name)
-
-	log.Infof("creating new hook %s", name)
-
-	h := &envVolMutatingHook{
-		ctx:               ctx,
-		log:               log,
-		name:              name,
-		ignoreAnnotation:  ignoreAnnotation,
-		mutateType:        mutateType,
-		physicalNamespace: ctx.TargetNamespace,
-		physicalClient:    ctx.PhysicalManager.GetClient(),
-		virtualClient:     ctx.VirtualManager.GetClient(),
-		envMutator:        envMutator,
-		volMutator:        volMutator,
-	}
-
-	h.translator = vclustersdksyncertranslator.NewNamespacedTranslator(
-		ctx,
-		h.mutateTypeName(),
-		mutateType,
-	)
-
-	return h
-}
-
 // EnvVolMutatingHook is an interface representing a mutating hook that operates against corev1.Pod
-// objects. The concrete type should either modify configmaps or secrets mounted as volumes or as
+// objects. The concrete type modifies configmaps and/or secrets mounted as volumes or as
 // environment variables. This interface should probably not be implemented by any types outside
 // this package and only exists for consolidating the configmap and secret mutators to avoid
 // duplication.
@@ -73,136 +26,149 @@ type EnvVolMutatingHook interface {
 	vclustersdkhook.MutateUpdatePhysical
 }
 
-type envVolMutatingHook struct {
-	ctx               *vclustersdksyncercontext.RegisterContext
-	log               vclustersdklog.Logger
-	name              string
-	ignoreAnnotation  string
-	mutateType        ctrlruntimeclient.Object
-	translator        vclustersdksyncertranslator.NamespacedTranslator
-	physicalNamespace string
-	physicalClient    ctrlruntimeclient.Client
-	virtualClient     ctrlruntimeclient.Client
-	envMutator        envMutatorFunc
-	volMutator        volMutatorFunc
-}
+func newEnvVolMutatingHook(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	name string,
+	options []Option,
+	kinds ...mutator.ReferenceableKind,
+) EnvVolMutatingHook {
+	opts := newOptions(ctx, name, options...)
 
-// Name returns the name of the ClientHook.
-func (h *envVolMutatingHook) Name() string {
-	return h.name
+	return newMutatorHook(opts, mutator.NewPodMutator(opts, kinds...))
 }
 
-// Resource returns the type of resource the ClientHook mutates.
-func (h *envVolMutatingHook) Resource() ctrlruntimeclient.Object {
-	return &corev1.Pod{}
-}
+// newOptions returns the mutator.Options of the named hook, the parent and virtual readers are
+// those of the register context ctx and the settings are read from the environment variables of
+// the hook, then modified by options.
+func newOptions(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	name string,
+	options ...Option,
+) *mutator.Options {
+	log := vclustersdklog.New(name)
 
-// mutateTypeName returns a string representation of the envVolMutatingHook objects mutateType, that
-// is, the type of resource (on a pod) that we are looking to mutate.
-func (h *envVolMutatingHook) mutateTypeName() string {
-	switch h.mutateType.(type) {
-	case *corev1.ConfigMap:
-		h.log.Debugf("creating ConfigMap translator")
-
-		return configMap
-	case *corev1.Secret:
-		h.log.Debugf("creating Secret translator")
-
-		return secret
-	default:
-		h.log.Errorf(
-			"unknown/invalid mutate type %s, cannot create translator, panicking...", h.mutateType,
-		)
+	log.Infof("creating new hook %s", name)
 
-		panic("unknown mutate type")
+	opts := &mutator.Options{
+		Name:                 name,
+		Logger:               log,
+		ParentNamespace:      ctx.TargetNamespace,
+		ParentMetadataReader: ctx.PhysicalManager.GetClient(),
+		ParentReader:         ctx.PhysicalManager.GetAPIReader(),
+		VirtualReader:        ctx.VirtualManager.GetClient(),
+		VirtualAPIReader:     ctx.VirtualManager.GetAPIReader(),
+		PhysicalName:         vclustersdktranslate.PhysicalName,
+		PhysicalLabelKey:     vclustersdksyncertranslator.ConvertLabelKey,
+		Recorder:             ctx.VirtualManager.GetEventRecorderFor(name),
+		Scheme:               ctx.VirtualManager.GetScheme(),
+		KindEnabled: func(kind mutator.ReferenceableKind) bool {
+			return getBoolEnv(log, hookEnvKey(kind.HookName(), enabledEnvSetting), true)
+		},
+		DryRun:              getBoolEnv(log, hookEnvKey(name, dryRunEnvSetting), false),
+		FailurePolicy:       getFailurePolicy(log, name),
+		RequireGrants:       getBoolEnv(log, hookEnvKey(name, requireGrantsEnvSetting), false),
+		Enforced:            getBoolEnv(log, hookEnvKey(name, enforcedEnvSetting), false),
+		EnforcedNames:       getListEnv(hookEnvKey(name, enforcedNamesEnvSetting)),
+		EnforcedKinds:       getListEnv(hookEnvKey(name, enforcedKindsEnvSetting)),
+		ReservedNames:       getListEnv(ReservedNamesEnv),
+		ReservedSecretTypes: getSecretTypesEnv(ReservedSecretTypesEnv),
+		Checksums:           getBoolEnv(log, ChecksumsEnv, false),
+		ChecksumKey:         getChecksumKey(log),
+		DiffShadowed:        getBoolEnv(log, DiffShadowedEnv, true),
 	}
-}
-
-// MutateCreatePhysical mutates incoming physical cluster create operations to determine if the pod
-// being created refers to a secret or configmap that exists in the physical cluster, if "yes", we
-// replace the secret or configmap reference of the vcluster created secret with the "real" object.
-func (h *envVolMutatingHook) MutateCreatePhysical(
-	ctx context.Context,
-	obj ctrlruntimeclient.Object,
-) (ctrlruntimeclient.Object, error) {
-	h.log.Debugf("mutate create physical requested")
 
-	pod, ok := obj.(*corev1.Pod)
-	if !ok {
-		h.log.Errorf("mutate create physical object is not a pod")
-
-		return nil, fmt.Errorf("%w: object %v is not a pod", ErrWrongResourceType, obj)
+	for _, option := range options {
+		option(opts)
 	}
 
-	h.log.Infof("mutate create physical pod %s/%s", pod.Namespace, pod.Name)
+	return opts
+}
+
+// getFailurePolicy returns the failure policy configured for the named hook.
+func getFailurePolicy(log vclustersdklog.Logger, name string) mutator.FailurePolicy {
+	key := hookEnvKey(name, failurePolicyEnvSetting)
 
-	skip, skipOk := pod.Annotations[h.ignoreAnnotation]
-	if skipOk && len(skip) > 0 {
-		h.log.Infof(
-			"mutate create physical pod %s/%s skipping, ignore annotation set",
-			pod.Namespace,
-			pod.Name,
+	policy, err := mutator.ParseFailurePolicy(os.Getenv(key))
+	if err != nil {
+		log.Errorf(
+			"invalid failure policy for environment variable '%s', error: '%s', using '%s'",
+			key,
+			err,
+			mutator.FailurePolicyFailOpen,
 		)
 
-		return pod, nil
+		return mutator.FailurePolicyFailOpen
 	}
 
-	envs := FindMountedEnvsOfType(&pod.Spec, h.mutateTypeName())
-	vols := FindMountedVolumesOfType(&pod.Spec, h.mutateTypeName())
+	return policy
+}
 
-	if len(envs) == 0 && len(vols) == 0 {
-		// nothing to do, we're outta here!
-		h.log.Infof(
-			"mutate create physical pod %s/%s skipping, no envvars or volumes mounted",
-			pod.Namespace,
-			pod.Name,
-		)
+// getSecretTypesEnv returns the comma separated secret types of the environment variable key.
+func getSecretTypesEnv(key string) []corev1.SecretType {
+	var secretTypes []corev1.SecretType
 
-		return pod, nil
+	for _, secretType := range getListEnv(key) {
+		secretTypes = append(secretTypes, corev1.SecretType(secretType))
 	}
 
-	MutateAnnotations(pod, h.name)
-
-	vPod, err := GetVirtualPod(ctx, pod, h.virtualClient)
-	if err != nil {
-		h.log.Errorf("mutate create physical failed fetching virtual pod")
+	return secretTypes
+}
 
-		return nil, err
+// newMutatorHook returns a hook.ClientHook that mutates physical objects with the mutator m.
+func newMutatorHook(opts *mutator.Options, m mutator.Mutator) *mutatorHook {
+	return &mutatorHook{
+		log:     opts.Logger,
+		mutator: m,
 	}
+}
 
-	if len(envs) > 0 {
-		h.log.Debugf("mutate create physical mutating envs")
+// mutatorHook adapts a mutator.Mutator to the vcluster SDK hook interfaces.
+type mutatorHook struct {
+	log     mutator.Logger
+	mutator mutator.Mutator
+}
 
-		pod = h.envMutator(ctx, h.log, h.physicalClient, h.physicalNamespace, envs, pod, vPod)
-	}
+// Name returns the name of the ClientHook.
+func (h *mutatorHook) Name() string {
+	return h.mutator.Name()
+}
+
+// Resource returns the type of resource the ClientHook mutates.
+func (h *mutatorHook) Resource() ctrlruntimeclient.Object {
+	return h.mutator.Resource()
+}
 
-	if len(vols) > 0 {
-		h.log.Debugf("mutate create physical mutating vols")
+// MutateCreatePhysical mutates incoming physical cluster create operations to determine if the
+// object (generally a pod) being created refers to a secret or configmap (or other kind) that
+// exists in the physical cluster, if "yes", we replace the reference to the vcluster created
+// object with the "real" object. The object is only mutated once every reference has been
+// resolved, if resolving any reference rejects the object the error is returned.
+func (h *mutatorHook) MutateCreatePhysical(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (ctrlruntimeclient.Object, error) {
+	h.log.Debugf("mutate create physical requested")
 
-		pod = h.volMutator(ctx, h.log, h.physicalClient, h.physicalNamespace, vols, pod, vPod)
+	result, err := h.mutator.Mutate(ctx, obj)
+	if err != nil {
+		return nil, err
 	}
 
-	return pod, nil
+	return result.Object, nil
 }
 
 // MutateUpdatePhysical mutates incoming physical cluster update operations to make sure we are
 // enforcing the plugin annotations on the physical resources.
-func (h *envVolMutatingHook) MutateUpdatePhysical(
+func (h *mutatorHook) MutateUpdatePhysical(
 	ctx context.Context,
 	obj ctrlruntimeclient.Object,
 ) (ctrlruntimeclient.Object, error) {
 	h.log.Debugf("mutate update physical requested")
 
-	_ = ctx
-
-	pod, ok := obj.(*corev1.Pod)
-	if !ok {
-		h.log.Errorf("mutate create physical object is not a pod")
-
-		return nil, fmt.Errorf("%w: object %v is not a pod", ErrWrongResourceType, obj)
+	result, err := h.mutator.MutateUpdate(ctx, obj)
+	if err != nil {
+		return nil, err
 	}
 
-	MutateAnnotations(pod, h.name)
-
-	return pod, nil
+	return result.Object, nil
 }
@@ -7,8 +7,10 @@ import (
 	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
 
 	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
 	"github.com/google/go-cmp/cmp"
 	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -118,3 +120,37 @@ func TestPreferParentConfigmapsMutateUpdatePhysical(t *testing.T) {
 		t.Run(testName, f)
 	}
 }
+
+func TestVirtualAnnotations(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		actual      string
+		expected    string
+	}{
+		"name": {
+			description: "validate the mutator virtual name annotation matches the vcluster sdk",
+			actual:      mutator.VirtualNameAnnotation,
+			expected:    vclustersdksyncertranslator.NameAnnotation,
+		},
+		"namespace": {
+			description: "validate the mutator virtual namespace annotation matches the vcluster sdk",
+			actual:      mutator.VirtualNamespaceAnnotation,
+			expected:    vclustersdksyncertranslator.NamespaceAnnotation,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			if testCase.actual != testCase.expected {
+				t.Fatalf(
+					"%s: actual and expected annotations do not match\nactual: %s\nexpected:%s",
+					testName,
+					testCase.actual,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
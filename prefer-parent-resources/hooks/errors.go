@@ -1,12 +1,19 @@
 package hooks
 
-import "errors"
+import (
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+)
 
+//nolint:gochecknoglobals
 var (
 	// ErrWrongResourceType is an error that is returned when the mutate hook encounters an
 	// unexpected/undesired type -- generally this should not be encountered.
-	ErrWrongResourceType = errors.New("errWrongResourceType")
+	//
+	// Deprecated: use mutator.ErrWrongResourceType.
+	ErrWrongResourceType = mutator.ErrWrongResourceType
 	// ErrCantGetResource is an error returned when unable to find a given resource in either the
 	// parent/physical cluster or the vcluster.
-	ErrCantGetResource = errors.New("errCantGetResource")
+	//
+	// Deprecated: use mutator.ErrCantGetResource.
+	ErrCantGetResource = mutator.ErrCantGetResource
 )
@@ -0,0 +1,162 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseFailurePolicy(t *testing.T) {
+	cases := map[string]struct {
+		in        string
+		expected  mutator.FailurePolicy
+		expectErr bool
+	}{
+		"empty":       {in: "", expected: mutator.FailurePolicyFailOpen},
+		"fail-open":   {in: "fail-open", expected: mutator.FailurePolicyFailOpen},
+		"fail-closed": {in: "fail-closed", expected: mutator.FailurePolicyFailClosed},
+		"retry":       {in: "retry", expected: mutator.FailurePolicyRetry},
+		"invalid":     {in: "sometimes", expectErr: true},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			actual, err := mutator.ParseFailurePolicy(testCase.in)
+			if testCase.expectErr {
+				if !errors.Is(err, mutator.ErrInvalidFailurePolicy) {
+					t.Fatalf("got error '%v', want '%v'", err, mutator.ErrInvalidFailurePolicy)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestPreferParentConfigmapsFailurePolicy(t *testing.T) {
+	cases := map[string]struct {
+		description     string
+		failurePolicy   string
+		pClientErr      bool
+		vClientObjs     []runtime.Object
+		mutateObj       *corev1.Pod
+		expectedCluster string
+		expected        string
+	}{
+		"parent-fail-open": {
+			description:   "validate that parent lookup errors fall back to the virtual object",
+			failurePolicy: "fail-open",
+			pClientErr:    true,
+			vClientObjs:   []runtime.Object{somepodWithConfigmapVolume},
+			expected:      "someconfigmap-x-test-x-suffix",
+		},
+		"parent-fail-closed": {
+			description:     "validate that parent lookup errors reject the pod",
+			failurePolicy:   "fail-closed",
+			pClientErr:      true,
+			vClientObjs:     []runtime.Object{somepodWithConfigmapVolume},
+			expectedCluster: mutator.LookupClusterParent,
+		},
+		"parent-retry": {
+			description:     "validate that parent lookup errors reject the pod after retrying",
+			failurePolicy:   "retry",
+			pClientErr:      true,
+			vClientObjs:     []runtime.Object{somepodWithConfigmapVolume},
+			expectedCluster: mutator.LookupClusterParent,
+		},
+		"virtual-fail-open": {
+			description:   "validate that virtual pod lookup errors leave the pod unchanged",
+			failurePolicy: "fail-open",
+			mutateObj:     newHashedNameTestPod(),
+			expected:      newHashedNameTestPod().Spec.Volumes[0].ConfigMap.Name,
+		},
+		"virtual-fail-closed": {
+			description:     "validate that virtual pod lookup errors reject the pod",
+			failurePolicy:   "fail-closed",
+			mutateObj:       newHashedNameTestPod(),
+			expectedCluster: mutator.LookupClusterVirtual,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv("PREFER_PARENT_CONFIGMAPS_HOOK_FAILURE_POLICY", testCase.failurePolicy)
+
+			pClient := vclustersdksyncertesting.NewFakeClient(newScheme())
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				newScheme(),
+				testCase.vClientObjs...,
+			)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+			if testCase.pClientErr {
+				ctx = withErroringPhysicalClient(ctx)
+			}
+
+			h := hooks.NewPreferParentConfigmapsHook(ctx)
+
+			mutateObj := testCase.mutateObj
+			if mutateObj == nil {
+				mutateObj = newMetricsTestPod(nil)
+			}
+
+			res, err := h.MutateCreatePhysical(context.Background(), mutateObj)
+
+			if testCase.expectedCluster != "" {
+				lookupErr := &mutator.LookupError{}
+
+				if !errors.As(err, &lookupErr) {
+					t.Fatalf("got error '%v', want a lookup error", err)
+				}
+
+				if !errors.Is(err, mutator.ErrCantGetResource) {
+					t.Fatalf("lookup error '%v' does not match ErrCantGetResource", err)
+				}
+
+				if lookupErr.Cluster != testCase.expectedCluster {
+					t.Fatalf(
+						"got lookup error cluster '%s', want '%s'",
+						lookupErr.Cluster,
+						testCase.expectedCluster,
+					)
+				}
+
+				if string(lookupErr.Policy) != testCase.failurePolicy {
+					t.Fatalf(
+						"got lookup error policy '%s', want '%s'",
+						lookupErr.Policy,
+						testCase.failurePolicy,
+					)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := res.(*corev1.Pod).Spec.Volumes[0].ConfigMap.Name
+
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+		})
+	}
+}
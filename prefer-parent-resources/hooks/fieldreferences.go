@@ -0,0 +1,72 @@
+package hooks
+
+import (
+	"os"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+)
+
+const (
+	// FieldReferencesConfigEnv is the environment variable holding the path of the field
+	// references hook configuration file, if unset no field references hooks are created.
+	FieldReferencesConfigEnv = "PREFER_PARENT_FIELD_REFERENCES_CONFIG"
+)
+
+// GetFieldReferencesHooks returns the field references hooks configured in the file named by the
+// FieldReferencesConfigEnv environment variable, if it is set.
+func GetFieldReferencesHooks(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	options ...Option,
+) ([]EnvVolMutatingHook, error) {
+	path := os.Getenv(FieldReferencesConfigEnv)
+	if path == "" {
+		return nil, nil
+	}
+
+	config, err := mutator.LoadFieldReferencesConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []EnvVolMutatingHook
+
+	for i := range config.Hooks {
+		h, err := NewFieldReferencesHook(ctx, &config.Hooks[i], options...)
+		if err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, h)
+	}
+
+	return hooks, nil
+}
+
+// NewFieldReferencesHook returns a FieldReferencesHook hook.ClientHook for the hook
+// configuration config.
+func NewFieldReferencesHook(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	config *mutator.FieldReferencesHookConfig,
+	options ...Option,
+) (EnvVolMutatingHook, error) {
+	opts := newOptions(ctx, config.Name, options...)
+
+	m, err := mutator.NewFieldReferencesMutator(opts, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMutatorHook(opts, m), nil
+}
+
+// FieldReferencesHook is a hook.ClientHook implementation that prefers objects from the
+// physical/parent cluster over those created by/from the vcluster itself for configured fields of
+// any kind of object, for example the secretName of cert-manager certificates or the
+// certificateRefs of gateway listeners. This avoids writing a hook for every (custom) resource
+// that references configmaps or secrets by name. The skip and dry run annotations and the enabled
+// setting of the referenced kinds are honored as for pods.
+type FieldReferencesHook struct {
+	EnvVolMutatingHook
+}
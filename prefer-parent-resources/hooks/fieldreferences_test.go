@@ -0,0 +1,394 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const fieldReferencesTestConfig = `
+hooks:
+  - name: prefer-parent-gateways-hook
+    apiVersion: gateway.networking.k8s.io/v1beta1
+    kind: Gateway
+    references:
+      - kind: secret
+        path: spec.listeners[*].tls.certificateRefs[*].name
+  - name: prefer-parent-certificates-hook
+    apiVersion: cert-manager.io/v1
+    kind: Certificate
+    references:
+      - kind: secret
+        path: .spec.secretName
+`
+
+// newGatewayTestObject returns a physical gateway whose listeners reference the given tls secrets.
+func newGatewayTestObject(secretNames ...string) *unstructured.Unstructured {
+	var listeners []interface{}
+
+	for _, secretName := range secretNames {
+		listeners = append(listeners, map[string]interface{}{
+			"name": "https",
+			"tls": map[string]interface{}{
+				"certificateRefs": []interface{}{
+					map[string]interface{}{"kind": "Secret", "name": secretName},
+				},
+			},
+		})
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1beta1",
+			"kind":       "Gateway",
+			"metadata": map[string]interface{}{
+				"name":      "somegateway",
+				"namespace": "test",
+				"annotations": map[string]interface{}{
+					vclustersdksyncertranslator.NameAnnotation:      "somegateway",
+					vclustersdksyncertranslator.NamespaceAnnotation: "test",
+				},
+			},
+			"spec": map[string]interface{}{
+				"gatewayClassName": "someclass",
+				"listeners":        listeners,
+			},
+		},
+	}
+}
+
+func gatewaySecretNames(t *testing.T, obj *unstructured.Unstructured) []string {
+	t.Helper()
+
+	listeners, _, err := unstructured.NestedSlice(obj.Object, "spec", "listeners")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, listener := range listeners {
+		refs, _, err := unstructured.NestedSlice(
+			listener.(map[string]interface{}),
+			"tls",
+			"certificateRefs",
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, ref := range refs {
+			names = append(names, ref.(map[string]interface{})["name"].(string))
+		}
+	}
+
+	return names
+}
+
+func TestParseFieldReferencesConfig(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		config      string
+		expectedErr bool
+	}{
+		"valid": {
+			description: "validate that a valid configuration is parsed",
+			config:      fieldReferencesTestConfig,
+		},
+		"unknown-kind": {
+			description: "validate that references to unregistered kinds are rejected",
+			config: `
+hooks:
+  - name: prefer-parent-certificates-hook
+    apiVersion: cert-manager.io/v1
+    kind: Certificate
+    references:
+      - kind: widget
+        path: spec.secretName
+`,
+			expectedErr: true,
+		},
+		"indexed-last-field": {
+			description: "validate that paths not ending in a plain field are rejected",
+			config: `
+hooks:
+  - name: prefer-parent-certificates-hook
+    apiVersion: cert-manager.io/v1
+    kind: Certificate
+    references:
+      - kind: secret
+        path: spec.secretNames[*]
+`,
+			expectedErr: true,
+		},
+		"invalid-field": {
+			description: "validate that paths with invalid fields are rejected",
+			config: `
+hooks:
+  - name: prefer-parent-certificates-hook
+    apiVersion: cert-manager.io/v1
+    kind: Certificate
+    references:
+      - kind: secret
+        path: spec..secretName
+`,
+			expectedErr: true,
+		},
+		"duplicate-name": {
+			description: "validate that hooks with duplicate names are rejected",
+			config: fieldReferencesTestConfig + `
+  - name: prefer-parent-certificates-hook
+    apiVersion: cert-manager.io/v1
+    kind: Certificate
+    references:
+      - kind: secret
+        path: spec.secretName
+`,
+			expectedErr: true,
+		},
+		"unknown-setting": {
+			description: "validate that unknown settings are rejected",
+			config: `
+hooks:
+  - name: prefer-parent-certificates-hook
+    apiVersion: cert-manager.io/v1
+    kind: Certificate
+    refs: []
+`,
+			expectedErr: true,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			_, err := mutator.ParseFieldReferencesConfig([]byte(testCase.config))
+
+			if testCase.expectedErr {
+				if !errors.Is(err, mutator.ErrInvalidFieldReferencesConfig) {
+					t.Fatalf("expected ErrInvalidFieldReferencesConfig, got '%v'", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestFieldReferencesHook(t *testing.T) {
+	longSecret := somesecret.DeepCopy()
+	longSecret.Name = longConfigMapName
+
+	longPhysicalName := vclustersdktranslate.PhysicalName(longConfigMapName, "test")
+
+	cases := map[string]struct {
+		description string
+		dryRun      string
+		pClientObjs []runtime.Object
+		vClientObjs []runtime.Object
+		mutateObj   *unstructured.Unstructured
+		expected    []string
+	}{
+		"substituted": {
+			description: "validate that referenced secrets are substituted in every listener",
+			pClientObjs: []runtime.Object{somesecret},
+			mutateObj: newGatewayTestObject(
+				"somesecret-x-test-x-suffix",
+				"someothersecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			),
+			expected: []string{
+				"somesecret",
+				"someothersecret-x-test-x-suffix",
+				"somesecret",
+			},
+		},
+		"not-found": {
+			description: "validate that secrets missing from the parent are not substituted",
+			mutateObj:   newGatewayTestObject("somesecret-x-test-x-suffix"),
+			expected:    []string{"somesecret-x-test-x-suffix"},
+		},
+		"dry-run": {
+			description: "validate that nothing is substituted in dry run mode",
+			dryRun:      "true",
+			pClientObjs: []runtime.Object{somesecret},
+			mutateObj:   newGatewayTestObject("somesecret-x-test-x-suffix"),
+			expected:    []string{"somesecret-x-test-x-suffix"},
+		},
+		"virtual-fallback": {
+			description: "validate that hashed names are resolved from the virtual object",
+			pClientObjs: []runtime.Object{longSecret},
+			vClientObjs: []runtime.Object{
+				func() *unstructured.Unstructured {
+					obj := newGatewayTestObject(longConfigMapName)
+					obj.SetAnnotations(nil)
+
+					return obj
+				}(),
+			},
+			mutateObj: newGatewayTestObject(longPhysicalName),
+			expected:  []string{longConfigMapName},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv("PREFER_PARENT_GATEWAYS_HOOK_DRY_RUN", testCase.dryRun)
+
+			config, err := mutator.ParseFieldReferencesConfig([]byte(fieldReferencesTestConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.vClientObjs...)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h, err := hooks.NewFieldReferencesHook(ctx, &config.Hooks[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if h.Resource().GetObjectKind().GroupVersionKind().Kind != "Gateway" {
+				t.Fatalf("expected hook resource to be a gateway, got %v", h.Resource())
+			}
+
+			res, err := h.MutateCreatePhysical(context.Background(), testCase.mutateObj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := gatewaySecretNames(t, res.(*unstructured.Unstructured))
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"actual and expected secret names do not match\n%s",
+					cmp.Diff(actual, testCase.expected),
+				)
+			}
+		})
+	}
+}
+
+func TestLoadAllHooks(t *testing.T) {
+	validConfig := filepath.Join(t.TempDir(), "config.yaml")
+
+	err := os.WriteFile(validConfig, []byte(fieldReferencesTestConfig), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		description string
+		config      string
+		expected    int
+		expectedErr bool
+	}{
+		"no-config": {
+			description: "validate that only the core hooks are returned without a config",
+			expected:    2,
+		},
+		"config": {
+			description: "validate that the configured field references hooks are appended",
+			config:      validConfig,
+			expected:    4,
+		},
+		"invalid-config": {
+			description: "validate that an invalid config fails loading but not getting the hooks",
+			config:      filepath.Join(t.TempDir(), "missing.yaml"),
+			expected:    2,
+			expectedErr: true,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv(hooks.FieldReferencesConfigEnv, testCase.config)
+
+			scheme := newScheme()
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(
+				vclustersdksyncertesting.NewFakeClient(scheme),
+				vclustersdksyncertesting.NewFakeClient(scheme),
+			)
+
+			loaded, err := hooks.LoadAllHooks(ctx)
+			if testCase.expectedErr != (err != nil) {
+				t.Fatalf("expected error %t, got '%v'", testCase.expectedErr, err)
+			}
+
+			if err == nil && len(loaded) != testCase.expected {
+				t.Fatalf("expected %d loaded hooks, got %d", testCase.expected, len(loaded))
+			}
+
+			if actual := len(hooks.GetAllHooks(ctx)); actual != testCase.expected {
+				t.Fatalf("expected %d hooks, got %d", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFieldReferencesHookRepeatedUpdates(t *testing.T) {
+	config, err := mutator.ParseFieldReferencesConfig([]byte(fieldReferencesTestConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheme := newScheme()
+
+	pClient := vclustersdksyncertesting.NewFakeClient(scheme, somesecret)
+	vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+	ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+	h, err := hooks.NewFieldReferencesHook(ctx, &config.Hooks[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := newGatewayTestObject("somesecret-x-test-x-suffix")
+
+	for i := 0; i < 3; i++ {
+		// the syncer sends the translated secret name again with every update
+		annotations := obj.GetAnnotations()
+
+		obj = newGatewayTestObject("somesecret-x-test-x-suffix")
+		obj.SetAnnotations(annotations)
+
+		res, err := h.MutateUpdatePhysical(context.Background(), obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj = res.(*unstructured.Unstructured)
+	}
+
+	actual := obj.GetAnnotations()["vcluster.loft.sh/mutated-by-hook"]
+
+	if actual != h.Name() {
+		t.Fatalf("got mutated by annotation '%s', want '%s'", actual, h.Name())
+	}
+}
@@ -0,0 +1,204 @@
+package hooks_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/explain"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	apimachineryyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// goldenDir holds the golden test cases, each case is a directory holding the manifests of the
+// parent objects (parent.yaml), the virtual objects (virtual.yaml), the physical pod being created
+// (pod.yaml), optionally the environment variables of the hooks (env.yaml) and the expected
+// output of the hooks (expected.yaml). Run the tests with -update to rewrite the expected output.
+const goldenDir = "testdata/golden"
+
+var updateGolden = flag.Bool("update", false, "update the expected output of the golden tests")
+
+func TestGolden(t *testing.T) {
+	entries, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		testName := entry.Name()
+		dir := filepath.Join(goldenDir, testName)
+
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			for k, v := range loadGoldenEnv(t, filepath.Join(dir, "env.yaml")) {
+				t.Setenv(k, v)
+			}
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(
+				scheme,
+				loadGoldenObjects(t, scheme, filepath.Join(dir, "parent.yaml"))...,
+			)
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				scheme,
+				loadGoldenObjects(t, scheme, filepath.Join(dir, "virtual.yaml"))...,
+			)
+
+			pods := loadGoldenObjects(t, scheme, filepath.Join(dir, "pod.yaml"))
+			if len(pods) != 1 {
+				t.Fatalf("%s: pod.yaml must hold exactly one object", testName)
+			}
+
+			pod, ok := pods[0].(*corev1.Pod)
+			if !ok {
+				t.Fatalf("%s: pod.yaml does not hold a pod", testName)
+			}
+
+			actual := runGoldenHooks(
+				t,
+				vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient),
+				pod,
+			)
+
+			expectedPath := filepath.Join(dir, "expected.yaml")
+
+			if *updateGolden {
+				err = os.WriteFile(expectedPath, actual, 0o600)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			expected, err := os.ReadFile(expectedPath)
+			if err != nil {
+				t.Fatalf("%s: failed reading expected output, run with -update to create it", testName)
+			}
+
+			if diff := cmp.Diff(string(expected), string(actual)); diff != "" {
+				t.Fatalf("%s: actual and expected output do not match (-expected +actual):\n%s",
+					testName,
+					diff,
+				)
+			}
+		})
+	}
+}
+
+// runGoldenHooks runs every pod hook returned by LoadAllHooks on the pod with explain.RunHooks,
+// and returns the YAML of the resulting pod, or a comment holding the error if a hook rejected it.
+func runGoldenHooks(
+	t *testing.T,
+	ctx *vclustersdksyncercontext.RegisterContext,
+	pod *corev1.Pod,
+) []byte {
+	t.Helper()
+
+	allHooks, err := hooks.LoadAllHooks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := explain.RunHooks(context.Background(), allHooks, pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Rejection != nil {
+		return []byte("# rejected by " + result.Rejection.Error() + "\n")
+	}
+
+	b, err := yaml.Marshal(result.Pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// loadGoldenObjects decodes the objects of the (multi document) manifest file at path, a missing
+// file holds no objects.
+func loadGoldenObjects(t *testing.T, scheme *runtime.Scheme, path string) []runtime.Object {
+	t.Helper()
+
+	b, err := os.ReadFile(path) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deserializer := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+	decoder := apimachineryyaml.NewYAMLOrJSONDecoder(bytes.NewReader(b), 4096)
+
+	var objs []runtime.Object
+
+	for {
+		raw := runtime.RawExtension{}
+
+		err = decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return objs
+		}
+
+		if err != nil {
+			t.Fatalf("failed decoding '%s', error: %s", path, err)
+		}
+
+		if len(raw.Raw) == 0 {
+			continue
+		}
+
+		obj, _, err := deserializer.Decode(raw.Raw, nil, nil)
+		if err != nil {
+			t.Fatalf("failed decoding '%s', error: %s", path, err)
+		}
+
+		objs = append(objs, obj)
+	}
+}
+
+// loadGoldenEnv reads the environment variables of the env file at path, a missing file holds no
+// environment variables.
+func loadGoldenEnv(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	b, err := os.ReadFile(path) //nolint:gosec
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{}
+
+	err = yaml.UnmarshalStrict(b, &env)
+	if err != nil {
+		t.Fatalf("failed decoding '%s', error: %s", path, err)
+	}
+
+	return env
+}
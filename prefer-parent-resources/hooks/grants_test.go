@@ -0,0 +1,243 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newGrantConfigMap returns a grant configmap in the host namespace holding grant.
+func newGrantConfigMap(name, grant string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "test",
+			Labels:    map[string]string{mutator.GrantLabel: "true"},
+		},
+		Data: map[string]string{mutator.GrantDataKey: grant},
+	}
+}
+
+// newLabelledTestPods returns the virtual pod labelled with podLabels and the physical pod synced
+// from it, whose label keys are translated the way vcluster translates them.
+func newLabelledTestPods(podLabels map[string]string) (pPod, vPod *corev1.Pod) {
+	vPod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "somepod",
+			Namespace: "test",
+			Labels:    podLabels,
+		},
+	}
+
+	pPod = newMetricsTestPod(nil)
+
+	if podLabels != nil {
+		pPod.Labels = map[string]string{}
+
+		for k, v := range podLabels {
+			pPod.Labels[vclustersdksyncertranslator.ConvertLabelKey(k)] = v
+		}
+	}
+
+	return pPod, vPod
+}
+
+func TestParentResourceGrants(t *testing.T) {
+	cases := map[string]struct {
+		description   string
+		requireGrants string
+		podLabels     map[string]string
+		pClientObjs   []runtime.Object
+		expected      string
+	}{
+		"grants-not-required": {
+			description: "validate that grants are not checked unless required",
+			pClientObjs: []runtime.Object{someconfigmap},
+			expected:    "someconfigmap",
+		},
+		"no-grants": {
+			description:   "validate that parent objects are not substituted without a grant",
+			requireGrants: "true",
+			pClientObjs:   []runtime.Object{someconfigmap},
+			expected:      "someconfigmap-x-test-x-suffix",
+		},
+		"granted": {
+			description:   "validate that granted parent objects are substituted",
+			requireGrants: "true",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: configmap
+    names: [someconfigmap]
+namespaces: [other, test]
+`),
+			},
+			expected: "someconfigmap",
+		},
+		"wildcard": {
+			description:   "validate that wildcard grants allow every name and namespace",
+			requireGrants: "true",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: configmap
+    names: ["*"]
+namespaces: ["*"]
+`),
+			},
+			expected: "someconfigmap",
+		},
+		"other-kind": {
+			description:   "validate that grants only allow the granted kind",
+			requireGrants: "true",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: secret
+    names: [someconfigmap]
+namespaces: [test]
+`),
+			},
+			expected: "someconfigmap-x-test-x-suffix",
+		},
+		"other-namespace": {
+			description:   "validate that grants for other namespaces do not allow substituting",
+			requireGrants: "true",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: configmap
+    names: [someconfigmap]
+namespaces: [other]
+`),
+			},
+			expected: "someconfigmap-x-test-x-suffix",
+		},
+		"selected": {
+			description:   "validate that grants with a selector allow the pods they select",
+			requireGrants: "true",
+			podLabels:     map[string]string{"app": "someapp"},
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: configmap
+    names: [someconfigmap]
+namespaces: [test]
+selector:
+  matchLabels:
+    app: someapp
+`),
+			},
+			expected: "someconfigmap",
+		},
+		"not-selected": {
+			description:   "validate that grants with a selector deny the pods they do not select",
+			requireGrants: "true",
+			podLabels:     map[string]string{"app": "someotherapp"},
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: configmap
+    names: [someconfigmap]
+namespaces: [test]
+selector:
+  matchLabels:
+    app: someapp
+`),
+			},
+			expected: "someconfigmap-x-test-x-suffix",
+		},
+		"selected-by-expression": {
+			description:   "validate that grants select pods by the expressions of their selector",
+			requireGrants: "true",
+			podLabels:     map[string]string{"app": "someapp", "tier": "backend"},
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources:
+  - kind: configmap
+    names: [someconfigmap]
+namespaces: [test]
+selector:
+  matchExpressions:
+    - key: tier
+      operator: In
+      values: [backend]
+`),
+			},
+			expected: "someconfigmap",
+		},
+		"invalid-grant": {
+			description:   "validate that invalid grants are ignored",
+			requireGrants: "true",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newGrantConfigMap("somegrant", `
+resources: someconfigmap
+namespaces: [test]
+`),
+			},
+			expected: "someconfigmap-x-test-x-suffix",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv("PREFER_PARENT_RESOURCES_HOOK_REQUIRE_GRANTS", testCase.requireGrants)
+
+			scheme := newScheme()
+
+			pod, vPod := newLabelledTestPods(testCase.podLabels)
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, vPod)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := res.(*corev1.Pod).Spec.Volumes[0].ConfigMap.Name
+
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestParseParentResourceGrant(t *testing.T) {
+	_, err := mutator.ParseParentResourceGrant([]byte(`
+resources:
+  - kind: secret
+    names: [somesecret]
+namespaces: [test]
+selector:
+  matchExpressions:
+    - key: app
+      operator: Bogus
+`))
+	if !errors.Is(err, mutator.ErrInvalidGrant) {
+		t.Fatalf("expected ErrInvalidGrant, got '%v'", err)
+	}
+}
@@ -1,14 +1,59 @@
 package hooks
 
 import (
+	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
 	vclustersdksyncer "github.com/loft-sh/vcluster-sdk/syncer"
 	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
 )
 
-// GetAllHooks returns all hook objects to register.
+// GetAllHooks returns all hook objects to register. If the field references configuration is
+// invalid the error is logged and only the core hooks are returned, so the objects of the
+// configured field references are left unmutated. Callers that should fail on an invalid
+// configuration, such as the plugin main, use LoadAllHooks which returns the error instead.
 func GetAllHooks(ctx *vclustersdksyncercontext.RegisterContext) []vclustersdksyncer.Base {
+	hooks, err := LoadAllHooks(ctx)
+	if err != nil {
+		vclustersdklog.New("prefer-parent-hooks").Errorf(
+			"failed loading field references hooks, error: '%s'",
+			err,
+		)
+
+		hooks = coreHooks(ctx)
+	}
+
+	return hooks
+}
+
+// LoadAllHooks returns all hook objects to register. The references of pods to every registered
+// kind are handled by the single PreferParentResourcesHook, so that every pod is resolved in one
+// pass. The field references hooks configured by the FieldReferencesConfigEnv file are appended,
+// an error is returned if the configuration is invalid. The options modify the mutator.Options of
+// every hook.
+func LoadAllHooks(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	options ...Option,
+) ([]vclustersdksyncer.Base, error) {
+	hooks := coreHooks(ctx, options...)
+
+	fieldReferencesHooks, err := GetFieldReferencesHooks(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range fieldReferencesHooks {
+		hooks = append(hooks, h)
+	}
+
+	return hooks, nil
+}
+
+// coreHooks returns the hooks that are registered regardless of the configuration.
+func coreHooks(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	options ...Option,
+) []vclustersdksyncer.Base {
 	return []vclustersdksyncer.Base{
-		NewPreferParentConfigmapsHook(ctx),
-		NewPreferParentSecretsHook(ctx),
+		NewPreferParentResourcesHook(ctx, options...),
+		NewPreferParentIngressTLSSecretsHook(ctx, options...),
 	}
 }
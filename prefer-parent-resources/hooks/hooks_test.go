@@ -1,12 +1,19 @@
 package hooks_test
 
 import (
+	"context"
+	"errors"
+
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
 	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+var errTestLookup = errors.New("errTestLookup")
+
 type comparePodTestCase struct {
 	description string
 	inPod       *corev1.Pod
@@ -40,3 +47,39 @@ type testPreferParentEnvVolTestCase struct {
 	envPos       int
 	expected     string
 }
+
+// erroringClient is a client whose Get always fails with errTestLookup.
+type erroringClient struct {
+	ctrlruntimeclient.Client
+}
+
+func (c *erroringClient) Get(
+	_ context.Context,
+	_ ctrlruntimeclient.ObjectKey,
+	_ ctrlruntimeclient.Object,
+) error {
+	return errTestLookup
+}
+
+// erroringManager is a manager whose client and api reader are erroringClients.
+type erroringManager struct {
+	ctrlruntime.Manager
+}
+
+func (m *erroringManager) GetClient() ctrlruntimeclient.Client {
+	return &erroringClient{Client: m.Manager.GetClient()}
+}
+
+func (m *erroringManager) GetAPIReader() ctrlruntimeclient.Reader {
+	return &erroringClient{Client: m.Manager.GetClient()}
+}
+
+// withErroringPhysicalClient replaces the physical manager of the given context with one whose
+// client fails every Get with an error other than not found.
+func withErroringPhysicalClient(
+	ctx *vclustersdksyncercontext.RegisterContext,
+) *vclustersdksyncercontext.RegisterContext {
+	ctx.PhysicalManager = &erroringManager{Manager: ctx.PhysicalManager}
+
+	return ctx
+}
@@ -0,0 +1,26 @@
+package hooks
+
+import (
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+)
+
+// NewPreferParentIngressTLSSecretsHook returns a PreferParentIngressTLSSecretsHook
+// hook.ClientHook.
+func NewPreferParentIngressTLSSecretsHook(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	options ...Option,
+) EnvVolMutatingHook {
+	opts := newOptions(ctx, mutator.IngressTLSSecretsHookName, options...)
+
+	return newMutatorHook(opts, mutator.NewIngressTLSSecretsMutator(opts))
+}
+
+// PreferParentIngressTLSSecretsHook is a hook.ClientHook implementation that will prefer tls
+// secrets from the physical/parent cluster over those created by/from the vcluster itself for the
+// tls entries of ingresses, for example to share a wildcard certificate with every vcluster. Only
+// secrets of type kubernetes.io/tls are substituted.
+type PreferParentIngressTLSSecretsHook struct {
+	EnvVolMutatingHook
+}
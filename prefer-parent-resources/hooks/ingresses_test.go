@@ -0,0 +1,170 @@
+package hooks_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newSomeTLSSecret(secretType corev1.SecretType) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "sometlssecret",
+			Namespace: "test",
+		},
+		Type: secretType,
+	}
+}
+
+func newIngressTestIngress(secretName string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "someingress",
+			Namespace: "test",
+			Annotations: map[string]string{
+				vclustersdksyncertranslator.NameAnnotation:      "someingress",
+				vclustersdksyncertranslator.NamespaceAnnotation: "test",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			TLS: []networkingv1.IngressTLS{
+				{Hosts: []string{"some.example.com"}, SecretName: secretName},
+			},
+		},
+	}
+}
+
+func TestPreferParentIngressTLSSecrets(t *testing.T) {
+	longSecretName := "some" + strings.Repeat("verylong", 7) + "tlssecret"
+
+	longSecret := newSomeTLSSecret(corev1.SecretTypeTLS)
+	longSecret.Name = longSecretName
+
+	longVIngress := newIngressTestIngress(longSecretName)
+	longVIngress.Annotations = nil
+
+	cases := map[string]struct {
+		description string
+		update      bool
+		pClientObjs []runtime.Object
+		vClientObjs []runtime.Object
+		mutateObj   *networkingv1.Ingress
+		expected    string
+	}{
+		"tls-secret": {
+			description: "validate that parent tls secrets are substituted",
+			pClientObjs: []runtime.Object{newSomeTLSSecret(corev1.SecretTypeTLS)},
+			mutateObj:   newIngressTestIngress("sometlssecret-x-test-x-suffix"),
+			expected:    "sometlssecret",
+		},
+		"tls-secret-update": {
+			description: "validate that parent tls secrets are substituted on updates",
+			update:      true,
+			pClientObjs: []runtime.Object{newSomeTLSSecret(corev1.SecretTypeTLS)},
+			mutateObj:   newIngressTestIngress("sometlssecret-x-test-x-suffix"),
+			expected:    "sometlssecret",
+		},
+		"opaque-secret": {
+			description: "validate that parent secrets that are not tls secrets are not substituted",
+			pClientObjs: []runtime.Object{newSomeTLSSecret(corev1.SecretTypeOpaque)},
+			mutateObj:   newIngressTestIngress("sometlssecret-x-test-x-suffix"),
+			expected:    "sometlssecret-x-test-x-suffix",
+		},
+		"not-found": {
+			description: "validate that secrets missing from the parent are not substituted",
+			mutateObj:   newIngressTestIngress("sometlssecret-x-test-x-suffix"),
+			expected:    "sometlssecret-x-test-x-suffix",
+		},
+		"hashed-name": {
+			description: "validate that names that cannot be reverse translated are resolved " +
+				"from the virtual ingress",
+			pClientObjs: []runtime.Object{longSecret},
+			vClientObjs: []runtime.Object{longVIngress},
+			mutateObj: newIngressTestIngress(
+				vclustersdktranslate.PhysicalName(longSecretName, "test"),
+			),
+			expected: longSecretName,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.vClientObjs...)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentIngressTLSSecretsHook(ctx)
+
+			if _, ok := h.Resource().(*networkingv1.Ingress); !ok {
+				t.Fatalf("got resource '%T', want ingress", h.Resource())
+			}
+
+			var (
+				res ctrlruntimeclient.Object
+				err error
+			)
+
+			if testCase.update {
+				res, err = h.MutateUpdatePhysical(context.Background(), testCase.mutateObj)
+			} else {
+				res, err = h.MutateCreatePhysical(context.Background(), testCase.mutateObj)
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := res.(*networkingv1.Ingress).Spec.TLS[0].SecretName
+
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+func TestPreferParentIngressTLSSecretsRepeatedUpdates(t *testing.T) {
+	scheme := newScheme()
+
+	pClient := vclustersdksyncertesting.NewFakeClient(scheme, newSomeTLSSecret(corev1.SecretTypeTLS))
+	vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+	ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+	h := hooks.NewPreferParentIngressTLSSecretsHook(ctx)
+
+	ingress := newIngressTestIngress("sometlssecret-x-test-x-suffix")
+
+	for i := 0; i < 3; i++ {
+		// the syncer sends the translated secret name again with every update
+		ingress.Spec.TLS[0].SecretName = "sometlssecret-x-test-x-suffix"
+
+		res, err := h.MutateUpdatePhysical(context.Background(), ingress)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ingress = res.(*networkingv1.Ingress)
+	}
+
+	actual := ingress.Annotations["vcluster.loft.sh/mutated-by-hook"]
+
+	if actual != h.Name() {
+		t.Fatalf("got mutated by annotation '%s', want '%s'", actual, h.Name())
+	}
+}
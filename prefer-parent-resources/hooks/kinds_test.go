@@ -0,0 +1,129 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// csiSecretKind is a mutator.ReferenceableKind substituting the node publish secrets of csi
+// volumes.
+type csiSecretKind struct {
+	mutator.SecretKind
+}
+
+func (csiSecretKind) Name() string {
+	return "csisecret"
+}
+
+func (csiSecretKind) HookName() string {
+	return "prefer-parent-csi-secrets-hook"
+}
+
+func (csiSecretKind) SkipAnnotation() string {
+	return "skip-prefer-parent-csi-secrets-hook"
+}
+
+func (csiSecretKind) DryRunAnnotation() string {
+	return "dry-run-prefer-parent-csi-secrets-hook"
+}
+
+func (csiSecretKind) FindReferences(podSpec *corev1.PodSpec) []mutator.Reference {
+	var refs []mutator.Reference
+
+	for i := range podSpec.Volumes {
+		vol := &podSpec.Volumes[i]
+
+		if vol.CSI == nil || vol.CSI.NodePublishSecretRef == nil {
+			continue
+		}
+
+		refs = append(refs, mutator.Reference{
+			Source:      mutator.ReferenceSourceVolume,
+			VolumeIndex: i,
+			Volume:      vol.Name,
+		})
+	}
+
+	return refs
+}
+
+func (csiSecretKind) GetName(podSpec *corev1.PodSpec, ref *mutator.Reference) string {
+	return podSpec.Volumes[ref.VolumeIndex].CSI.NodePublishSecretRef.Name
+}
+
+func (csiSecretKind) SetName(podSpec *corev1.PodSpec, ref *mutator.Reference, name string) {
+	podSpec.Volumes[ref.VolumeIndex].CSI.NodePublishSecretRef.Name = name
+}
+
+func TestRegisterKind(t *testing.T) {
+	err := mutator.RegisterKind(mutator.ConfigMapKind{})
+	if !errors.Is(err, mutator.ErrKindAlreadyRegistered) {
+		t.Fatalf("got error '%v', want '%v'", err, mutator.ErrKindAlreadyRegistered)
+	}
+
+	err = mutator.RegisterKind(csiSecretKind{})
+	if err != nil && !errors.Is(err, mutator.ErrKindAlreadyRegistered) {
+		t.Fatal(err)
+	}
+
+	kind, ok := mutator.GetKind("csisecret")
+	if !ok {
+		t.Fatal("registered kind 'csisecret' not found")
+	}
+
+	if _, ok = kind.(csiSecretKind); !ok {
+		t.Fatalf("got kind '%T', want '%T'", kind, csiSecretKind{})
+	}
+
+	scheme := newScheme()
+
+	pClient := vclustersdksyncertesting.NewFakeClient(scheme, somesecret)
+	vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+	ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+	h := hooks.NewPreferParentResourcesHook(ctx)
+
+	mutateObj := newMetricsTestPod(nil)
+	mutateObj.Spec.Volumes = []corev1.Volume{
+		newCSIVolume("somecsi", "somesecret-x-test-x-suffix"),
+		newCSIVolume("someothercsi", "someothersecret-x-test-x-suffix"),
+	}
+
+	res, err := h.MutateCreatePhysical(context.Background(), mutateObj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resPod := res.(*corev1.Pod)
+
+	expected := []string{"somesecret", "someothersecret-x-test-x-suffix"}
+
+	for i, vol := range resPod.Spec.Volumes {
+		if vol.CSI.NodePublishSecretRef.Name != expected[i] {
+			t.Fatalf(
+				"got csi secret '%s', want '%s'",
+				vol.CSI.NodePublishSecretRef.Name,
+				expected[i],
+			)
+		}
+	}
+}
+
+func newCSIVolume(name, secretName string) corev1.Volume {
+	return corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{
+				Driver:               "some.csi.driver",
+				NodePublishSecretRef: &corev1.LocalObjectReference{Name: secretName},
+			},
+		},
+	}
+}
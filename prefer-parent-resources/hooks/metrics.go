@@ -0,0 +1,92 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
+)
+
+const (
+	// MetricsBindAddressEnv is the environment variable that sets the address the metrics server
+	// listens on. Setting it to "0" disables the metrics server.
+	MetricsBindAddressEnv = "PREFER_PARENT_METRICS_BIND_ADDRESS"
+
+	// DefaultMetricsBindAddress is the address the metrics server listens on when
+	// MetricsBindAddressEnv is not set. The plugin runs in the syncer pod next to the syncer and
+	// possibly other sidecars, so the port is none of those Prometheus (9090), the node exporter
+	// (9100) or controller-runtime managers (8080, 8081) use by default.
+	DefaultMetricsBindAddress = ":9765"
+
+	// MetricsPath is the http path the metrics are served on.
+	MetricsPath = "/metrics"
+
+	metricsReadHeaderTimeout = 5 * time.Second
+	metricsShutdownTimeout   = 5 * time.Second
+)
+
+// GetMetricsBindAddress returns the address the metrics server should listen on, this is the
+// value of MetricsBindAddressEnv if set, otherwise DefaultMetricsBindAddress.
+func GetMetricsBindAddress() string {
+	addr, ok := os.LookupEnv(MetricsBindAddressEnv)
+	if !ok || addr == "" {
+		return DefaultMetricsBindAddress
+	}
+
+	return addr
+}
+
+// ServeMetrics serves mutator.MetricsHandler at MetricsPath on the given address until the
+// provided context is cancelled. If the address is "0" this is a no-op.
+func ServeMetrics(ctx context.Context, addr string) error {
+	if addr == "0" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(MetricsPath, mutator.MetricsHandler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// StartMetricsServer starts ServeMetrics in the background on the address returned by
+// GetMetricsBindAddress, any error serving the metrics is logged.
+func StartMetricsServer(ctx context.Context) {
+	log := vclustersdklog.New("metrics")
+
+	addr := GetMetricsBindAddress()
+
+	go func() {
+		log.Infof("serving metrics on '%s'", addr)
+
+		err := ServeMetrics(ctx, addr)
+		if err != nil {
+			log.Errorf("failed serving metrics on '%s', error: '%s'", addr, err)
+		}
+	}()
+}
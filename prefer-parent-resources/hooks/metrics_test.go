@@ -0,0 +1,222 @@
+package hooks_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// scrapeMetric scrapes the given url and returns the value of the provided series, or zero if the
+// series is not present.
+func scrapeMetric(t *testing.T, url, series string) float64 {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if !strings.HasPrefix(line, series+" ") {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return v
+	}
+
+	return 0
+}
+
+func newMetricsTestPod(annotations map[string]string) *corev1.Pod {
+	podAnnotations := map[string]string{
+		vclustersdksyncertranslator.NameAnnotation:      "somepod",
+		vclustersdksyncertranslator.NamespaceAnnotation: "test",
+	}
+
+	for k, v := range annotations {
+		podAnnotations[k] = v
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "somepod",
+			Namespace:   "test",
+			Annotations: podAnnotations,
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: "someconfigmap-x-test-x-suffix",
+						},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	server := httptest.NewServer(mutator.MetricsHandler())
+	defer server.Close()
+
+	const (
+		substituted = `prefer_parent_resources_mutations_total{hook="prefer-parent-configmaps-hook",` +
+			`kind="configmap",outcome="substituted"}`
+		notFound = `prefer_parent_resources_mutations_total{hook="prefer-parent-configmaps-hook",` +
+			`kind="configmap",outcome="not_found"}`
+		errored = `prefer_parent_resources_mutations_total{hook="prefer-parent-configmaps-hook",` +
+			`kind="configmap",outcome="error"}`
+		lookups = `prefer_parent_resources_parent_lookup_duration_seconds_count{` +
+			`hook="prefer-parent-configmaps-hook",kind="configmap"}`
+		lookupErrors = `prefer_parent_resources_parent_lookup_errors_total{` +
+			`hook="prefer-parent-configmaps-hook",kind="configmap"}`
+		skips = `prefer_parent_resources_annotation_skips_total{hook="prefer-parent-configmaps-hook"}`
+	)
+
+	cases := map[string]struct {
+		pClientErr  bool
+		pClientObjs []runtime.Object
+		mutateObj   *corev1.Pod
+		expected    map[string]float64
+	}{
+		"substituted": {
+			pClientObjs: []runtime.Object{someconfigmap},
+			mutateObj:   newMetricsTestPod(nil),
+			expected:    map[string]float64{substituted: 1, lookups: 1},
+		},
+		"not-found": {
+			mutateObj: newMetricsTestPod(nil),
+			expected:  map[string]float64{notFound: 1, lookups: 1},
+		},
+		"lookup-error": {
+			pClientErr: true,
+			mutateObj:  newMetricsTestPod(nil),
+			expected:   map[string]float64{errored: 1, lookups: 1, lookupErrors: 1},
+		},
+		"skip-annotation": {
+			pClientObjs: []runtime.Object{someconfigmap},
+			mutateObj: newMetricsTestPod(
+				map[string]string{mutator.SkipPreferConfigMapsHook: "1"},
+			),
+			// skipped references are not looked up
+			expected: map[string]float64{skips: 1},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			before := map[string]float64{}
+
+			for _, series := range []string{
+				substituted, notFound, errored, lookups, lookupErrors, skips,
+			} {
+				before[series] = scrapeMetric(t, server.URL, series)
+			}
+
+			pClient := vclustersdksyncertesting.NewFakeClient(
+				newScheme(),
+				testCase.pClientObjs...,
+			)
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				newScheme(),
+				somepodWithConfigmapVolume,
+			)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+			if testCase.pClientErr {
+				ctx = withErroringPhysicalClient(ctx)
+			}
+
+			h := hooks.NewPreferParentConfigmapsHook(ctx)
+
+			_, err := h.MutateCreatePhysical(context.Background(), testCase.mutateObj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for series, beforeValue := range before {
+				actual := scrapeMetric(t, server.URL, series) - beforeValue
+
+				if actual != testCase.expected[series] {
+					t.Fatalf("series %s: got delta '%v', want '%v'", series, actual,
+						testCase.expected[series])
+				}
+			}
+		})
+	}
+}
+
+func TestGetMetricsBindAddress(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		env         string
+		expected    string
+	}{
+		"default": {
+			description: "validate that the default address is used if the env is unset",
+			expected:    hooks.DefaultMetricsBindAddress,
+		},
+		"env": {
+			description: "validate that the address of the env is used if set",
+			env:         ":19090",
+			expected:    ":19090",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv(hooks.MetricsBindAddressEnv, testCase.env)
+
+			actual := hooks.GetMetricsBindAddress()
+			if actual != testCase.expected {
+				t.Fatalf(
+					"%s: actual and expected addresses do not match\nactual: %s\nexpected:%s",
+					testName,
+					actual,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
+
+func TestServeMetricsDisabled(t *testing.T) {
+	err := hooks.ServeMetrics(context.Background(), "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,240 @@
+package hooks_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// longConfigMapName is long enough that vcluster has to shorten (hash) its translated name, so
+// it cannot be reverse translated.
+var longConfigMapName = "some" + strings.Repeat("verylong", 7) + "configmap"
+
+// newHashedNameTestPod returns a physical pod mounting the configmap longConfigMapName as a
+// volume.
+func newHashedNameTestPod() *corev1.Pod {
+	pod := newMetricsTestPod(nil)
+	pod.Spec.Volumes[0].ConfigMap.Name = vclustersdktranslate.PhysicalName(longConfigMapName, "test")
+
+	return pod
+}
+
+func TestPreferParentConfigmapsResolveVirtualName(t *testing.T) {
+	longConfigMap := someconfigmap.DeepCopy()
+	longConfigMap.Name = longConfigMapName
+
+	longVPod := somepodWithConfigmapVolume.DeepCopy()
+	longVPod.Spec.Volumes[0].ConfigMap.Name = longConfigMapName
+
+	cases := map[string]struct {
+		description string
+		pClientObjs []runtime.Object
+		vClientObjs []runtime.Object
+		mutateObj   *corev1.Pod
+		expected    string
+	}{
+		"reverse-translated": {
+			description: "validate that translated names are resolved without fetching the " +
+				"virtual pod",
+			pClientObjs: []runtime.Object{someconfigmap},
+			mutateObj:   newMetricsTestPod(nil),
+			expected:    "someconfigmap",
+		},
+		"hashed-name-falls-back-to-virtual-pod": {
+			description: "validate that names that cannot be reverse translated are resolved " +
+				"from the virtual pod",
+			pClientObjs: []runtime.Object{longConfigMap},
+			vClientObjs: []runtime.Object{longVPod},
+			mutateObj:   newHashedNameTestPod(),
+			expected:    longConfigMapName,
+		},
+		"other-namespace-not-reverse-translated": {
+			description: "validate that names translated for another namespace are not reverse " +
+				"translated",
+			pClientObjs: []runtime.Object{someconfigmap},
+			vClientObjs: []runtime.Object{somepodWithConfigmapVolume},
+			mutateObj: func() *corev1.Pod {
+				pod := newMetricsTestPod(nil)
+				pod.Spec.Volumes[0].ConfigMap.Name = "someconfigmap-x-other-x-suffix"
+
+				return pod
+			}(),
+			expected: "someconfigmap-x-other-x-suffix",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			// the virtual pod lookups must fail the mutation if they are needed but do not succeed
+			t.Setenv("PREFER_PARENT_CONFIGMAPS_HOOK_FAILURE_POLICY", "fail-closed")
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.vClientObjs...)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentConfigmapsHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), testCase.mutateObj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := res.(*corev1.Pod).Spec.Volumes[0].ConfigMap.Name
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+		})
+	}
+}
+
+// newInjectedTestPods returns a virtual pod with a container "somecontainer" using the configmap
+// longConfigMapName as environment variable, and mounting it as volume "somevolume", along with
+// its physical pod. The physical pod has an injected sidecar container, environment variable and
+// volume in front of those of the virtual pod, like a pod the syncer or other plugins added to.
+func newInjectedTestPods() (pod, vPod *corev1.Pod) {
+	newContainer := func(name, configMapName string) corev1.Container {
+		return corev1.Container{
+			Name:  name,
+			Image: "someimage:latest",
+			Env: []corev1.EnvVar{
+				{
+					Name: "env-from-real-configmap",
+					ValueFrom: &corev1.EnvVarSource{
+						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapName,
+							},
+							Key: "somekey",
+						},
+					},
+				},
+			},
+		}
+	}
+
+	newVolume := func(name, configMapName string) corev1.Volume {
+		return corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: configMapName},
+				},
+			},
+		}
+	}
+
+	vPod = somepodWithConfigmapVolume.DeepCopy()
+	vPod.Spec.Containers = []corev1.Container{newContainer("somecontainer", longConfigMapName)}
+	vPod.Spec.Volumes = []corev1.Volume{newVolume("somevolume", longConfigMapName)}
+
+	pName := vclustersdktranslate.PhysicalName(longConfigMapName, "test")
+	injectedName := vclustersdktranslate.PhysicalName("someinjectedconfigmap", "test")
+
+	container := newContainer("somecontainer", pName)
+	container.Env = append([]corev1.EnvVar{{Name: "injected", Value: "somevalue"}}, container.Env...)
+
+	pod = newMetricsTestPod(nil)
+	pod.Spec.Containers = []corev1.Container{newContainer("injected-proxy", injectedName), container}
+	pod.Spec.Volumes = []corev1.Volume{
+		newVolume("kube-api-access-abcde", injectedName),
+		newVolume("somevolume", pName),
+	}
+
+	return pod, vPod
+}
+
+func TestPreferParentConfigmapsResolveVirtualNameInjected(t *testing.T) {
+	longConfigMap := someconfigmap.DeepCopy()
+	longConfigMap.Name = longConfigMapName
+
+	pName := vclustersdktranslate.PhysicalName(longConfigMapName, "test")
+	injectedName := vclustersdktranslate.PhysicalName("someinjectedconfigmap", "test")
+
+	renamedVPod := func() *corev1.Pod {
+		_, vPod := newInjectedTestPods()
+		vPod.Spec.Containers[0].Name = "someothercontainer"
+		vPod.Spec.Volumes[0].Name = "someothervolume"
+
+		return vPod
+	}()
+
+	cases := map[string]struct {
+		description string
+		vClientObjs []runtime.Object
+		expected    []string
+	}{
+		"injected": {
+			description: "validate that references are matched by container, environment variable " +
+				"and volume name when resolving names from a virtual pod that is not index aligned",
+			vClientObjs: []runtime.Object{func() *corev1.Pod {
+				_, vPod := newInjectedTestPods()
+
+				return vPod
+			}()},
+			expected: []string{
+				injectedName,
+				longConfigMapName,
+				injectedName,
+				longConfigMapName,
+			},
+		},
+		"renamed": {
+			description: "validate that references of containers and volumes the virtual pod does " +
+				"not have are not resolved",
+			vClientObjs: []runtime.Object{renamedVPod},
+			expected:    []string{injectedName, pName, injectedName, pName},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, longConfigMap)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.vClientObjs...)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentConfigmapsHook(ctx)
+
+			pod, _ := newInjectedTestPods()
+
+			res, err := h.MutateCreatePhysical(context.Background(), pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec := res.(*corev1.Pod).Spec
+
+			actual := []string{
+				spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name,
+				spec.Containers[1].Env[1].ValueFrom.ConfigMapKeyRef.Name,
+				spec.Volumes[0].ConfigMap.Name,
+				spec.Volumes[1].ConfigMap.Name,
+			}
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"%s: actual and expected names do not match\nactual: %s\nexpected:%s",
+					testName,
+					actual,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package hooks_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// typeRecordingClient records the types of objects passed to Get.
+type typeRecordingClient struct {
+	ctrlruntimeclient.Client
+
+	lock  sync.Mutex
+	types []string
+}
+
+func (c *typeRecordingClient) Get(
+	ctx context.Context,
+	key ctrlruntimeclient.ObjectKey,
+	obj ctrlruntimeclient.Object,
+) error {
+	c.lock.Lock()
+
+	switch obj.(type) {
+	case *metav1.PartialObjectMetadata:
+		c.types = append(c.types, "metadata")
+	default:
+		c.types = append(c.types, "full")
+	}
+
+	c.lock.Unlock()
+
+	return c.Client.Get(ctx, key, obj)
+}
+
+// typeRecordingManager is a manager that records the types of objects read through its (cached)
+// client and its (direct) api reader separately.
+type typeRecordingManager struct {
+	ctrlruntime.Manager
+
+	client *typeRecordingClient
+	reader *typeRecordingClient
+}
+
+func (m *typeRecordingManager) GetClient() ctrlruntimeclient.Client {
+	return m.client
+}
+
+func (m *typeRecordingManager) GetAPIReader() ctrlruntimeclient.Reader {
+	return m.reader
+}
+
+func TestPreferParentConfigmapsMetadataLookups(t *testing.T) {
+	cases := map[string]struct {
+		description    string
+		mutateObj      *corev1.Pod
+		expected       string
+		expectedClient []string
+		expectedReader []string
+	}{
+		"volume-exists": {
+			description: "validate that volumes without items only read parent metadata from " +
+				"the cache",
+			mutateObj:      newMetricsTestPod(nil),
+			expected:       "someconfigmap",
+			expectedClient: []string{"metadata"},
+		},
+		"volume-items-exist": {
+			description: "validate that volumes with items only read parent metadata from the " +
+				"cache, the keys of parent objects are not validated",
+			mutateObj: func() *corev1.Pod {
+				pod := newMetricsTestPod(nil)
+				pod.Spec.Volumes[0].ConfigMap.Items = []corev1.KeyToPath{
+					{Key: "somekey", Path: "somepath"},
+				}
+
+				return pod
+			}(),
+			expected:       "someconfigmap",
+			expectedClient: []string{"metadata"},
+		},
+		"volume-not-found": {
+			description: "validate that parent objects that do not exist are never fetched in " +
+				"full",
+			mutateObj: func() *corev1.Pod {
+				pod := newMetricsTestPod(nil)
+				pod.Spec.Volumes[0].ConfigMap.Name = "someconfigmapnotreal-x-test-x-suffix"
+				pod.Spec.Volumes[0].ConfigMap.Items = []corev1.KeyToPath{
+					{Key: "somekey", Path: "somepath"},
+				}
+
+				return pod
+			}(),
+			expected:       "someconfigmapnotreal-x-test-x-suffix",
+			expectedClient: []string{"metadata"},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			vPod := somepodWithConfigmapVolume.DeepCopy()
+			vPod.Spec.Volumes[0].ConfigMap.Name = strings.TrimSuffix(
+				testCase.mutateObj.Spec.Volumes[0].ConfigMap.Name,
+				"-x-test-x-suffix",
+			)
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, vPod)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			m := &typeRecordingManager{
+				Manager: ctx.PhysicalManager,
+				client:  &typeRecordingClient{Client: pClient},
+				reader:  &typeRecordingClient{Client: pClient},
+			}
+			ctx.PhysicalManager = m
+
+			h := hooks.NewPreferParentConfigmapsHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), testCase.mutateObj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := res.(*corev1.Pod).Spec.Volumes[0].ConfigMap.Name
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+
+			if !cmp.Equal(m.client.types, testCase.expectedClient) {
+				t.Fatalf("got client reads %v, want %v", m.client.types, testCase.expectedClient)
+			}
+
+			if !cmp.Equal(m.reader.types, testCase.expectedReader) {
+				t.Fatalf("got reader reads %v, want %v", m.reader.types, testCase.expectedReader)
+			}
+		})
+	}
+}
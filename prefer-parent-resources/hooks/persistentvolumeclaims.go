@@ -0,0 +1,26 @@
+package hooks
+
+import (
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdklog "github.com/loft-sh/vcluster-sdk/log"
+)
+
+const (
+	forceReadOnlyEnvSetting = "FORCE_READ_ONLY"
+)
+
+// persistentVolumeClaimKind returns the mutator.PersistentVolumeClaimKind substituted by the
+// hooks. Setting "PREFER_PARENT_PERSISTENTVOLUMECLAIMS_HOOK_FORCE_READ_ONLY" to "true" mounts
+// every substituted claim read only.
+func persistentVolumeClaimKind() mutator.PersistentVolumeClaimKind {
+	name := mutator.PersistentVolumeClaimsHookName
+
+	return mutator.PersistentVolumeClaimKind{
+		ForceReadOnly: getBoolEnv(
+			vclustersdklog.New(name),
+			hookEnvKey(name, forceReadOnlyEnvSetting),
+			false,
+		),
+	}
+}
@@ -0,0 +1,127 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newSomePersistentVolumeClaim(
+	accessModes ...corev1.PersistentVolumeAccessMode,
+) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "someclaim",
+			Namespace: "test",
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+		},
+	}
+}
+
+func newPersistentVolumeClaimTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "somepod",
+			Namespace: "test",
+			Annotations: map[string]string{
+				vclustersdksyncertranslator.NameAnnotation:      "somepod",
+				vclustersdksyncertranslator.NamespaceAnnotation: "test",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{
+				Name: "somevolume",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: "someclaim-x-test-x-suffix",
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestPreferParentPersistentVolumeClaims(t *testing.T) {
+	cases := map[string]struct {
+		description      string
+		forceReadOnly    string
+		pClientObjs      []runtime.Object
+		expected         string
+		expectedReadOnly bool
+	}{
+		"read-write-many": {
+			description: "validate that shareable claims are substituted",
+			pClientObjs: []runtime.Object{newSomePersistentVolumeClaim(corev1.ReadWriteMany)},
+			expected:    "someclaim",
+		},
+		"read-write-once": {
+			description: "validate that claims that cannot be shared are not substituted",
+			pClientObjs: []runtime.Object{newSomePersistentVolumeClaim(corev1.ReadWriteOnce)},
+			expected:    "someclaim-x-test-x-suffix",
+		},
+		"not-found": {
+			description: "validate that claims missing from the parent are not substituted",
+			expected:    "someclaim-x-test-x-suffix",
+		},
+		"force-read-only": {
+			description:   "validate that substituted claims are mounted read only if forced",
+			forceReadOnly: "true",
+			pClientObjs: []runtime.Object{
+				newSomePersistentVolumeClaim(corev1.ReadWriteOnce, corev1.ReadOnlyMany),
+			},
+			expected:         "someclaim",
+			expectedReadOnly: true,
+		},
+		"force-read-only-not-substituted": {
+			description:   "validate that claims that are not substituted are left writable",
+			forceReadOnly: "true",
+			expected:      "someclaim-x-test-x-suffix",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv(
+				"PREFER_PARENT_PERSISTENTVOLUMECLAIMS_HOOK_FORCE_READ_ONLY",
+				testCase.forceReadOnly,
+			)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			res, err := h.MutateCreatePhysical(
+				context.Background(),
+				newPersistentVolumeClaimTestPod(),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claim := res.(*corev1.Pod).Spec.Volumes[0].PersistentVolumeClaim
+
+			if claim.ClaimName != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", claim.ClaimName, testCase.expected)
+			}
+
+			if claim.ReadOnly != testCase.expectedReadOnly {
+				t.Fatalf("got read only '%t', want '%t'", claim.ReadOnly, testCase.expectedReadOnly)
+			}
+		})
+	}
+}
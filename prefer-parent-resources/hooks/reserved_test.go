@@ -0,0 +1,141 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// newReservedTestPod returns a physical pod mounting the translated configmap configMapName and
+// secret secretName as volumes.
+func newReservedTestPod(configMapName, secretName string) *corev1.Pod {
+	pod := newMetricsTestPod(nil)
+
+	pod.Spec.Volumes[0].ConfigMap.Name = configMapName + "-x-test-x-suffix"
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "somesecretvolume",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secretName + "-x-test-x-suffix",
+			},
+		},
+	})
+
+	return pod
+}
+
+// newReservedTestSecret returns a parent secret of the given type, with the metadata the API
+// server (service account tokens) or helm (releases) sets on secrets of such types.
+func newReservedTestSecret(name string, secretType corev1.SecretType) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "test",
+		},
+		Type: secretType,
+	}
+
+	switch secretType {
+	case corev1.SecretTypeServiceAccountToken:
+		secret.Annotations = map[string]string{corev1.ServiceAccountNameKey: "default"}
+	case mutator.SecretTypeHelmRelease:
+		secret.Labels = map[string]string{"owner": "helm", "name": "somerelease"}
+	}
+
+	return secret
+}
+
+func TestReservedParents(t *testing.T) {
+	kubeRootCA := someconfigmap.DeepCopy()
+	kubeRootCA.Name = "kube-root-ca.crt"
+
+	cases := map[string]struct {
+		description string
+		reservedEnv string
+		pClientObjs []runtime.Object
+		mutateObj   *corev1.Pod
+		expected    []string
+	}{
+		"not-reserved": {
+			description: "validate that objects that are not reserved are substituted",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newReservedTestSecret("somesecret", corev1.SecretTypeOpaque),
+			},
+			mutateObj: newReservedTestPod("someconfigmap", "somesecret"),
+			expected:  []string{"someconfigmap", "somesecret"},
+		},
+		"kube-root-ca": {
+			description: "validate that the kube-root-ca.crt configmap is never substituted",
+			pClientObjs: []runtime.Object{kubeRootCA},
+			mutateObj:   newReservedTestPod("kube-root-ca.crt", "somesecret"),
+			expected:    []string{"kube-root-ca.crt-x-test-x-suffix", "somesecret-x-test-x-suffix"},
+		},
+		"service-account-token": {
+			description: "validate that service account token secrets are never substituted",
+			pClientObjs: []runtime.Object{
+				newReservedTestSecret("somesecret", corev1.SecretTypeServiceAccountToken),
+			},
+			mutateObj: newReservedTestPod("someconfigmap", "somesecret"),
+			expected:  []string{"someconfigmap-x-test-x-suffix", "somesecret-x-test-x-suffix"},
+		},
+		"helm-release": {
+			description: "validate that helm release secrets are never substituted",
+			pClientObjs: []runtime.Object{
+				newReservedTestSecret("somesecret", mutator.SecretTypeHelmRelease),
+			},
+			mutateObj: newReservedTestPod("someconfigmap", "somesecret"),
+			expected:  []string{"someconfigmap-x-test-x-suffix", "somesecret-x-test-x-suffix"},
+		},
+		"reserved-env": {
+			description: "validate that names reserved by environment variable are not substituted",
+			reservedEnv: "someotherconfigmap,someconfigmap",
+			pClientObjs: []runtime.Object{
+				someconfigmap,
+				newReservedTestSecret("somesecret", corev1.SecretTypeOpaque),
+			},
+			mutateObj: newReservedTestPod("someconfigmap", "somesecret"),
+			expected:  []string{"someconfigmap-x-test-x-suffix", "somesecret"},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv(hooks.ReservedNamesEnv, testCase.reservedEnv)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, testCase.pClientObjs...)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), testCase.mutateObj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resPod := res.(*corev1.Pod)
+
+			actual := []string{
+				resPod.Spec.Volumes[0].ConfigMap.Name,
+				resPod.Spec.Volumes[1].Secret.SecretName,
+			}
+
+			if actual[0] != testCase.expected[0] || actual[1] != testCase.expected[1] {
+				t.Fatalf("got '%v', want '%v'", actual, testCase.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package hooks
+
+import (
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+)
+
+const (
+	preferResourcesHookName = "prefer-parent-resources-hook"
+)
+
+// NewPreferParentResourcesHook returns a PreferParentResourcesHook hook.ClientHook.
+func NewPreferParentResourcesHook(
+	ctx *vclustersdksyncercontext.RegisterContext,
+	options ...Option,
+) EnvVolMutatingHook {
+	return newEnvVolMutatingHook(
+		ctx,
+		preferResourcesHookName,
+		options,
+		configuredKinds()...,
+	)
+}
+
+// configuredKinds returns the registered kinds, the persistentvolumeclaim and serviceaccount kinds
+// are configured by their environment variables.
+func configuredKinds() []mutator.ReferenceableKind {
+	kinds := mutator.RegisteredKinds()
+
+	for i, kind := range kinds {
+		switch kind.(type) {
+		case mutator.PersistentVolumeClaimKind:
+			kinds[i] = persistentVolumeClaimKind()
+		case mutator.ServiceAccountKind:
+			kinds[i] = serviceAccountKind()
+		}
+	}
+
+	return kinds
+}
+
+// PreferParentResourcesHook is a hook.ClientHook implementation that prefers configmaps, secrets,
+// persistentvolumeclaims, serviceaccounts and any other registered ReferenceableKind from the
+// physical/parent cluster over those created by/from the vcluster itself. Unlike the per-kind
+// hooks, the pod spec is walked once, every reference is collected in to a single resolution plan,
+// each distinct parent object is looked up once, and the plan is only applied if every lookup
+// succeeded (or was allowed to fail by the failure policy).
+//
+// Each kind can be disabled with the enabled setting of the per-kind hook, for example setting
+// "PREFER_PARENT_SECRETS_HOOK_ENABLED" to "false" leaves secret references untouched. The per-kind
+// skip and dry run annotations are honored as well.
+type PreferParentResourcesHook struct {
+	EnvVolMutatingHook
+}
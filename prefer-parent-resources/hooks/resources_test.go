@@ -0,0 +1,200 @@
+package hooks_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// newResourcesTestPod returns a physical pod referencing the configmap "someconfigmap" and the
+// secret "somesecret" both as an environment variable and as a volume.
+func newResourcesTestPod() *corev1.Pod {
+	pod := newDryRunTestPod(nil)
+
+	pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+		Name: "env-from-real-secret",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: "somesecret-x-test-x-suffix",
+				},
+				Key:      "somekey",
+				Optional: falsePtr(),
+			},
+		},
+	})
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: "somesecretvolume",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "somesecret-x-test-x-suffix",
+			},
+		},
+	})
+
+	return pod
+}
+
+// resourcesTestNames returns the configmap env, configmap volume, secret env and secret volume
+// names referenced by a pod returned by newResourcesTestPod.
+func resourcesTestNames(pod *corev1.Pod) []string {
+	return []string{
+		pod.Spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name,
+		pod.Spec.Volumes[0].ConfigMap.Name,
+		pod.Spec.Containers[0].Env[1].ValueFrom.SecretKeyRef.Name,
+		pod.Spec.Volumes[1].Secret.SecretName,
+	}
+}
+
+func TestPreferParentResources(t *testing.T) {
+	cases := map[string]struct {
+		description    string
+		env            map[string]string
+		podAnnotations map[string]string
+		expected       []string
+	}{
+		"all-kinds": {
+			description: "validate that configmap and secret references are substituted",
+			expected:    []string{"someconfigmap", "someconfigmap", "somesecret", "somesecret"},
+		},
+		"secrets-disabled": {
+			description: "validate that disabled kinds are left unchanged",
+			env:         map[string]string{"PREFER_PARENT_SECRETS_HOOK_ENABLED": "false"},
+			expected: []string{
+				"someconfigmap",
+				"someconfigmap",
+				"somesecret-x-test-x-suffix",
+				"somesecret-x-test-x-suffix",
+			},
+		},
+		"configmaps-skipped": {
+			description:    "validate that the per kind skip annotation is honored",
+			podAnnotations: map[string]string{mutator.SkipPreferConfigMapsHook: "1"},
+			expected: []string{
+				"someconfigmap-x-test-x-suffix",
+				"someconfigmap-x-test-x-suffix",
+				"somesecret",
+				"somesecret",
+			},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			for k, v := range testCase.env {
+				t.Setenv(k, v)
+			}
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap, somesecret)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			mutateObj := newResourcesTestPod()
+			for k, v := range testCase.podAnnotations {
+				mutateObj.Annotations[k] = v
+			}
+
+			res, err := h.MutateCreatePhysical(context.Background(), mutateObj)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := resourcesTestNames(res.(*corev1.Pod))
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"actual and expected names do not match\n%s",
+					cmp.Diff(actual, testCase.expected),
+				)
+			}
+		})
+	}
+}
+
+func TestPreferParentResourcesDistinctLookups(t *testing.T) {
+	scheme := newScheme()
+
+	pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap, somesecret)
+	vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+	ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+	m := &typeRecordingManager{
+		Manager: ctx.PhysicalManager,
+		client:  &typeRecordingClient{Client: pClient},
+		reader:  &typeRecordingClient{Client: pClient},
+	}
+	ctx.PhysicalManager = m
+
+	h := hooks.NewPreferParentResourcesHook(ctx)
+
+	_, err := h.MutateCreatePhysical(context.Background(), newResourcesTestPod())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each parent object is referenced twice, but only looked up once, and never read in full
+	expectedClient := []string{"metadata", "metadata"}
+
+	var expectedReader []string
+
+	if !cmp.Equal(m.client.types, expectedClient) {
+		t.Fatalf("got client reads %v, want %v", m.client.types, expectedClient)
+	}
+
+	if !cmp.Equal(m.reader.types, expectedReader) {
+		t.Fatalf("got reader reads %v, want %v", m.reader.types, expectedReader)
+	}
+}
+
+func TestPreferParentResourcesAtomic(t *testing.T) {
+	t.Setenv("PREFER_PARENT_RESOURCES_HOOK_FAILURE_POLICY", "fail-closed")
+
+	scheme := newScheme()
+
+	pClient := vclustersdksyncertesting.NewFakeClient(scheme, someconfigmap, somesecret)
+	vClient := vclustersdksyncertesting.NewFakeClient(scheme)
+
+	ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+	h := hooks.NewPreferParentResourcesHook(ctx)
+
+	// the secret volume name cannot be reverse translated and the virtual pod does not exist, so
+	// resolving it rejects the pod after the configmap references have already been resolved
+	mutateObj := newResourcesTestPod()
+	mutateObj.Spec.Volumes[1].Secret.SecretName = vclustersdktranslate.PhysicalName(
+		longConfigMapName,
+		"test",
+	)
+
+	expected := resourcesTestNames(mutateObj)
+
+	_, err := h.MutateCreatePhysical(context.Background(), mutateObj)
+	if !errors.Is(err, mutator.ErrCantGetResource) {
+		t.Fatalf("got error '%v', want '%v'", err, mutator.ErrCantGetResource)
+	}
+
+	actual := resourcesTestNames(mutateObj)
+
+	if !cmp.Equal(actual, expected) {
+		t.Fatalf(
+			"pod was partially mutated, actual and expected names do not match\n%s",
+			cmp.Diff(actual, expected),
+		)
+	}
+}
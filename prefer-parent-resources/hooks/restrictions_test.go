@@ -0,0 +1,103 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParentConsumerRestrictions(t *testing.T) {
+	cases := map[string]struct {
+		description       string
+		parentAnnotations map[string]string
+		podLabels         map[string]string
+		expected          string
+	}{
+		"unrestricted": {
+			description: "validate that parent objects without restrictions are substituted",
+			expected:    "someconfigmap",
+		},
+		"allowed-namespace": {
+			description: "validate that parent objects are substituted for allowed namespaces",
+			parentAnnotations: map[string]string{
+				mutator.AllowedNamespacesAnnotation: "team-a, test",
+			},
+			expected: "someconfigmap",
+		},
+		"other-namespace": {
+			description: "validate that parent objects are not substituted for other namespaces",
+			parentAnnotations: map[string]string{
+				mutator.AllowedNamespacesAnnotation: "team-a,team-b",
+			},
+			expected: "someconfigmap-x-test-x-suffix",
+		},
+		"selected": {
+			description: "validate that parent objects are substituted for selected pods",
+			parentAnnotations: map[string]string{
+				mutator.AllowedNamespacesAnnotation: "test",
+				mutator.AllowedSelectorAnnotation:   "app in (someapp,someotherapp)",
+			},
+			podLabels: map[string]string{"app": "someapp"},
+			expected:  "someconfigmap",
+		},
+		"not-selected": {
+			description: "validate that parent objects are not substituted for other pods",
+			parentAnnotations: map[string]string{
+				mutator.AllowedSelectorAnnotation: "app=someotherapp",
+			},
+			podLabels: map[string]string{"app": "someapp"},
+			expected:  "someconfigmap-x-test-x-suffix",
+		},
+		"excluded": {
+			description: "validate that parent objects are not substituted for excluded pods",
+			parentAnnotations: map[string]string{
+				mutator.AllowedSelectorAnnotation: "!app",
+			},
+			podLabels: map[string]string{"app": "someapp"},
+			expected:  "someconfigmap-x-test-x-suffix",
+		},
+		"invalid-selector": {
+			description: "validate that parent objects with an invalid selector are not substituted",
+			parentAnnotations: map[string]string{
+				mutator.AllowedSelectorAnnotation: "app in someapp",
+			},
+			podLabels: map[string]string{"app": "someapp"},
+			expected:  "someconfigmap-x-test-x-suffix",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			parent := someconfigmap.DeepCopy()
+			parent.Annotations = testCase.parentAnnotations
+
+			scheme := newScheme()
+
+			pod, vPod := newLabelledTestPods(testCase.podLabels)
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, parent)
+			vClient := vclustersdksyncertesting.NewFakeClient(scheme, vPod)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			actual := res.(*corev1.Pod).Spec.Volumes[0].ConfigMap.Name
+
+			if actual != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", actual, testCase.expected)
+			}
+		})
+	}
+}
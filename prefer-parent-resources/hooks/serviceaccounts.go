@@ -0,0 +1,24 @@
+package hooks
+
+import (
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+)
+
+const (
+	allowedEnvSetting        = "ALLOWED"
+	tokenAudiencesEnvSetting = "TOKEN_AUDIENCES"
+)
+
+// serviceAccountKind returns the mutator.ServiceAccountKind substituted by the hooks. Only the
+// parent serviceaccounts listed (comma separated) in "PREFER_PARENT_SERVICEACCOUNTS_HOOK_ALLOWED"
+// are substituted. The audiences listed in "PREFER_PARENT_SERVICEACCOUNTS_HOOK_TOKEN_AUDIENCES"
+// are the audiences of projected service account tokens that are issued for the parent
+// serviceaccount.
+func serviceAccountKind() mutator.ServiceAccountKind {
+	name := mutator.ServiceAccountsHookName
+
+	return mutator.ServiceAccountKind{
+		Allowed:        getListEnv(hookEnvKey(name, allowedEnvSetting)),
+		TokenAudiences: getListEnv(hookEnvKey(name, tokenAudiencesEnvSetting)),
+	}
+}
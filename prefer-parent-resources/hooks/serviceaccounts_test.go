@@ -0,0 +1,207 @@
+package hooks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/google/go-cmp/cmp"
+	vclustersdksyncertesting "github.com/loft-sh/vcluster-sdk/syncer/testing"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var someserviceaccount = &corev1.ServiceAccount{
+	ObjectMeta: metav1.ObjectMeta{
+		Name:      "someserviceaccount",
+		Namespace: "test",
+	},
+}
+
+// newServiceAccountTestPod returns a physical pod running as the translated serviceaccount
+// "someserviceaccount", with a projected token volume that vcluster replaced with a secret.
+func newServiceAccountTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "somepod",
+			Namespace: "test",
+			Annotations: map[string]string{
+				vclustersdksyncertranslator.NameAnnotation:      "somepod",
+				vclustersdksyncertranslator.NamespaceAnnotation: "test",
+			},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "someserviceaccount-x-test-x-suffix",
+			Volumes: []corev1.Volume{{
+				Name: "aws-iam-token",
+				VolumeSource: corev1.VolumeSource{
+					Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{{
+							Secret: &corev1.SecretProjection{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "somepod-sa-token",
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func newServiceAccountTestVirtualPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "somepod",
+			Namespace: "test",
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName: "someserviceaccount",
+			Volumes: []corev1.Volume{{
+				Name: "aws-iam-token",
+				VolumeSource: corev1.VolumeSource{
+					Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{{
+							ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+								Audience: "sts.amazonaws.com",
+								Path:     "token",
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestPreferParentServiceAccounts(t *testing.T) {
+	substitutedSource := newServiceAccountTestVirtualPod().Spec.Volumes[0].Projected.Sources[0]
+	vclusterSource := newServiceAccountTestPod().Spec.Volumes[0].Projected.Sources[0]
+
+	cases := map[string]struct {
+		description    string
+		allowed        string
+		audiences      string
+		expected       string
+		expectedSource corev1.VolumeProjection
+	}{
+		"allowed": {
+			description:    "validate that allowed serviceaccounts are substituted",
+			allowed:        "someotherserviceaccount,someserviceaccount",
+			audiences:      "sts.amazonaws.com",
+			expected:       "someserviceaccount",
+			expectedSource: substitutedSource,
+		},
+		"not-allowed": {
+			description:    "validate that serviceaccounts missing from the allow list are not substituted",
+			allowed:        "someotherserviceaccount",
+			audiences:      "sts.amazonaws.com",
+			expected:       "someserviceaccount-x-test-x-suffix",
+			expectedSource: vclusterSource,
+		},
+		"other-audience": {
+			description: "validate that tokens for other audiences are left to vcluster",
+			allowed:     "someserviceaccount",
+			audiences:   "api://AzureADTokenExchange",
+			expected:    "someserviceaccount",
+			// the vcluster issued token is kept
+			expectedSource: vclusterSource,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			t.Setenv("PREFER_PARENT_SERVICEACCOUNTS_HOOK_ALLOWED", testCase.allowed)
+			t.Setenv("PREFER_PARENT_SERVICEACCOUNTS_HOOK_TOKEN_AUDIENCES", testCase.audiences)
+
+			scheme := newScheme()
+
+			pClient := vclustersdksyncertesting.NewFakeClient(scheme, someserviceaccount)
+			vClient := vclustersdksyncertesting.NewFakeClient(
+				scheme,
+				newServiceAccountTestVirtualPod(),
+			)
+
+			ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+			h := hooks.NewPreferParentResourcesHook(ctx)
+
+			res, err := h.MutateCreatePhysical(context.Background(), newServiceAccountTestPod())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resPod := res.(*corev1.Pod)
+
+			if resPod.Spec.ServiceAccountName != testCase.expected {
+				t.Fatalf("got '%s', want '%s'", resPod.Spec.ServiceAccountName, testCase.expected)
+			}
+
+			actualSource := resPod.Spec.Volumes[0].Projected.Sources[0]
+
+			if !cmp.Equal(actualSource, testCase.expectedSource) {
+				t.Fatalf(
+					"actual and expected token sources do not match\n%s",
+					cmp.Diff(actualSource, testCase.expectedSource),
+				)
+			}
+		})
+	}
+}
+
+func TestPreferParentServiceAccountsSinglePlan(t *testing.T) {
+	t.Setenv("PREFER_PARENT_SERVICEACCOUNTS_HOOK_ALLOWED", "someserviceaccount")
+	t.Setenv("PREFER_PARENT_SERVICEACCOUNTS_HOOK_TOKEN_AUDIENCES", "sts.amazonaws.com")
+
+	scheme := newScheme()
+
+	pClient := vclustersdksyncertesting.NewFakeClient(
+		scheme,
+		someserviceaccount,
+		newSomePersistentVolumeClaim(corev1.ReadOnlyMany),
+	)
+	vClient := vclustersdksyncertesting.NewFakeClient(scheme, newServiceAccountTestVirtualPod())
+
+	ctx := vclustersdksyncertesting.NewFakeRegisterContext(pClient, vClient)
+
+	m := &typeRecordingManager{
+		Manager: ctx.VirtualManager,
+		client:  &typeRecordingClient{Client: vClient},
+		reader:  &typeRecordingClient{Client: vClient},
+	}
+	ctx.VirtualManager = m
+
+	h := hooks.NewPreferParentResourcesHook(ctx)
+
+	mutateObj := newServiceAccountTestPod()
+	mutateObj.Spec.Volumes = append(
+		mutateObj.Spec.Volumes,
+		newPersistentVolumeClaimTestPod().Spec.Volumes...,
+	)
+
+	res, err := h.MutateCreatePhysical(context.Background(), mutateObj)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resPod := res.(*corev1.Pod)
+
+	if resPod.Spec.ServiceAccountName != "someserviceaccount" {
+		t.Fatalf("got '%s', want 'someserviceaccount'", resPod.Spec.ServiceAccountName)
+	}
+
+	if claimName := resPod.Spec.Volumes[1].PersistentVolumeClaim.ClaimName; claimName != "someclaim" {
+		t.Fatalf("got '%s', want 'someclaim'", claimName)
+	}
+
+	// the serviceaccount, claim and token are resolved in one plan, fetching the virtual pod once
+	expectedClient := []string{"full"}
+
+	if !cmp.Equal(m.client.types, expectedClient) {
+		t.Fatalf("got virtual client reads %v, want %v", m.client.types, expectedClient)
+	}
+}
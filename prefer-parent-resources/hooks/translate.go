@@ -0,0 +1,62 @@
+package hooks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+)
+
+// Option modifies the mutator.Options of a hook once they are read from the environment.
+type Option func(opts *mutator.Options)
+
+// WithVClusterName translates names and label keys as the vcluster vClusterName does, rather than
+// as the vcluster the plugin runs in, for example to explain the hooks offline.
+func WithVClusterName(vClusterName string) Option {
+	return func(opts *mutator.Options) {
+		opts.PhysicalName = PhysicalNameFor(vClusterName)
+		opts.PhysicalLabelKey = PhysicalLabelKeyFor(vClusterName)
+	}
+}
+
+// PhysicalNameFor returns the mutator.PhysicalNameFunc translating names as the vcluster
+// vClusterName does. For the vcluster the plugin runs in this is the vcluster SDK
+// translate.PhysicalName, names of other vclusters are concatenated the same way with the SDK
+// translate.SafeConcatName.
+func PhysicalNameFor(vClusterName string) mutator.PhysicalNameFunc {
+	if vClusterName == vclustersdktranslate.Suffix {
+		return vclustersdktranslate.PhysicalName
+	}
+
+	return func(name, namespace string) string {
+		if name == "" {
+			return ""
+		}
+
+		return vclustersdktranslate.SafeConcatName(name, "x", namespace, "x", vClusterName)
+	}
+}
+
+// PhysicalLabelKeyFor returns the mutator.PhysicalLabelKeyFunc translating label keys as the
+// vcluster vClusterName does. For the vcluster the plugin runs in this is the vcluster SDK
+// translator.ConvertLabelKey. The SDK helpers always translate with the name of the vcluster the
+// plugin runs in, so the label keys of other vclusters are hashed the same way here.
+func PhysicalLabelKeyFor(vClusterName string) mutator.PhysicalLabelKeyFunc {
+	if vClusterName == vclustersdktranslate.Suffix {
+		return vclustersdksyncertranslator.ConvertLabelKey
+	}
+
+	return func(key string) string {
+		digest := sha256.Sum256([]byte(key))
+
+		return vclustersdktranslate.SafeConcatName(
+			vclustersdksyncertranslator.LabelPrefix,
+			vClusterName,
+			"x",
+			hex.EncodeToString(digest[:])[0:10],
+		)
+	}
+}
@@ -0,0 +1,86 @@
+package hooks_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	vclustersdksyncertranslator "github.com/loft-sh/vcluster-sdk/syncer/translator"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+)
+
+func TestPhysicalNameFor(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		name        string
+		namespace   string
+	}{
+		"short": {
+			description: "validate that short names are translated as the sdk does",
+			name:        "someconfigmap",
+			namespace:   "test",
+		},
+		"long": {
+			description: "validate that names that have to be hashed are translated as the sdk does",
+			name:        "some" + strings.Repeat("verylong", 7) + "configmap",
+			namespace:   "test",
+		},
+		"empty": {
+			description: "validate that empty names are translated as the sdk does",
+			namespace:   "test",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			for _, vClusterName := range []string{vclustersdktranslate.Suffix, "someothervcluster"} {
+				expected := withSuffix(t, vClusterName, func() string {
+					return vclustersdktranslate.PhysicalName(testCase.name, testCase.namespace)
+				})
+
+				actual := hooks.PhysicalNameFor(vClusterName)(testCase.name, testCase.namespace)
+				if actual != expected {
+					t.Fatalf("vcluster '%s': got '%s', want '%s'", vClusterName, actual, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestPhysicalLabelKeyFor(t *testing.T) {
+	for _, vClusterName := range []string{vclustersdktranslate.Suffix, "someothervcluster"} {
+		for _, key := range []string{"app", "app.kubernetes.io/name"} {
+			expected := withSuffix(t, vClusterName, func() string {
+				return vclustersdksyncertranslator.ConvertLabelKey(key)
+			})
+
+			actual := hooks.PhysicalLabelKeyFor(vClusterName)(key)
+			if actual != expected {
+				t.Fatalf(
+					"vcluster '%s' key '%s': got '%s', want '%s'",
+					vClusterName,
+					key,
+					actual,
+					expected,
+				)
+			}
+		}
+	}
+}
+
+// withSuffix returns the result of f while the vcluster SDK translates for the vcluster
+// vClusterName, as it does within the plugin running in that vcluster.
+func withSuffix(t *testing.T, vClusterName string, f func() string) string {
+	t.Helper()
+
+	suffix := vclustersdktranslate.Suffix
+	vclustersdktranslate.Suffix = vClusterName
+
+	defer func() {
+		vclustersdktranslate.Suffix = suffix
+	}()
+
+	return f()
+}
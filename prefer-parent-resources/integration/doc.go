@@ -0,0 +1,6 @@
+// Package integration holds the integration suite of the hooks. The suite starts a "host" and a
+// "virtual" control plane (etcd and kube-apiserver) with controller-runtime envtest, and drives
+// the hooks through real managers connected to them. The control plane binaries are not
+// downloaded by the suite, the tests are skipped unless KUBEBUILDER_ASSETS points at a directory
+// holding them.
+package integration
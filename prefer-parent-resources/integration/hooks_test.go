@@ -0,0 +1,307 @@
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"github.com/google/go-cmp/cmp"
+	vclustersdkhook "github.com/loft-sh/vcluster-sdk/hook"
+	vclustersdksyncer "github.com/loft-sh/vcluster-sdk/syncer"
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const (
+	virtualNamespace = "default"
+
+	// forbiddenLookupTimeout bounds the hook call of the forbidden case, reads through the cache of
+	// a manager that may not list the objects block until the context is done.
+	forbiddenLookupTimeout = 5 * time.Second
+)
+
+func newPod(name, configMapName, secretName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: virtualNamespace,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "somecontainer",
+					Image: "someimage",
+					Env: []corev1.EnvVar{
+						{
+							Name: "someenv",
+							ValueFrom: &corev1.EnvVarSource{
+								ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: configMapName,
+									},
+									Key: "somekey",
+								},
+							},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "somevolume",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{SecretName: secretName},
+					},
+				},
+			},
+		},
+	}
+}
+
+// newPhysicalPod returns the physical pod the syncer would create in the host namespace for the
+// virtual pod vPod.
+func newPhysicalPod(vPod *corev1.Pod) *corev1.Pod {
+	pod := vPod.DeepCopy()
+
+	pod.ObjectMeta = metav1.ObjectMeta{
+		Name:      vclustersdktranslate.PhysicalName(vPod.Name, vPod.Namespace),
+		Namespace: targetNamespace,
+		Annotations: map[string]string{
+			mutator.VirtualNameAnnotation:      vPod.Name,
+			mutator.VirtualNamespaceAnnotation: vPod.Namespace,
+		},
+	}
+
+	env := &pod.Spec.Containers[0].Env[0]
+	env.ValueFrom.ConfigMapKeyRef.Name = vclustersdktranslate.PhysicalName(
+		env.ValueFrom.ConfigMapKeyRef.Name,
+		vPod.Namespace,
+	)
+
+	volume := &pod.Spec.Volumes[0]
+	volume.Secret.SecretName = vclustersdktranslate.PhysicalName(
+		volume.Secret.SecretName,
+		vPod.Namespace,
+	)
+
+	return pod
+}
+
+// mutateCreatePhysical runs the MutateCreatePhysical method of hook on pod, bounded by the
+// forbiddenLookupTimeout.
+func mutateCreatePhysical(
+	t *testing.T,
+	hook vclustersdksyncer.Base,
+	pod *corev1.Pod,
+) (*corev1.Pod, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), forbiddenLookupTimeout)
+	defer cancel()
+
+	createHook, ok := hook.(vclustersdkhook.MutateCreatePhysical)
+	if !ok {
+		t.Fatal("hook does not implement MutateCreatePhysical")
+	}
+
+	obj, err := createHook.MutateCreatePhysical(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	mutated, ok := obj.(*corev1.Pod)
+	if !ok {
+		t.Fatal("hook did not return a pod")
+	}
+
+	return mutated, nil
+}
+
+func TestPreferParentResourcesHook(t *testing.T) {
+	cases := map[string]struct {
+		description   string
+		parentObjs    bool
+		virtualObjs   bool
+		forbidden     bool
+		expectedNames []string
+		expectedErr   error
+	}{
+		"substituted": {
+			description: "validate that references to parent objects are substituted, and that " +
+				"the api server accepts the mutated pod",
+			parentObjs:    true,
+			expectedNames: []string{"substituted-configmap", "substituted-secret"},
+		},
+		"shadowed": {
+			description: "validate that parent objects are preferred over existing virtual " +
+				"objects",
+			parentObjs:    true,
+			virtualObjs:   true,
+			expectedNames: []string{"shadowed-configmap", "shadowed-secret"},
+		},
+		"not-found": {
+			description: "validate that references without parent objects keep pointing at the " +
+				"virtual objects",
+			virtualObjs: true,
+			expectedNames: []string{
+				vclustersdktranslate.PhysicalName("not-found-configmap", virtualNamespace),
+				vclustersdktranslate.PhysicalName("not-found-secret", virtualNamespace),
+			},
+		},
+		"forbidden": {
+			description: "validate that parent lookups the host cluster rbac forbids reject the " +
+				"pod with the fail-closed failure policy",
+			parentObjs:  true,
+			forbidden:   true,
+			expectedErr: mutator.ErrCantGetResource,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			requireEnvironments(t)
+
+			t.Setenv("PREFER_PARENT_RESOURCES_HOOK_FAILURE_POLICY", "fail-closed")
+
+			hostClient := newClient(t, hostEnvironment.Config)
+			virtualClient := newClient(t, virtualEnvironment.Config)
+
+			configMapName := testName + "-configmap"
+			secretName := testName + "-secret"
+
+			if testCase.parentObjs {
+				createObjects(t, hostClient, targetNamespace, configMapName, secretName)
+			}
+
+			if testCase.virtualObjs {
+				createObjects(t, virtualClient, virtualNamespace, configMapName, secretName)
+			}
+
+			vPod := newPod(testName+"-pod", configMapName, secretName)
+
+			err := virtualClient.Create(context.Background(), vPod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config := hostEnvironment.Config
+			if testCase.forbidden {
+				config = newUnprivilegedConfig(t, hostEnvironment)
+			}
+
+			registerCtx := newRegisterContext(t, config)
+
+			// the hooks read the virtual pod and the parent object metadata through the manager
+			// caches, wait for the caches to see them like they would in a running vcluster
+			waitForObject(t, registerCtx.VirtualManager.GetClient(), vPod.DeepCopy())
+
+			if testCase.parentObjs && !testCase.forbidden {
+				waitForParentMetadata(t, registerCtx.PhysicalManager.GetClient(), configMapName)
+			}
+
+			pod, err := mutateCreatePhysical(
+				t,
+				hooks.NewPreferParentResourcesHook(registerCtx),
+				newPhysicalPod(vPod),
+			)
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf(
+						"%s: actual and expected errors do not match\nactual: %v\nexpected:%v",
+						testName,
+						err,
+						testCase.expectedErr,
+					)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%s: mutate failed, error: %s", testName, err)
+			}
+
+			actualNames := []string{
+				pod.Spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name,
+				pod.Spec.Volumes[0].Secret.SecretName,
+			}
+
+			if !cmp.Equal(actualNames, testCase.expectedNames) {
+				t.Fatalf(
+					"%s: actual and expected names do not match\nactual: %s\nexpected:%s",
+					testName,
+					actualNames,
+					testCase.expectedNames,
+				)
+			}
+
+			err = hostClient.Create(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("%s: api server rejected the mutated pod, error: %s", testName, err)
+			}
+		})
+	}
+}
+
+// createObjects creates a configmap and a secret, both holding "somekey", in the namespace.
+func createObjects(
+	t *testing.T,
+	c ctrlruntimeclient.Client,
+	namespace, configMapName, secretName string,
+) {
+	t.Helper()
+
+	objs := []ctrlruntimeclient.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: configMapName, Namespace: namespace},
+			Data:       map[string]string{"somekey": "somevalue"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace},
+			StringData: map[string]string{"somekey": "somevalue"},
+		},
+	}
+
+	for _, obj := range objs {
+		err := c.Create(context.Background(), obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitForParentMetadata waits until the metadata of the parent configmap name can be read with
+// reader.
+func waitForParentMetadata(t *testing.T, reader ctrlruntimeclient.Reader, name string) {
+	t.Helper()
+
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	obj.SetName(name)
+	obj.SetNamespace(targetNamespace)
+
+	waitForObject(t, reader, obj)
+}
+
+// newUnprivilegedConfig returns a config for a user of the control plane of environment that is
+// not bound to any role, so every read of the hooks is forbidden.
+func newUnprivilegedConfig(t *testing.T, environment *envtest.Environment) *rest.Config {
+	t.Helper()
+
+	user, err := environment.AddUser(envtest.User{Name: "unprivileged"}, environment.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user.Config()
+}
@@ -0,0 +1,214 @@
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	vclustersdksyncercontext "github.com/loft-sh/vcluster-sdk/syncer/context"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrlruntime "sigs.k8s.io/controller-runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+const (
+	// assetsEnv is the environment variable envtest reads the control plane binaries directory
+	// from, the suite is skipped if it is unset.
+	assetsEnv = "KUBEBUILDER_ASSETS"
+
+	// targetNamespace is the host namespace the (fake) vcluster syncs to.
+	targetNamespace = "test"
+
+	pollInterval = 100 * time.Millisecond
+	pollTimeout  = 10 * time.Second
+)
+
+var (
+	hostEnvironment    *envtest.Environment
+	virtualEnvironment *envtest.Environment
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(runSuite(m))
+}
+
+// runSuite starts the host and virtual control planes if the control plane binaries are
+// available, runs the tests and stops the control planes again.
+func runSuite(m *testing.M) int {
+	if os.Getenv(assetsEnv) == "" {
+		return m.Run()
+	}
+
+	hostEnvironment = &envtest.Environment{}
+	virtualEnvironment = &envtest.Environment{}
+
+	for _, environment := range []*envtest.Environment{hostEnvironment, virtualEnvironment} {
+		_, err := environment.Start()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed starting control plane, error: %s\n", err)
+
+			stopEnvironments()
+
+			return 1
+		}
+	}
+
+	defer stopEnvironments()
+
+	err := createNamespace(hostEnvironment.Config, targetNamespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed creating target namespace, error: %s\n", err)
+
+		return 1
+	}
+
+	return m.Run()
+}
+
+func stopEnvironments() {
+	for _, environment := range []*envtest.Environment{hostEnvironment, virtualEnvironment} {
+		if environment == nil || environment.Config == nil {
+			continue
+		}
+
+		err := environment.Stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed stopping control plane, error: %s\n", err)
+		}
+	}
+}
+
+// requireEnvironments skips the test if the control planes were not started.
+func requireEnvironments(t *testing.T) {
+	t.Helper()
+
+	if hostEnvironment == nil {
+		t.Skipf("%s is not set, skipping integration tests", assetsEnv)
+	}
+}
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		panic(err)
+	}
+
+	return scheme
+}
+
+func newClient(t *testing.T, config *rest.Config) ctrlruntimeclient.Client {
+	t.Helper()
+
+	c, err := ctrlruntimeclient.New(config, ctrlruntimeclient.Options{Scheme: newScheme()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func createNamespace(config *rest.Config, name string) error {
+	c, err := ctrlruntimeclient.New(config, ctrlruntimeclient.Options{Scheme: newScheme()})
+	if err != nil {
+		return err
+	}
+
+	return c.Create(
+		context.Background(),
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}},
+	)
+}
+
+// startManager starts a manager connected to the control plane of config, restricted to
+// namespace unless it is empty, and stops it when the test finishes.
+func startManager(t *testing.T, config *rest.Config, namespace string) ctrlruntime.Manager {
+	t.Helper()
+
+	mgr, err := ctrlruntime.NewManager(config, ctrlruntime.Options{
+		Scheme:                 newScheme(),
+		Namespace:              namespace,
+		MetricsBindAddress:     "0",
+		HealthProbeBindAddress: "0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := mgr.Start(ctx)
+		if err != nil {
+			t.Errorf("manager failed, error: %s", err)
+		}
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	if !mgr.GetCache().WaitForCacheSync(ctx) {
+		t.Fatal("failed waiting for manager cache to sync")
+	}
+
+	return mgr
+}
+
+// newRegisterContext returns the register context the vcluster syncer would pass to the plugin,
+// with the physical manager connected to the host control plane as config and the virtual
+// manager connected to the virtual control plane.
+func newRegisterContext(
+	t *testing.T,
+	config *rest.Config,
+) *vclustersdksyncercontext.RegisterContext {
+	t.Helper()
+
+	return &vclustersdksyncercontext.RegisterContext{
+		Context:          context.Background(),
+		Options:          &vclustersdksyncercontext.VirtualClusterOptions{},
+		TargetNamespace:  targetNamespace,
+		CurrentNamespace: targetNamespace,
+		PhysicalManager:  startManager(t, config, targetNamespace),
+		VirtualManager:   startManager(t, virtualEnvironment.Config, ""),
+	}
+}
+
+// waitForObject waits until obj can be read with reader, for cached readers that is once the
+// cache has seen the object.
+func waitForObject(
+	t *testing.T,
+	reader ctrlruntimeclient.Reader,
+	obj ctrlruntimeclient.Object,
+) {
+	t.Helper()
+
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		return reader.Get(
+			context.Background(),
+			ctrlruntimeclient.ObjectKeyFromObject(obj),
+			obj,
+		) == nil, nil
+	})
+	if err != nil {
+		t.Fatalf(
+			"failed waiting for object '%s/%s', error: %s",
+			obj.GetNamespace(),
+			obj.GetName(),
+			err,
+		)
+	}
+}
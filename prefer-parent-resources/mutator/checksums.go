@@ -0,0 +1,194 @@
+package mutator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChecksumsAnnotation is the annotation of the pods mutated with Options.Checksums, it holds the
+// Checksum of every substituted parent object by ChecksumKey, json encoded.
+const ChecksumsAnnotation = "vcluster.loft.sh/prefer-parent-checksums"
+
+// ParentHasher is optionally implemented by a ReferenceableKind whose parent objects hold data
+// that pods consume, such as configmaps and secrets. Pods only see changes of such data if it is
+// mounted as a volume, the checksums of the parent objects recorded on pods tell if the pods are
+// using outdated data.
+type ParentHasher interface {
+	// HashParent returns a hash of the data of obj, an object returned by GetParent, keyed with
+	// key (see Options.ChecksumKey). An empty string is returned if obj cannot be hashed, for
+	// example because its data is sensitive and key is empty.
+	HashParent(obj ctrlruntimeclient.Object, key []byte) string
+}
+
+// Checksum identifies the content of a parent object at the time it was substituted.
+type Checksum struct {
+	// ResourceVersion is the resource version of the parent object.
+	ResourceVersion string `json:"resourceVersion"`
+	// Hash is the hash of the data of the parent object, see ParentHasher.
+	Hash string `json:"hash"`
+}
+
+// NewChecksum returns the Checksum of the parent object obj of the given kind, its data hashed
+// with key, and false if the kind is not a ParentHasher or obj cannot be hashed.
+func NewChecksum(
+	kind ReferenceableKind,
+	obj ctrlruntimeclient.Object,
+	key []byte,
+) (Checksum, bool) {
+	hasher, ok := kind.(ParentHasher)
+	if !ok {
+		return Checksum{}, false
+	}
+
+	hash := hasher.HashParent(obj, key)
+	if hash == "" {
+		return Checksum{}, false
+	}
+
+	return Checksum{ResourceVersion: obj.GetResourceVersion(), Hash: hash}, true
+}
+
+// ChecksumKey returns the key of the Checksum of the parent object name of the kind named kind in
+// the ChecksumsAnnotation, for example "configmap/someconfigmap".
+func ChecksumKey(kind, name string) string {
+	return kind + "/" + name
+}
+
+// ParseChecksumKey returns the kind and name of the ChecksumKey key, and false if key is not a
+// valid ChecksumKey.
+func ParseChecksumKey(key string) (kind, name string, ok bool) {
+	kind, name, ok = strings.Cut(key, "/")
+
+	return kind, name, ok && kind != "" && name != ""
+}
+
+// GetChecksums returns the checksums of the ChecksumsAnnotation of the object obj by ChecksumKey.
+// An empty map is returned if the annotation is not set, an error if it cannot be decoded.
+func GetChecksums(obj ctrlruntimeclient.Object) (map[string]Checksum, error) {
+	checksums := map[string]Checksum{}
+
+	v, ok := obj.GetAnnotations()[ChecksumsAnnotation]
+	if !ok {
+		return checksums, nil
+	}
+
+	err := json.Unmarshal([]byte(v), &checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// hashData returns the hex encoded hmac-sha256 of data keyed with key, the keys of data are hashed
+// in sorted order. If key is empty the plain sha256 hash is returned, which must not be used for
+// sensitive data as it can be brute forced.
+func hashData(data map[string][]byte, key []byte) string {
+	keys := make([]string, 0, len(data))
+
+	for k := range data {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	prefix, h := "sha256:", sha256.New()
+	if len(key) > 0 {
+		prefix, h = "hmac-sha256:", hmac.New(sha256.New, key)
+	}
+
+	length := make([]byte, 8)
+
+	for _, k := range keys {
+		// every key and value is prefixed with its length, so that moving bytes between keys and
+		// values changes the hash
+		for _, b := range [][]byte{[]byte(k), data[k]} {
+			binary.BigEndian.PutUint64(length, uint64(len(b)))
+
+			_, _ = h.Write(length)
+			_, _ = h.Write(b)
+		}
+	}
+
+	return prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// checksumsNeedData returns true if parent objects of the kind have to be fetched in full to
+// record their checksums.
+func (m *referenceMutator) checksumsNeedData(kind ReferenceableKind) bool {
+	if !m.checksums {
+		return false
+	}
+
+	_, ok := kind.(ParentHasher)
+
+	return ok
+}
+
+// recordChecksums records the checksums of the parent objects of the applied references in the
+// ChecksumsAnnotation of the object obj, in addition to those already recorded on it. Nothing is
+// recorded unless the mutator records checksums.
+func (m *referenceMutator) recordChecksums(
+	obj ctrlruntimeclient.Object,
+	applied []*reference,
+) error {
+	if !m.checksums {
+		return nil
+	}
+
+	checksums, err := GetChecksums(obj)
+	if err != nil {
+		m.log.Errorf(
+			"invalid annotation '%s' on '%s/%s', replacing it, error: '%s'",
+			ChecksumsAnnotation,
+			obj.GetNamespace(),
+			obj.GetName(),
+			err,
+		)
+
+		checksums = map[string]Checksum{}
+	}
+
+	recorded := false
+
+	for _, ref := range applied {
+		if ref.parent == nil {
+			continue
+		}
+
+		checksum, ok := NewChecksum(ref.kind, ref.parent, m.checksumKey)
+		if !ok {
+			continue
+		}
+
+		checksums[ChecksumKey(ref.kind.Name(), ref.vName)] = checksum
+		recorded = true
+	}
+
+	if !recorded {
+		return nil
+	}
+
+	b, err := json.Marshal(checksums)
+	if err != nil {
+		return err
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[ChecksumsAnnotation] = string(b)
+
+	obj.SetAnnotations(annotations)
+
+	return nil
+}
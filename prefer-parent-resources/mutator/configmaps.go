@@ -0,0 +1,175 @@
+//nolint:dupl
+package mutator
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ConfigMapsHookName is the name of the hook (and Mutator) that substitutes only configmaps.
+	ConfigMapsHookName = "prefer-parent-configmaps-hook"
+
+	// SkipPreferConfigMapsHook is the annotation key that, if any value is set, will cause this
+	// plugin to skip preferring the parent (physical/real) configmap resources.
+	SkipPreferConfigMapsHook = "skip-prefer-parent-configmaps-hook"
+
+	// DryRunPreferConfigMapsHook is the annotation key that, if set to "true" or "false", overrides
+	// the hooks dry run setting for the pod. In dry run mode the configmap references are resolved
+	// as usual but left unchanged, the substitutions that would have been made are recorded on the
+	// pod.
+	DryRunPreferConfigMapsHook = "dry-run-prefer-parent-configmaps-hook"
+)
+
+// ConfigMapKind is the ReferenceableKind of configmaps, referenced by pods as environment
+// variables (configMapKeyRef), environment sources (configMapRef), volumes and projected volume
+// sources.
+type ConfigMapKind struct{}
+
+// Name returns the name of the kind.
+func (ConfigMapKind) Name() string {
+	return "configmap"
+}
+
+// HookName returns the name of the hook that mutates only configmaps.
+func (ConfigMapKind) HookName() string {
+	return ConfigMapsHookName
+}
+
+// SkipAnnotation returns the configmap skip annotation key.
+func (ConfigMapKind) SkipAnnotation() string {
+	return SkipPreferConfigMapsHook
+}
+
+// DryRunAnnotation returns the configmap dry run annotation key.
+func (ConfigMapKind) DryRunAnnotation() string {
+	return DryRunPreferConfigMapsHook
+}
+
+// GroupVersionKind returns the GroupVersionKind of configmaps.
+func (ConfigMapKind) GroupVersionKind() schema.GroupVersionKind {
+	return corev1.SchemeGroupVersion.WithKind("ConfigMap")
+}
+
+// FindReferences returns the references to configmaps in the pod spec: environment variables
+// and environment sources of every container, init container and ephemeral container, volumes and
+// projected volume sources.
+func (k ConfigMapKind) FindReferences(podSpec *corev1.PodSpec) []Reference {
+	return k.references().find(podSpec)
+}
+
+// GetName returns the name of the configmap ref refers to.
+func (k ConfigMapKind) GetName(podSpec *corev1.PodSpec, ref *Reference) string {
+	name := k.references().namePtr(podSpec, ref)
+	if name == nil {
+		return ""
+	}
+
+	return *name
+}
+
+// SetName rewrites ref to refer to the configmap name.
+func (k ConfigMapKind) SetName(podSpec *corev1.PodSpec, ref *Reference, name string) {
+	namePtr := k.references().namePtr(podSpec, ref)
+	if namePtr == nil {
+		return
+	}
+
+	*namePtr = name
+}
+
+// references returns where configmaps are referenced in pod specs.
+func (ConfigMapKind) references() *podSpecReferences {
+	return &podSpecReferences{
+		env: func(env *corev1.EnvVar) *string {
+			if env.ValueFrom == nil || env.ValueFrom.ConfigMapKeyRef == nil {
+				return nil
+			}
+
+			return &env.ValueFrom.ConfigMapKeyRef.Name
+		},
+		envFrom: func(envFrom *corev1.EnvFromSource) *string {
+			if envFrom.ConfigMapRef == nil {
+				return nil
+			}
+
+			return &envFrom.ConfigMapRef.Name
+		},
+		volume: func(vol *corev1.Volume) *string {
+			if vol.ConfigMap == nil {
+				return nil
+			}
+
+			return &vol.ConfigMap.Name
+		},
+		projection: func(projection *corev1.VolumeProjection) *string {
+			if projection.ConfigMap == nil {
+				return nil
+			}
+
+			return &projection.ConfigMap.Name
+		},
+	}
+}
+
+// GetParent fetches the configmap with the given key.
+func (ConfigMapKind) GetParent(
+	ctx context.Context,
+	reader ctrlruntimeclient.Reader,
+	key types.NamespacedName,
+) (ctrlruntimeclient.Object, error) {
+	obj := &corev1.ConfigMap{}
+
+	err := reader.Get(ctx, key, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// HashParent returns the hash of the data and binary data of the configmap obj, keyed with key if
+// it is set.
+func (ConfigMapKind) HashParent(obj ctrlruntimeclient.Object, key []byte) string {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return ""
+	}
+
+	return hashData(configMapData(configMap), key)
+}
+
+// DiffParent returns the keys the parent configmap adds, removes and changes compared to the
+// virtual configmap it shadows.
+func (ConfigMapKind) DiffParent(virtual, parent ctrlruntimeclient.Object) ObjectDiff {
+	vConfigMap, ok := virtual.(*corev1.ConfigMap)
+	if !ok {
+		return ObjectDiff{}
+	}
+
+	pConfigMap, ok := parent.(*corev1.ConfigMap)
+	if !ok {
+		return ObjectDiff{}
+	}
+
+	return diffData(configMapData(vConfigMap), configMapData(pConfigMap), true)
+}
+
+// configMapData returns the data and binary data of the configMap.
+func configMapData(configMap *corev1.ConfigMap) map[string][]byte {
+	data := make(map[string][]byte, len(configMap.Data)+len(configMap.BinaryData))
+
+	for k, v := range configMap.Data {
+		data[k] = []byte(v)
+	}
+
+	for k, v := range configMap.BinaryData {
+		data[k] = v
+	}
+
+	return data
+}
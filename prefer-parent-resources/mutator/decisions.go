@@ -0,0 +1,101 @@
+package mutator
+
+import (
+	"context"
+
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DecisionOutcomeSkipped is the Decision outcome of references whose kind is skipped by the
+	// skip annotation of the object, and whose parent object the mutator does not enforce.
+	DecisionOutcomeSkipped = "skipped"
+	// DecisionOutcomeUnresolved is the Decision outcome of references whose virtual name could not
+	// be resolved, so their parent object is not looked up.
+	DecisionOutcomeUnresolved = "unresolved"
+)
+
+// Decision describes the decision a Mutator made for a single reference of the object it mutated.
+type Decision struct {
+	// Hook is the name of the hook (the Mutator) that made the decision.
+	Hook string `json:"hook"`
+	// Kind is the name of the ReferenceableKind of the referenced object.
+	Kind string `json:"kind"`
+	// Location describes where the reference is found, for example "volume 'config'".
+	Location string `json:"location"`
+	// From is the (physical) name the object referenced before the mutation.
+	From string `json:"from"`
+	// Parent is the name of the parent object considered, the resolved virtual name.
+	Parent string `json:"parent,omitempty"`
+	// Outcome is the outcome of the reference, one of the MutationOutcome or DecisionOutcome
+	// values.
+	Outcome string `json:"outcome"`
+	// Reason explains outcomes other than substituted and dry run.
+	Reason string `json:"reason,omitempty"`
+	// Diff summarizes how the parent object differs from the virtual object it shadows, it is
+	// only set for substituted (and dry run) references with Options.DiffShadowed if the virtual
+	// object exists and holds different data.
+	Diff *ObjectDiff `json:"diff,omitempty"`
+}
+
+// DecisionRecorder is called with every Decision the mutators make while mutating an object.
+type DecisionRecorder func(d Decision)
+
+type decisionRecorderKey struct{}
+
+// WithDecisionRecorder returns a copy of ctx that makes the mutators report their decisions for the
+// references of the objects they mutate with ctx to recorder.
+func WithDecisionRecorder(ctx context.Context, recorder DecisionRecorder) context.Context {
+	return context.WithValue(ctx, decisionRecorderKey{}, recorder)
+}
+
+// collectDecisions calls mutate with a copy of ctx that collects the decisions made for the
+// references of obj in to the returned Result, the decisions are reported to the DecisionRecorder
+// of ctx as well.
+func collectDecisions(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+	mutate func(ctx context.Context) error,
+) (*Result, error) {
+	result := &Result{Object: obj}
+
+	recorder, _ := ctx.Value(decisionRecorderKey{}).(DecisionRecorder)
+
+	ctx = WithDecisionRecorder(ctx, func(d Decision) {
+		result.Decisions = append(result.Decisions, d)
+
+		if recorder != nil {
+			recorder(d)
+		}
+	})
+
+	err := mutate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// recordDecision reports the decision for ref to the DecisionRecorder of ctx, if it has one.
+func (m *referenceMutator) recordDecision(
+	ctx context.Context,
+	ref *reference,
+	outcome, reason string,
+) {
+	recorder, ok := ctx.Value(decisionRecorderKey{}).(DecisionRecorder)
+	if !ok {
+		return
+	}
+
+	recorder(Decision{
+		Hook:     m.name,
+		Kind:     ref.kind.Name(),
+		Location: ref.location(),
+		From:     ref.pName,
+		Parent:   ref.vName,
+		Outcome:  outcome,
+		Reason:   reason,
+		Diff:     ref.diff,
+	})
+}
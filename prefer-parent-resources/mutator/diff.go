@@ -0,0 +1,216 @@
+package mutator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ShadowedEventReason is the reason of the events recorded on virtual pods for virtual objects
+// that are shadowed by parent objects holding different data.
+const ShadowedEventReason = "PreferParentShadowed"
+
+// ParentDiffer is optionally implemented by a ReferenceableKind whose objects hold data, such as
+// configmaps and secrets. When a parent object is substituted for a virtual object that exists as
+// well, edits of the virtual object have no effect on the pod, the differences between the two
+// objects are reported so that this is not a surprise.
+type ParentDiffer interface {
+	// DiffParent returns the differences of the parent object parent from the virtual object
+	// virtual it shadows, both objects returned by GetParent. Implementations must not compare the
+	// values of sensitive data, as the changed keys are reported in events and annotations.
+	DiffParent(virtual, parent ctrlruntimeclient.Object) ObjectDiff
+}
+
+// ObjectDiff describes the keys a parent object holds compared to the virtual object it shadows,
+// it never holds any values.
+type ObjectDiff struct {
+	// Added are the keys of the parent object missing in the virtual object.
+	Added []string `json:"added,omitempty"`
+	// Removed are the keys of the virtual object missing in the parent object.
+	Removed []string `json:"removed,omitempty"`
+	// Changed are the keys of both objects whose values differ, only set for kinds whose values
+	// may be compared.
+	Changed []string `json:"changed,omitempty"`
+}
+
+// Empty returns true if the diff holds no differences.
+func (d ObjectDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String returns a human-readable summary of the diff.
+func (d ObjectDiff) String() string {
+	var parts []string
+
+	for _, keys := range []struct {
+		action string
+		keys   []string
+	}{
+		{action: "adds", keys: d.Added},
+		{action: "removes", keys: d.Removed},
+		{action: "changes", keys: d.Changed},
+	} {
+		if len(keys.keys) == 0 {
+			continue
+		}
+
+		parts = append(
+			parts,
+			fmt.Sprintf("%s keys '%s'", keys.action, strings.Join(keys.keys, "', '")),
+		)
+	}
+
+	if len(parts) == 0 {
+		return "no differences"
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// diffData returns the keys of parent missing in virtual, the keys of virtual missing in parent
+// and, if compareValues is true, the keys of both whose values differ. The keys are sorted.
+func diffData(virtual, parent map[string][]byte, compareValues bool) ObjectDiff {
+	var d ObjectDiff
+
+	for k, v := range parent {
+		vValue, ok := virtual[k]
+
+		switch {
+		case !ok:
+			d.Added = append(d.Added, k)
+		case compareValues && !bytes.Equal(v, vValue):
+			d.Changed = append(d.Changed, k)
+		}
+	}
+
+	for k := range virtual {
+		if _, ok := parent[k]; !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+
+	return d
+}
+
+// diffShadowedParents sets the diff of the references of the plan of the object obj (generally a
+// pod) whose parent objects shadow virtual objects holding different data, and records an event on
+// the virtual object of obj for each such virtual object unless its kind is in dry run mode for
+// obj. Nothing is compared unless Options.DiffShadowed is set. Comparing the objects is best
+// effort, failures are logged but never fail the mutation.
+func (m *referenceMutator) diffShadowedParents(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+	plan []*reference,
+) {
+	vNamespace := obj.GetAnnotations()[VirtualNamespaceAnnotation]
+	if !m.diffShadowed || m.virtualAPIReader == nil || vNamespace == "" {
+		return
+	}
+
+	diffs := map[string]*ObjectDiff{}
+
+	for _, ref := range plan {
+		differ, ok := ref.kind.(ParentDiffer)
+		if !ok || ref.parent == nil {
+			continue
+		}
+
+		key := ref.kind.Name() + "/" + ref.vName
+
+		diff, ok := diffs[key]
+		if !ok {
+			diff = m.diffParent(ctx, differ, ref, vNamespace)
+			diffs[key] = diff
+
+			if diff != nil && !m.isDryRun(obj, ref.kind) {
+				m.recordVirtualEvent(
+					obj,
+					corev1.EventTypeNormal,
+					ShadowedEventReason,
+					fmt.Sprintf(
+						"host cluster %[1]s '%[2]s' is used instead of the virtual %[1]s, edits "+
+							"of the virtual %[1]s have no effect, the host cluster %[1]s %[3]s",
+						ref.kind.Name(),
+						ref.vName,
+						diff,
+					),
+				)
+			}
+		}
+
+		ref.diff = diff
+	}
+}
+
+// diffParent returns the differences of the parent object of the reference ref from the virtual
+// object it shadows in the virtual namespace vNamespace, or nil if the virtual object does not
+// exist, cannot be read, or holds the same data. The virtual object is read with the uncached
+// virtual API reader, a cached client would cache every virtual object of its kind.
+func (m *referenceMutator) diffParent(
+	ctx context.Context,
+	differ ParentDiffer,
+	ref *reference,
+	vNamespace string,
+) *ObjectDiff {
+	virtual, err := ref.kind.GetParent(
+		ctx,
+		m.virtualAPIReader,
+		types.NamespacedName{Namespace: vNamespace, Name: ref.vName},
+	)
+	if err != nil {
+		if ctrlruntimeclient.IgnoreNotFound(err) != nil {
+			m.log.Errorf(
+				"failed reading virtual %s '%s/%s' shadowed by the host cluster %s, error: '%s'",
+				ref.kind.Name(),
+				vNamespace,
+				ref.vName,
+				ref.kind.Name(),
+				err,
+			)
+		}
+
+		return nil
+	}
+
+	parent := ref.parent
+
+	if _, ok := parent.(*metav1.PartialObjectMetadata); ok {
+		// only the metadata of the parent object was looked up, fetch it in full now that it is
+		// known to shadow a virtual object
+		parent, err = ref.kind.GetParent(
+			ctx,
+			m.parentReader,
+			types.NamespacedName{Namespace: m.physicalNamespace, Name: ref.vName},
+		)
+		if err != nil {
+			m.log.Errorf(
+				"failed reading host cluster %s '%s/%s' shadowing a virtual %s, error: '%s'",
+				ref.kind.Name(),
+				m.physicalNamespace,
+				ref.vName,
+				ref.kind.Name(),
+				err,
+			)
+
+			return nil
+		}
+	}
+
+	diff := differ.DiffParent(virtual, parent)
+	if diff.Empty() {
+		return nil
+	}
+
+	return &diff
+}
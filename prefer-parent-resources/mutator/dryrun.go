@@ -0,0 +1,165 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DryRunAnnotationPrefix is the prefix of the annotation that records the substitutions a hook
+	// would have made to a pod in dry run mode, the full key is the prefix followed by the hook
+	// name, for example "vcluster.loft.sh/dry-run-prefer-parent-configmaps-hook".
+	DryRunAnnotationPrefix = "vcluster.loft.sh/dry-run-"
+
+	// MutationOutcomeDryRun is the outcome label value recorded when a reference would have been
+	// rewritten to point at the parent object, but the hook is running in dry run mode.
+	MutationOutcomeDryRun = "dry_run"
+)
+
+// Substitution describes a single pod reference that was -- or in dry run mode would have been --
+// rewritten to point at an object in the parent namespace.
+type Substitution struct {
+	Kind string `json:"kind"`
+	// Source and Index are the part of the pod spec, and the index in it, of references that are
+	// not located by an env, volume or field, such as environment sources, projected volume
+	// sources and image pull secrets.
+	Source    ReferenceSource `json:"source,omitempty"`
+	Index     int             `json:"index,omitempty"`
+	Container string          `json:"container,omitempty"`
+	Env       string          `json:"env,omitempty"`
+	Volume    string          `json:"volume,omitempty"`
+	Field     string          `json:"field,omitempty"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	// Diff summarizes how the parent object differs from the virtual object it shadows, it is
+	// only set if the virtual object exists and holds different data.
+	Diff *ObjectDiff `json:"diff,omitempty"`
+}
+
+// String returns a human-readable description of the substitution.
+func (s Substitution) String() string {
+	if s.Diff == nil {
+		return s.describe()
+	}
+
+	return fmt.Sprintf("%s (shadowing the virtual %s, the parent %s)", s.describe(), s.Kind, s.Diff)
+}
+
+// describe returns a human-readable description of the reference rewritten by the substitution.
+func (s Substitution) describe() string {
+	return fmt.Sprintf("%s %s '%s' -> '%s'", s.location(), s.Kind, s.From, s.To)
+}
+
+// location returns a human-readable description of where the reference rewritten by the
+// substitution is found.
+func (s Substitution) location() string {
+	switch {
+	case s.Source == ReferenceSourceEnvFrom:
+		return fmt.Sprintf("container '%s' envFrom %d", s.Container, s.Index)
+	case s.Source == ReferenceSourceProjection:
+		return fmt.Sprintf("volume '%s' source %d", s.Volume, s.Index)
+	case s.Source != "":
+		return fmt.Sprintf("%s %d", s.Source, s.Index)
+	case s.Env != "":
+		return fmt.Sprintf("container '%s' env '%s'", s.Container, s.Env)
+	case s.Field != "":
+		return fmt.Sprintf("field '%s'", s.Field)
+	default:
+		return fmt.Sprintf("volume '%s'", s.Volume)
+	}
+}
+
+// podMutation holds the state of a single Mutate invocation.
+type podMutation struct {
+	pod *corev1.Pod
+	// vPod is the virtual pod, it is only fetched if a reference cannot be reverse translated.
+	vPod       *corev1.Pod
+	vPodFailed bool
+	// dryRunSubstitutions are the substitutions that were not made as their kind is in dry run
+	// mode for the pod.
+	dryRunSubstitutions []Substitution
+}
+
+// isDryRun returns true if references of the object obj (generally a pod) to objects of the given
+// kind should be mutated in dry run mode. The kinds dry run annotation, if set to a valid boolean
+// value, takes precedence over the hook default.
+func (m *referenceMutator) isDryRun(obj ctrlruntimeclient.Object, kind ReferenceableKind) bool {
+	v, ok := obj.GetAnnotations()[kind.DryRunAnnotation()]
+	if !ok || v == "" {
+		return m.dryRun
+	}
+
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		m.log.Errorf(
+			"invalid value '%s' for annotation '%s' on '%s/%s', using hook default '%t'",
+			v,
+			kind.DryRunAnnotation(),
+			obj.GetNamespace(),
+			obj.GetName(),
+			m.dryRun,
+		)
+
+		return m.dryRun
+	}
+
+	return dryRun
+}
+
+// substitute rewrites the reference of the object obj (generally a pod) to point at the parent
+// object by calling set, unless the references kind is in dry run mode for the object. The
+// substitution is returned along with true if the reference was rewritten.
+func (m *referenceMutator) substitute(
+	obj ctrlruntimeclient.Object,
+	ref *reference,
+	set func(),
+) (Substitution, bool) {
+	s := ref.substitution()
+
+	if m.isDryRun(obj, ref.kind) {
+		m.log.Infof("dry run, would mutate '%s/%s' %s", obj.GetNamespace(), obj.GetName(), s)
+
+		m.recordMutation(ref.kind, MutationOutcomeDryRun)
+
+		return s, false
+	}
+
+	m.log.Infof("mutating '%s/%s' %s", obj.GetNamespace(), obj.GetName(), s)
+
+	set()
+
+	m.recordMutation(ref.kind, MutationOutcomeSubstituted)
+
+	return s, true
+}
+
+// recordDryRun writes the substitutions that were not made as the mutation was in dry run mode to
+// the dry run annotation of the object obj.
+func (m *referenceMutator) recordDryRun(
+	obj ctrlruntimeclient.Object,
+	substitutions []Substitution,
+) error {
+	if len(substitutions) == 0 {
+		return nil
+	}
+
+	b, err := json.Marshal(substitutions)
+	if err != nil {
+		return err
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	annotations[DryRunAnnotationPrefix+m.name] = string(b)
+
+	obj.SetAnnotations(annotations)
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package mutator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// EnforcedAnnotation is the parent object annotation that, if set to "true", enforces the
+	// parent object: objects whose references to it cannot be substituted are rejected. The parent
+	// object is only looked up for references that are not skipped, so unlike enforcing the hook
+	// the annotation does not override the skip annotations of objects referencing it.
+	EnforcedAnnotation = "prefer-parent/enforced"
+
+	reservedReason = "reserved"
+)
+
+// enforcement is the scope of the enforcement of a mutator, the references it requires to be
+// substituted regardless of the skip annotations of the objects being mutated.
+type enforcement struct {
+	enabled bool
+	names   map[string]bool
+	kinds   map[string]bool
+}
+
+// newEnforcement returns the enforcement of a mutator that is enforced if enabled is true,
+// limited to the references to parent objects of the given (virtual) names and of the given kinds
+// if either is set.
+func newEnforcement(enabled bool, names, kinds []string) *enforcement {
+	e := &enforcement{
+		enabled: enabled,
+		names:   map[string]bool{},
+		kinds:   map[string]bool{},
+	}
+
+	for _, name := range names {
+		e.names[name] = true
+	}
+
+	for _, kind := range kinds {
+		e.kinds[kind] = true
+	}
+
+	return e
+}
+
+// enforcesKind returns true if every reference of kind is enforced.
+func (e *enforcement) enforcesKind(kind ReferenceableKind) bool {
+	if !e.enabled {
+		return false
+	}
+
+	return (len(e.names) == 0 && len(e.kinds) == 0) || e.kinds[kind.Name()]
+}
+
+// enforces returns true if the references of kind to the parent object vName are enforced.
+func (e *enforcement) enforces(kind ReferenceableKind, vName string) bool {
+	return e.enforcesKind(kind) || (e.enabled && e.names[vName])
+}
+
+// enforcedParent returns true if the parent object is enforced with the EnforcedAnnotation.
+func enforcedParent(parent ctrlruntimeclient.Object) bool {
+	enforced, _ := strconv.ParseBool(parent.GetAnnotations()[EnforcedAnnotation])
+
+	return enforced
+}
+
+// lookupFailedReason returns the reason references are not substituted when looking up their
+// parent object failed with err.
+func lookupFailedReason(err error) string {
+	if apimachineryerrors.IsNotFound(err) {
+		return "not found"
+	}
+
+	return fmt.Sprintf("lookup failed: %s", err)
+}
+
+// skipKind returns true if the skip annotation of kind is set on the object obj, and the hook does
+// not enforce the kind. The references of skipped kinds are not looked up, unless the hook
+// enforces their parent object by name.
+func (m *referenceMutator) skipKind(obj ctrlruntimeclient.Object, kind ReferenceableKind) bool {
+	if obj.GetAnnotations()[kind.SkipAnnotation()] == "" {
+		return false
+	}
+
+	if m.enforcement.enforcesKind(kind) {
+		m.log.Infof(
+			"mutate physical %s/%s ignoring %s skip annotation, hook is enforced",
+			obj.GetNamespace(),
+			obj.GetName(),
+			kind.Name(),
+		)
+
+		return false
+	}
+
+	m.log.Infof(
+		"mutate physical %s/%s skipping %s references, ignore annotation set",
+		obj.GetNamespace(),
+		obj.GetName(),
+		kind.Name(),
+	)
+
+	recordAnnotationSkip(m.name)
+
+	return true
+}
+
+// checkEnforced returns an ErrParentRequired error describing the unsatisfied references -- the
+// references of the object obj that are enforced but cannot be substituted, along with the reason
+// they cannot -- if there are any. References whose kind is in dry run mode for obj are only
+// logged.
+func (m *referenceMutator) checkEnforced(
+	obj ctrlruntimeclient.Object,
+	resolved []*reference,
+	unsatisfied map[*reference]string,
+) error {
+	var violations []string
+
+	for _, ref := range resolved {
+		reason, ok := unsatisfied[ref]
+		if !ok {
+			continue
+		}
+
+		violation := fmt.Sprintf(
+			"%s %s '%s': %s",
+			ref.location(),
+			ref.kind.Name(),
+			ref.vName,
+			reason,
+		)
+
+		if m.isDryRun(obj, ref.kind) {
+			m.log.Infof(
+				"dry run, would reject '%s/%s', enforced reference %s",
+				obj.GetNamespace(),
+				obj.GetName(),
+				violation,
+			)
+
+			continue
+		}
+
+		violations = append(violations, violation)
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	m.log.Errorf(
+		"rejecting '%s/%s', enforced references cannot be satisfied: %s",
+		obj.GetNamespace(),
+		obj.GetName(),
+		strings.Join(violations, "; "),
+	)
+
+	return fmt.Errorf(
+		"%w: '%s/%s' must use parent objects from host namespace '%s': %s",
+		ErrParentRequired,
+		obj.GetAnnotations()[VirtualNamespaceAnnotation],
+		obj.GetAnnotations()[VirtualNameAnnotation],
+		m.physicalNamespace,
+		strings.Join(violations, "; "),
+	)
+}
@@ -0,0 +1,89 @@
+package mutator
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrWrongResourceType is an error that is returned when the mutate hook encounters an
+	// unexpected/undesired type -- generally this should not be encountered.
+	ErrWrongResourceType = errors.New("errWrongResourceType")
+	// ErrCantGetResource is an error returned when unable to find a given resource in either the
+	// parent/physical cluster or the vcluster.
+	ErrCantGetResource = errors.New("errCantGetResource")
+	// ErrInvalidFailurePolicy is an error returned when parsing an unknown FailurePolicy value.
+	ErrInvalidFailurePolicy = errors.New("errInvalidFailurePolicy")
+	// ErrKindAlreadyRegistered is an error returned when registering a ReferenceableKind with the
+	// name of an already registered kind.
+	ErrKindAlreadyRegistered = errors.New("errKindAlreadyRegistered")
+	// ErrParentNotEligible is an error returned by a ParentValidator when a parent object may not
+	// be substituted.
+	ErrParentNotEligible = errors.New("errParentNotEligible")
+	// ErrInvalidFieldPath is an error returned when parsing an invalid field reference path.
+	ErrInvalidFieldPath = errors.New("errInvalidFieldPath")
+	// ErrInvalidFieldReferencesConfig is an error returned when loading an invalid field
+	// references hook configuration.
+	ErrInvalidFieldReferencesConfig = errors.New("errInvalidFieldReferencesConfig")
+	// ErrInvalidGrant is an error returned when parsing an invalid ParentResourceGrant.
+	ErrInvalidGrant = errors.New("errInvalidGrant")
+	// ErrParentRequired is an error returned when enforced references of an object cannot be
+	// substituted with parent objects, rejecting the object.
+	ErrParentRequired = errors.New("errParentRequired")
+)
+
+const (
+	// LookupClusterParent is the LookupError cluster value for lookups in the parent (physical)
+	// cluster.
+	LookupClusterParent = "parent"
+	// LookupClusterVirtual is the LookupError cluster value for lookups in the virtual cluster.
+	LookupClusterVirtual = "virtual"
+)
+
+// LookupError is the error returned when looking up an object in the parent (physical) or virtual
+// cluster fails. For parent objects a not found error is not a LookupError -- that simply means
+// the reference should keep pointing at the virtual object. How the hooks react to a LookupError
+// is determined by their FailurePolicy: with FailurePolicyFailOpen the error is logged and the
+// reference(s) keep pointing at the virtual object, with FailurePolicyFailClosed and
+// FailurePolicyRetry the LookupError is returned from Mutate, rejecting the pod.
+// A LookupError matches ErrCantGetResource with errors.Is, and unwraps to the underlying client
+// error.
+type LookupError struct {
+	// Cluster is the cluster the lookup was made against, LookupClusterParent or
+	// LookupClusterVirtual.
+	Cluster string
+	// Kind is the kind of object being looked up, for example "configmap" or "pod".
+	Kind string
+	// Namespace is the namespace of the object being looked up.
+	Namespace string
+	// Name is the name of the object being looked up.
+	Name string
+	// Policy is the failure policy that was applied to the lookup.
+	Policy FailurePolicy
+	// Err is the underlying error returned by the client.
+	Err error
+}
+
+// Error returns the string representation of the LookupError.
+func (e *LookupError) Error() string {
+	return fmt.Sprintf(
+		"%s: failed getting %s cluster %s '%s/%s' (failure policy '%s'): %s",
+		ErrCantGetResource,
+		e.Cluster,
+		e.Kind,
+		e.Namespace,
+		e.Name,
+		e.Policy,
+		e.Err,
+	)
+}
+
+// Unwrap returns the underlying client error.
+func (e *LookupError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns true if target is ErrCantGetResource.
+func (e *LookupError) Is(target error) bool {
+	return target == ErrCantGetResource
+}
@@ -0,0 +1,84 @@
+package mutator
+
+import (
+	"fmt"
+	"time"
+
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// FailurePolicy determines how the hooks react to errors looking up the parent (physical) objects
+// referenced by a pod, or the virtual pod itself.
+type FailurePolicy string
+
+const (
+	// FailurePolicyFailOpen logs lookup errors and leaves the affected references pointing at the
+	// virtual objects. This is the default failure policy.
+	FailurePolicyFailOpen FailurePolicy = "fail-open"
+	// FailurePolicyFailClosed rejects the pod with a LookupError on the first lookup error.
+	FailurePolicyFailClosed FailurePolicy = "fail-closed"
+	// FailurePolicyRetry retries failed lookups with exponential backoff, and rejects the pod with
+	// a LookupError if the lookup still fails once the retries are exhausted.
+	FailurePolicyRetry FailurePolicy = "retry"
+)
+
+// failurePolicyRetryBackoff is the backoff used for retrying lookups with FailurePolicyRetry.
+var failurePolicyRetryBackoff = wait.Backoff{ //nolint:gochecknoglobals
+	Steps:    4,
+	Duration: 50 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// ParseFailurePolicy parses the string s in to a FailurePolicy, an empty string returns
+// FailurePolicyFailOpen.
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	switch FailurePolicy(s) {
+	case "", FailurePolicyFailOpen:
+		return FailurePolicyFailOpen, nil
+	case FailurePolicyFailClosed:
+		return FailurePolicyFailClosed, nil
+	case FailurePolicyRetry:
+		return FailurePolicyRetry, nil
+	default:
+		return "", fmt.Errorf("%w: unknown failure policy '%s'", ErrInvalidFailurePolicy, s)
+	}
+}
+
+// rejects returns true if the failure policy rejects pods when a lookup fails.
+func (p FailurePolicy) rejects() bool {
+	return p != FailurePolicyFailOpen
+}
+
+// withFailurePolicy executes the lookup f, retrying it with backoff if the hooks failure policy is
+// FailurePolicyRetry. Not found errors are never retried.
+func (m *referenceMutator) withFailurePolicy(f func() error) error {
+	if m.failurePolicy != FailurePolicyRetry {
+		return f()
+	}
+
+	return retry.OnError(
+		failurePolicyRetryBackoff,
+		func(err error) bool {
+			return !apimachineryerrors.IsNotFound(err)
+		},
+		f,
+	)
+}
+
+// handleLookupError applies the hooks failure policy to the LookupError err -- returning nil if
+// the pod should be admitted with the affected reference(s) unchanged, or err if the pod should be
+// rejected.
+func (m *referenceMutator) handleLookupError(err *LookupError) error {
+	if m.failurePolicy.rejects() {
+		m.log.Errorf("%s, rejecting pod", err)
+
+		return err
+	}
+
+	m.log.Errorf("%s, skipping...", err)
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package mutator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//nolint:gochecknoglobals
+var fieldPathSegmentPattern = regexp.MustCompile(`^([A-Za-z0-9_-]+)(?:\[(\*|\d+)])?$`)
+
+// fieldPathSegment is a single field of a fieldPath, optionally indexing in to a list.
+type fieldPathSegment struct {
+	field string
+	// all selects every element of the list field.
+	all bool
+	// indexed selects the element at index of the list field.
+	indexed bool
+	index   int
+}
+
+// fieldPath is a parsed JSONPath-like path to string fields of an unstructured object, for
+// example "spec.secretName" or "spec.listeners[*].tls.certificateRefs[*].name".
+type fieldPath []fieldPathSegment
+
+// parseFieldPath parses path in to a fieldPath. Fields are separated by dots, list fields may be
+// indexed with "[N]" or "[*]" to select one or every element of the list. A leading "$" or "." and
+// surrounding braces, as used by kubectl JSONPath expressions, are accepted and ignored. The last
+// field must be a plain field holding the referenced name.
+func parseFieldPath(path string) (fieldPath, error) {
+	trimmed := strings.TrimSpace(path)
+	trimmed = strings.TrimSuffix(strings.TrimPrefix(trimmed, "{"), "}")
+	trimmed = strings.TrimPrefix(strings.TrimPrefix(trimmed, "$"), ".")
+
+	if trimmed == "" {
+		return nil, fmt.Errorf("%w: empty field path", ErrInvalidFieldPath)
+	}
+
+	var p fieldPath
+
+	for _, s := range strings.Split(trimmed, ".") {
+		match := fieldPathSegmentPattern.FindStringSubmatch(s)
+		if match == nil {
+			return nil, fmt.Errorf(
+				"%w: invalid field '%s' in field path '%s'",
+				ErrInvalidFieldPath,
+				s,
+				path,
+			)
+		}
+
+		segment := fieldPathSegment{field: match[1]}
+
+		switch match[2] {
+		case "":
+		case "*":
+			segment.all = true
+		default:
+			index, err := strconv.Atoi(match[2])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidFieldPath, err)
+			}
+
+			segment.indexed = true
+			segment.index = index
+		}
+
+		p = append(p, segment)
+	}
+
+	last := p[len(p)-1]
+	if last.all || last.indexed {
+		return nil, fmt.Errorf(
+			"%w: field path '%s' must end with a plain field",
+			ErrInvalidFieldPath,
+			path,
+		)
+	}
+
+	return p, nil
+}
+
+// fieldLocation is a string field of an unstructured object found by a fieldPath.
+type fieldLocation struct {
+	// path is the concrete path of the field, with every list index resolved.
+	path   string
+	parent map[string]interface{}
+	key    string
+}
+
+// get returns the value of the field.
+func (l *fieldLocation) get() string {
+	s, _ := l.parent[l.key].(string)
+
+	return s
+}
+
+// set sets the value of the field.
+func (l *fieldLocation) set(value string) {
+	l.parent[l.key] = value
+}
+
+// find returns the locations of the string fields of the unstructured object obj selected by the
+// path, in the order they appear in obj. Fields that are missing or not of the expected type are
+// ignored.
+func (p fieldPath) find(obj map[string]interface{}) []*fieldLocation {
+	return p.findFrom(obj, "")
+}
+
+func (p fieldPath) findFrom(obj map[string]interface{}, prefix string) []*fieldLocation {
+	segment := p[0]
+	path := prefix + segment.field
+
+	if len(p) == 1 {
+		if _, ok := obj[segment.field].(string); !ok {
+			return nil
+		}
+
+		return []*fieldLocation{{path: path, parent: obj, key: segment.field}}
+	}
+
+	type child struct {
+		path  string
+		value interface{}
+	}
+
+	var children []child
+
+	value := obj[segment.field]
+
+	if !segment.all && !segment.indexed {
+		children = append(children, child{path: path, value: value})
+	} else {
+		list, _ := value.([]interface{})
+
+		for i := range list {
+			if segment.indexed && i != segment.index {
+				continue
+			}
+
+			children = append(children, child{path: fmt.Sprintf("%s[%d]", path, i), value: list[i]})
+		}
+	}
+
+	var locations []*fieldLocation
+
+	for _, c := range children {
+		m, ok := c.value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		locations = append(locations, p[1:].findFrom(m, c.path+".")...)
+	}
+
+	return locations
+}
@@ -0,0 +1,421 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ReferenceSourceField is the ReferenceSource of references found in fields of objects by a
+	// field references hook, the Reference Field is the concrete path of the field.
+	ReferenceSourceField ReferenceSource = "field"
+)
+
+// FieldReferencesConfig is the configuration of the field references hooks (and mutators).
+type FieldReferencesConfig struct {
+	Hooks []FieldReferencesHookConfig `json:"hooks"`
+}
+
+// FieldReferencesHookConfig configures a single field references hook, mutating objects of the
+// given APIVersion and Kind.
+type FieldReferencesHookConfig struct {
+	// Name is the name of the hook, it determines the environment variables of the hook settings
+	// the same as for every other hook, for example "PREFER_PARENT_CERTIFICATES_HOOK_DRY_RUN" for
+	// a hook named "prefer-parent-certificates-hook".
+	Name       string `json:"name"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// References are the fields of the object that reference objects by name.
+	References []FieldReferenceConfig `json:"references"`
+}
+
+// FieldReferenceConfig configures a field of an object that references an object by name.
+type FieldReferenceConfig struct {
+	// Kind is the name of the registered ReferenceableKind of the referenced object, for example
+	// "configmap" or "secret".
+	Kind string `json:"kind"`
+	// Path is the JSONPath-like path of the field holding the name of the referenced object, for
+	// example "spec.secretName" or "spec.listeners[*].tls.certificateRefs[*].name".
+	Path string `json:"path"`
+}
+
+// LoadFieldReferencesConfig reads and validates the field references hook configuration (YAML or
+// JSON) from the file at path.
+func LoadFieldReferencesConfig(path string) (*FieldReferencesConfig, error) {
+	b, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFieldReferencesConfig, err)
+	}
+
+	return ParseFieldReferencesConfig(b)
+}
+
+// ParseFieldReferencesConfig parses and validates the field references hook configuration (YAML
+// or JSON) b.
+func ParseFieldReferencesConfig(b []byte) (*FieldReferencesConfig, error) {
+	config := &FieldReferencesConfig{}
+
+	err := yaml.UnmarshalStrict(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFieldReferencesConfig, err)
+	}
+
+	names := map[string]bool{}
+
+	for i := range config.Hooks {
+		hookConfig := &config.Hooks[i]
+
+		_, err = hookConfig.fieldReferences()
+		if err != nil {
+			return nil, err
+		}
+
+		if names[hookConfig.Name] {
+			return nil, fmt.Errorf(
+				"%w: duplicate hook name '%s'",
+				ErrInvalidFieldReferencesConfig,
+				hookConfig.Name,
+			)
+		}
+
+		names[hookConfig.Name] = true
+	}
+
+	return config, nil
+}
+
+// fieldReference is a validated FieldReferenceConfig.
+type fieldReference struct {
+	kind ReferenceableKind
+	path fieldPath
+}
+
+// fieldReferences validates the hook configuration and returns its field references.
+func (c *FieldReferencesHookConfig) fieldReferences() ([]fieldReference, error) {
+	if c.Name == "" || c.APIVersion == "" || c.Kind == "" {
+		return nil, fmt.Errorf(
+			"%w: hooks require a name, apiVersion and kind",
+			ErrInvalidFieldReferencesConfig,
+		)
+	}
+
+	_, err := schema.ParseGroupVersion(c.APIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%w: hook '%s': %s", ErrInvalidFieldReferencesConfig, c.Name, err)
+	}
+
+	if len(c.References) == 0 {
+		return nil, fmt.Errorf(
+			"%w: hook '%s' has no references",
+			ErrInvalidFieldReferencesConfig,
+			c.Name,
+		)
+	}
+
+	var refs []fieldReference
+
+	for _, refConfig := range c.References {
+		kind, ok := GetKind(refConfig.Kind)
+		if !ok {
+			return nil, fmt.Errorf(
+				"%w: hook '%s' references unknown kind '%s'",
+				ErrInvalidFieldReferencesConfig,
+				c.Name,
+				refConfig.Kind,
+			)
+		}
+
+		path, err := parseFieldPath(refConfig.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: hook '%s': %s", ErrInvalidFieldReferencesConfig, c.Name, err)
+		}
+
+		refs = append(refs, fieldReference{kind: kind, path: path})
+	}
+
+	return refs, nil
+}
+
+// NewFieldReferencesMutator returns a Mutator for the field references hook configuration
+// config, it prefers objects from the parent namespace over those created by/from the vcluster
+// itself for the configured fields of any kind of object, for example the secretName of
+// cert-manager certificates or the certificateRefs of gateway listeners. The skip and dry run
+// annotations and the enabled kinds are honored as for pods. The name of the Mutator is the name
+// of the hook configuration.
+func NewFieldReferencesMutator(
+	opts *Options,
+	config *FieldReferencesHookConfig,
+) (Mutator, error) {
+	refs, err := config.fieldReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var kinds []ReferenceableKind
+
+	seen := map[string]bool{}
+
+	for _, ref := range refs {
+		if seen[ref.kind.Name()] {
+			continue
+		}
+
+		seen[ref.kind.Name()] = true
+
+		kinds = append(kinds, ref.kind)
+	}
+
+	namedOpts := *opts
+	namedOpts.Name = config.Name
+
+	m := &fieldReferencesMutator{
+		referenceMutator: newReferenceMutator(&namedOpts, kinds...),
+		gvk:              schema.FromAPIVersionAndKind(config.APIVersion, config.Kind),
+	}
+
+	// only keep the references of kinds that are enabled
+	for _, ref := range refs {
+		for _, kind := range m.kinds {
+			if kind.Name() == ref.kind.Name() {
+				m.refs = append(m.refs, ref)
+
+				break
+			}
+		}
+	}
+
+	return m, nil
+}
+
+type fieldReferencesMutator struct {
+	*referenceMutator
+
+	gvk  schema.GroupVersionKind
+	refs []fieldReference
+}
+
+// Resource returns the type of resource the Mutator mutates.
+func (m *fieldReferencesMutator) Resource() ctrlruntimeclient.Object {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(m.gvk)
+
+	return obj
+}
+
+// Mutate rewrites the configured fields of the object being created to the objects of the parent
+// namespace where possible.
+func (m *fieldReferencesMutator) Mutate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (*Result, error) {
+	return collectDecisions(ctx, obj, func(ctx context.Context) error {
+		return m.mutate(ctx, obj)
+	})
+}
+
+// MutateUpdate mutates objects being updated the same as objects being created, the mutated by
+// annotation lists the mutator once however often the object is updated.
+func (m *fieldReferencesMutator) MutateUpdate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (*Result, error) {
+	return m.Mutate(ctx, obj)
+}
+
+func (m *fieldReferencesMutator) mutate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		m.log.Errorf("mutate object is not unstructured")
+
+		return fmt.Errorf("%w: object %v is not unstructured", ErrWrongResourceType, obj)
+	}
+
+	refs, locations := m.findFieldReferences(u)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	resolved, err := m.resolveFieldReferences(ctx, u, refs)
+	if err != nil {
+		return err
+	}
+
+	plan, err := m.planParents(ctx, u, resolved)
+	if err != nil {
+		return err
+	}
+
+	MutateAnnotations(u, m.name)
+
+	var dryRunSubstitutions []Substitution
+
+	for _, ref := range plan {
+		ref := ref
+
+		s, ok := m.substitute(u, ref, func() {
+			locations[ref.Field].set(ref.vName)
+		})
+		if !ok {
+			dryRunSubstitutions = append(dryRunSubstitutions, s)
+		}
+	}
+
+	err = m.recordDryRun(u, dryRunSubstitutions)
+	if err != nil {
+		m.log.Errorf("mutate physical failed recording dry run substitutions")
+
+		return err
+	}
+
+	return nil
+}
+
+// findFieldReferences returns the references found in the configured fields of the object u,
+// along with the locations of the fields by their concrete path. The references are marked
+// skipped if the skip annotation of their kind is set on the object.
+func (m *fieldReferencesMutator) findFieldReferences(
+	u *unstructured.Unstructured,
+) ([]*reference, map[string]*fieldLocation) {
+	var refs []*reference
+
+	locations := map[string]*fieldLocation{}
+	skipped := map[string]bool{}
+
+	for _, kind := range m.kinds {
+		skipped[kind.Name()] = m.skipKind(u, kind)
+	}
+
+	for _, fieldRef := range m.refs {
+		kind := fieldRef.kind
+
+		for i, location := range fieldRef.path.find(u.Object) {
+			if location.get() == "" || locations[location.path] != nil {
+				continue
+			}
+
+			locations[location.path] = location
+
+			refs = append(refs, &reference{
+				Reference: Reference{Source: ReferenceSourceField, Index: i, Field: location.path},
+				kind:      kind,
+				pName:     location.get(),
+				skipped:   skipped[kind.Name()],
+			})
+		}
+	}
+
+	return refs, locations
+}
+
+// resolveFieldReferences resolves the virtual names of the refs of the object u and returns the
+// resolved references. Names are reverse translated where possible, otherwise the virtual object
+// is fetched (at most once) and the name in the field of the same path is used.
+func (m *fieldReferencesMutator) resolveFieldReferences(
+	ctx context.Context,
+	u *unstructured.Unstructured,
+	refs []*reference,
+) ([]*reference, error) {
+	var (
+		vObj       *unstructured.Unstructured
+		vObjLoaded bool
+	)
+
+	return m.resolveObjectReferences(
+		ctx,
+		refs,
+		u.GetAnnotations()[VirtualNamespaceAnnotation],
+		func(ref *reference) (string, error) {
+			if !vObjLoaded {
+				var err error
+
+				vObj, err = m.getVirtualObject(ctx, u)
+				if err != nil {
+					return "", err
+				}
+
+				vObjLoaded = true
+			}
+
+			return m.virtualFieldName(vObj, ref), nil
+		},
+	)
+}
+
+// getVirtualObject fetches the virtual object of the physical object u, applying the hooks
+// failure policy. If the lookup fails but the failure policy does not reject the object, or the
+// mutator has no virtual reader, a nil object is returned.
+func (m *fieldReferencesMutator) getVirtualObject(
+	ctx context.Context,
+	u *unstructured.Unstructured,
+) (*unstructured.Unstructured, error) {
+	if m.virtualReader == nil {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{
+		Name:      u.GetAnnotations()[VirtualNameAnnotation],
+		Namespace: u.GetAnnotations()[VirtualNamespaceAnnotation],
+	}
+
+	vObj := &unstructured.Unstructured{}
+	vObj.SetGroupVersionKind(m.gvk)
+
+	err := m.withFailurePolicy(func() error {
+		return m.virtualReader.Get(ctx, key, vObj)
+	})
+	if err != nil {
+		m.log.Errorf("mutate physical failed fetching virtual %s", m.gvk.Kind)
+
+		return nil, m.handleLookupError(&LookupError{
+			Cluster:   LookupClusterVirtual,
+			Kind:      m.gvk.Kind,
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Policy:    m.failurePolicy,
+			Err:       err,
+		})
+	}
+
+	return vObj, nil
+}
+
+// virtualFieldName returns the name in the field of the virtual object vObj at the path of ref if
+// it translates to the physical name of ref, otherwise an empty string.
+func (m *fieldReferencesMutator) virtualFieldName(
+	vObj *unstructured.Unstructured,
+	ref *reference,
+) string {
+	if vObj == nil {
+		return ""
+	}
+
+	for _, fieldRef := range m.refs {
+		if fieldRef.kind.Name() != ref.kind.Name() {
+			continue
+		}
+
+		for _, location := range fieldRef.path.find(vObj.Object) {
+			if location.path != ref.Field {
+				continue
+			}
+
+			vName := location.get()
+
+			if m.physicalName(vName, vObj.GetNamespace()) == ref.pName {
+				return vName
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,478 @@
+package mutator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimeclientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// fuzzNamespaces are the virtual namespaces the fuzzed pods (claim to) live in, the empty
+// namespace is a pod without the virtual namespace annotation.
+func fuzzNamespaces() []string {
+	return []string{"default", "other", ""}
+}
+
+// fuzzNames are the virtual names the fuzzed references and parent objects are named from,
+// including names that look like (parts of) translated names.
+func fuzzNames() []string {
+	return []string{
+		"someobject",
+		"someotherobject",
+		"x",
+		"-x-default-x-",
+		"someobject-x-default-x-vcluster",
+		"a-x-other-x-b",
+		"",
+	}
+}
+
+// fuzzSource generates pod specs and objects from the bytes of a fuzz input, once the input is
+// exhausted every choice is the first option.
+type fuzzSource struct {
+	b []byte
+}
+
+func (s *fuzzSource) intn(n int) int {
+	if len(s.b) == 0 || n <= 0 {
+		return 0
+	}
+
+	v := int(s.b[0])
+	s.b = s.b[1:]
+
+	return v % n
+}
+
+func (s *fuzzSource) bool() bool {
+	return s.intn(2) == 1
+}
+
+func (s *fuzzSource) pick(values []string) string {
+	return values[s.intn(len(values))]
+}
+
+// name returns a reference name as it may appear on a physical pod in the virtual namespace
+// vNamespace: translated from a virtual name, translated from a virtual name in another
+// namespace, or not translated at all.
+func (s *fuzzSource) name(vNamespace string) string {
+	name := s.pick(fuzzNames())
+
+	switch s.intn(3) {
+	case 0:
+		return physicalName(name, vNamespace)
+	case 1:
+		return physicalName(name, s.pick(fuzzNamespaces()))
+	default:
+		return name
+	}
+}
+
+func (s *fuzzSource) envVar(vNamespace string) corev1.EnvVar {
+	env := corev1.EnvVar{Name: s.pick(fuzzNames())}
+
+	switch s.intn(5) {
+	case 0:
+		env.Value = "somevalue"
+	case 1:
+		env.ValueFrom = &corev1.EnvVarSource{}
+	case 2:
+		env.ValueFrom = &corev1.EnvVarSource{
+			ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+				Key:                  s.pick(fuzzNames()),
+			},
+		}
+	case 3:
+		env.ValueFrom = &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+				Key:                  s.pick(fuzzNames()),
+			},
+		}
+	default:
+		env.ValueFrom = &corev1.EnvVarSource{
+			FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+		}
+	}
+
+	return env
+}
+
+func (s *fuzzSource) envFrom(vNamespace string) corev1.EnvFromSource {
+	envFrom := corev1.EnvFromSource{Prefix: s.pick(fuzzNames())}
+
+	switch s.intn(3) {
+	case 0:
+		envFrom.ConfigMapRef = &corev1.ConfigMapEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+		}
+	case 1:
+		envFrom.SecretRef = &corev1.SecretEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+		}
+	}
+
+	return envFrom
+}
+
+func (s *fuzzSource) container(vNamespace string) corev1.Container {
+	container := corev1.Container{Name: s.pick(fuzzNames())}
+
+	for i := s.intn(4); i > 0; i-- {
+		container.Env = append(container.Env, s.envVar(vNamespace))
+	}
+
+	for i := s.intn(3); i > 0; i-- {
+		container.EnvFrom = append(container.EnvFrom, s.envFrom(vNamespace))
+	}
+
+	return container
+}
+
+func (s *fuzzSource) keyToPaths() []corev1.KeyToPath {
+	var items []corev1.KeyToPath
+
+	for i := s.intn(3); i > 0; i-- {
+		items = append(items, corev1.KeyToPath{Key: s.pick(fuzzNames()), Path: "somepath"})
+	}
+
+	return items
+}
+
+func (s *fuzzSource) volume(vNamespace string) corev1.Volume {
+	vol := corev1.Volume{Name: s.pick(fuzzNames())}
+
+	switch s.intn(6) {
+	case 0:
+		vol.EmptyDir = &corev1.EmptyDirVolumeSource{}
+	case 1:
+		vol.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+			Items:                s.keyToPaths(),
+		}
+	case 2:
+		vol.Secret = &corev1.SecretVolumeSource{
+			SecretName: s.name(vNamespace),
+			Items:      s.keyToPaths(),
+		}
+	case 3:
+		vol.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+			ClaimName: s.name(vNamespace),
+		}
+	case 4:
+		vol.Projected = &corev1.ProjectedVolumeSource{}
+
+		for i := s.intn(4); i > 0; i-- {
+			vol.Projected.Sources = append(vol.Projected.Sources, s.projection(vNamespace))
+		}
+	default:
+		vol.VolumeSource = corev1.VolumeSource{}
+	}
+
+	return vol
+}
+
+func (s *fuzzSource) projection(vNamespace string) corev1.VolumeProjection {
+	switch s.intn(3) {
+	case 0:
+		return corev1.VolumeProjection{
+			ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+				Items:                s.keyToPaths(),
+			},
+		}
+	case 1:
+		return corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{Name: s.name(vNamespace)},
+				Items:                s.keyToPaths(),
+			},
+		}
+	default:
+		return corev1.VolumeProjection{
+			ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+				Audience: s.pick(fuzzNames()),
+			},
+		}
+	}
+}
+
+func (s *fuzzSource) podSpec(vNamespace string) corev1.PodSpec {
+	spec := corev1.PodSpec{}
+
+	if s.bool() {
+		spec.ServiceAccountName = s.name(vNamespace)
+	}
+
+	for i := s.intn(3); i > 0; i-- {
+		spec.Containers = append(spec.Containers, s.container(vNamespace))
+	}
+
+	for i := s.intn(2); i > 0; i-- {
+		spec.InitContainers = append(spec.InitContainers, s.container(vNamespace))
+	}
+
+	for i := s.intn(2); i > 0; i-- {
+		spec.EphemeralContainers = append(spec.EphemeralContainers, corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon(s.container(vNamespace)),
+		})
+	}
+
+	for i := s.intn(4); i > 0; i-- {
+		spec.Volumes = append(spec.Volumes, s.volume(vNamespace))
+	}
+
+	for i := s.intn(3); i > 0; i-- {
+		spec.ImagePullSecrets = append(
+			spec.ImagePullSecrets,
+			corev1.LocalObjectReference{Name: s.name(vNamespace)},
+		)
+	}
+
+	return spec
+}
+
+// pods returns a physical pod and its virtual pod, generated independently so that their specs
+// are generally not aligned.
+func (s *fuzzSource) pods() (pod, vPod *corev1.Pod) {
+	vNamespace := s.pick(fuzzNamespaces())
+
+	pod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      physicalName("somepod", vNamespace),
+			Namespace: "host",
+			Annotations: map[string]string{
+				mutator.VirtualNameAnnotation:      "somepod",
+				mutator.VirtualNamespaceAnnotation: vNamespace,
+			},
+		},
+		Spec: s.podSpec(vNamespace),
+	}
+
+	vPod = &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "somepod", Namespace: vNamespace},
+		Spec:       s.podSpec(""),
+	}
+
+	return pod, vPod
+}
+
+// parentObjs returns the parent objects of every kind for a random subset of the fuzzNames.
+func (s *fuzzSource) parentObjs() []runtime.Object {
+	var objs []runtime.Object
+
+	for _, name := range fuzzNames() {
+		if name == "" || !s.bool() {
+			continue
+		}
+
+		meta := metav1.ObjectMeta{Name: name, Namespace: "host"}
+		data := map[string]string{s.pick(fuzzNames()): "somevalue"}
+
+		objs = append(
+			objs,
+			&corev1.ConfigMap{ObjectMeta: meta, Data: data},
+			&corev1.Secret{ObjectMeta: meta, StringData: data},
+			&corev1.PersistentVolumeClaim{
+				ObjectMeta: meta,
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+				},
+			},
+			&corev1.ServiceAccount{ObjectMeta: meta},
+		)
+	}
+
+	return objs
+}
+
+func fuzzKinds() []mutator.ReferenceableKind {
+	return []mutator.ReferenceableKind{
+		mutator.ConfigMapKind{},
+		mutator.SecretKind{},
+		mutator.PersistentVolumeClaimKind{ForceReadOnly: true},
+		mutator.ServiceAccountKind{Allowed: fuzzNames()[:2], TokenAudiences: fuzzNames()},
+	}
+}
+
+func fuzzSeeds() [][]byte {
+	return [][]byte{
+		{},
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 1, 2, 3, 2, 2, 0, 3, 1, 1, 2, 4, 0, 2, 1, 3, 1, 0, 0, 1},
+		{2, 0, 2, 2, 3, 3, 0, 0, 3, 1, 1, 0, 2, 4, 5, 1, 0, 1, 3, 0, 1, 1},
+	}
+}
+
+func FuzzFindReferences(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		s := &fuzzSource{b: b}
+		spec := s.podSpec(s.pick(fuzzNamespaces()))
+
+		for _, kind := range fuzzKinds() {
+			for _, ref := range kind.FindReferences(&spec) {
+				ref := ref
+
+				name := kind.GetName(&spec, &ref)
+
+				kind.SetName(&spec, &ref, name+"-renamed")
+
+				if actual := kind.GetName(&spec, &ref); actual != name+"-renamed" {
+					t.Fatalf(
+						"%s: set name did not rename reference %v, actual: %s",
+						kind.Name(),
+						ref,
+						actual,
+					)
+				}
+
+				kind.SetName(&spec, &ref, name)
+			}
+		}
+	})
+}
+
+// referenceNames returns the names of the references of every kind in spec, by kind.
+func referenceNames(spec *corev1.PodSpec) map[string][]string {
+	names := map[string][]string{}
+
+	for _, kind := range fuzzKinds() {
+		for _, ref := range kind.FindReferences(spec) {
+			ref := ref
+
+			names[kind.Name()] = append(names[kind.Name()], kind.GetName(spec, &ref))
+		}
+	}
+
+	return names
+}
+
+func FuzzPodMutator(f *testing.F) {
+	for _, seed := range fuzzSeeds() {
+		f.Add(seed, true)
+		f.Add(seed, false)
+	}
+
+	scheme := newScheme()
+
+	f.Fuzz(func(t *testing.T, b []byte, withVirtualPod bool) {
+		s := &fuzzSource{b: b}
+		pod, vPod := s.pods()
+		parentObjs := s.parentObjs()
+
+		parentClient := ctrlruntimeclientfake.NewClientBuilder().
+			WithScheme(scheme).
+			WithRuntimeObjects(parentObjs...).
+			Build()
+
+		virtualClient := ctrlruntimeclientfake.NewClientBuilder().WithScheme(scheme)
+		if withVirtualPod && vPod.Namespace != "" {
+			virtualClient = virtualClient.WithRuntimeObjects(vPod)
+		}
+
+		opts := &mutator.Options{
+			Name:                 "some-mutator",
+			ParentNamespace:      "host",
+			ParentMetadataReader: parentClient,
+			ParentReader:         parentClient,
+			VirtualReader:        virtualClient.Build(),
+			PhysicalName:         physicalName,
+		}
+
+		m := mutator.NewPodMutator(opts, fuzzKinds()...)
+
+		in := pod.DeepCopy()
+
+		result, err := m.Mutate(context.Background(), pod)
+		if err != nil {
+			if !cmp.Equal(pod, in) {
+				t.Fatalf(
+					"%s: pod changed although mutating failed, error: %s\n%s",
+					m.Name(),
+					err,
+					cmp.Diff(in, pod),
+				)
+			}
+
+			return
+		}
+
+		out, ok := result.Object.(*corev1.Pod)
+		if !ok {
+			t.Fatalf("%s: mutated object is not a pod", m.Name())
+		}
+
+		checkRewrittenNames(t, in, out, parentClient)
+	})
+}
+
+// checkRewrittenNames asserts that the references of the pod out are those of the pod in, and
+// that every rewritten reference refers to an existing parent object whose translated name is
+// the name it replaced.
+func checkRewrittenNames(
+	t *testing.T,
+	in, out *corev1.Pod,
+	parentReader ctrlruntimeclient.Reader,
+) {
+	t.Helper()
+
+	vNamespace := in.Annotations[mutator.VirtualNamespaceAnnotation]
+	inNames := referenceNames(&in.Spec)
+	outNames := referenceNames(&out.Spec)
+
+	for _, kind := range fuzzKinds() {
+		if len(inNames[kind.Name()]) != len(outNames[kind.Name()]) {
+			t.Fatalf(
+				"%s: references changed\nin: %v\nout: %v",
+				kind.Name(),
+				inNames[kind.Name()],
+				outNames[kind.Name()],
+			)
+		}
+
+		for i, inName := range inNames[kind.Name()] {
+			outName := outNames[kind.Name()][i]
+			if outName == inName {
+				continue
+			}
+
+			if physicalName(outName, vNamespace) != inName {
+				t.Fatalf(
+					"%s: reference '%s' rewritten to '%s', which does not translate to it",
+					kind.Name(),
+					inName,
+					outName,
+				)
+			}
+
+			obj := &metav1.PartialObjectMetadata{}
+			obj.SetGroupVersionKind(kind.GroupVersionKind())
+
+			err := parentReader.Get(
+				context.Background(),
+				ctrlruntimeclient.ObjectKey{Namespace: "host", Name: outName},
+				obj,
+			)
+			if err != nil {
+				t.Fatalf(
+					"%s: reference '%s' rewritten to missing parent object '%s'",
+					kind.Name(),
+					inName,
+					outName,
+				)
+			}
+		}
+	}
+}
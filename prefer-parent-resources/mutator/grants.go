@@ -0,0 +1,416 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// GrantLabel is the label that marks configmaps in the host namespace as holding a
+	// ParentResourceGrant, the label value must be "true".
+	GrantLabel = "prefer-parent/grant"
+	// GrantDataKey is the key of grant configmaps holding the ParentResourceGrant as YAML (or
+	// JSON).
+	GrantDataKey = "grant.yaml"
+
+	// MutationOutcomeDenied is the outcome label value recorded when the hook requires grants and
+	// no grant allows the object being mutated to consume the parent object, so the reference
+	// keeps pointing at the virtual object.
+	MutationOutcomeDenied = "denied"
+
+	// DeniedEventReason is the reason of the events recorded on virtual objects for parent
+	// objects they were denied, by grants or by the restrictions of the parent object.
+	DeniedEventReason = "PreferParentDenied"
+
+	grantWildcard = "*"
+)
+
+// ParentResourceGrant declares which virtual namespaces, and optionally which objects (by label
+// selector), may consume which parent objects. Grants are stored in configmaps in the host
+// namespace labelled with GrantLabel, under the GrantDataKey key. Mutators only check grants if
+// Options RequireGrants is set -- for the hooks this is their "REQUIRE_GRANTS" setting, for
+// example "PREFER_PARENT_RESOURCES_HOOK_REQUIRE_GRANTS" -- in which case a parent object is only
+// substituted if a grant allows it.
+type ParentResourceGrant struct {
+	// Name is the name of the configmap holding the grant, it is set when the grant is loaded.
+	Name string `json:"-"`
+	// Resources are the parent objects the grant allows consuming.
+	Resources []GrantResource `json:"resources"`
+	// Namespaces are the virtual namespaces the grant applies to, "*" matches every namespace.
+	Namespaces []string `json:"namespaces"`
+	// Selector optionally restricts the grant to the consuming objects (generally pods) whose
+	// labels it matches.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// GrantResource selects parent objects of a kind by name.
+type GrantResource struct {
+	// Kind is the name of the ReferenceableKind of the parent objects, for example "secret".
+	Kind string `json:"kind"`
+	// Names are the names of the parent objects, "*" matches every name.
+	Names []string `json:"names"`
+}
+
+// ParseParentResourceGrant parses the ParentResourceGrant b (YAML or JSON).
+func ParseParentResourceGrant(b []byte) (*ParentResourceGrant, error) {
+	grant := &ParentResourceGrant{}
+
+	err := yaml.UnmarshalStrict(b, grant)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGrant, err)
+	}
+
+	if grant.Selector != nil {
+		_, err = metav1.LabelSelectorAsSelector(grant.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidGrant, err)
+		}
+	}
+
+	return grant, nil
+}
+
+// coversResource returns true if the grant allows consuming the parent object name of kind.
+func (g *ParentResourceGrant) coversResource(kind, name string) bool {
+	for _, resource := range g.Resources {
+		if resource.Kind == kind &&
+			(containsString(resource.Names, grantWildcard) || containsString(resource.Names, name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// coversNamespace returns true if the grant applies to the virtual namespace.
+func (g *ParentResourceGrant) coversNamespace(namespace string) bool {
+	return containsString(g.Namespaces, grantWildcard) || containsString(g.Namespaces, namespace)
+}
+
+// selects returns true if the grant has no selector or its selector matches the labels of the
+// physical object obj. The keys of the selector are virtual label keys, they are translated with
+// labelKey before matching.
+func (g *ParentResourceGrant) selects(
+	obj ctrlruntimeclient.Object,
+	labelKey PhysicalLabelKeyFunc,
+) bool {
+	if g.Selector == nil {
+		return true
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(g.Selector)
+	if err != nil {
+		return false
+	}
+
+	selector, err = physicalSelector(selector, labelKey)
+	if err != nil {
+		return false
+	}
+
+	return selector.Matches(labels.Set(obj.GetLabels()))
+}
+
+// grantSet is the set of grants loaded from the host namespace.
+type grantSet []*ParentResourceGrant
+
+// allows returns true if a grant allows the object obj, in the virtual namespace vNamespace, to
+// consume the parent object name of kind. If not, the reason it was denied is returned.
+func (s grantSet) allows(
+	kind, name, vNamespace string,
+	obj ctrlruntimeclient.Object,
+	labelKey PhysicalLabelKeyFunc,
+) (bool, string) {
+	var resourceGrants, namespaceGrants []string
+
+	for _, grant := range s {
+		if !grant.coversResource(kind, name) {
+			continue
+		}
+
+		resourceGrants = append(resourceGrants, grant.Name)
+
+		if !grant.coversNamespace(vNamespace) {
+			continue
+		}
+
+		namespaceGrants = append(namespaceGrants, grant.Name)
+
+		if grant.selects(obj, labelKey) {
+			return true, ""
+		}
+	}
+
+	switch {
+	case len(resourceGrants) == 0:
+		return false, fmt.Sprintf("no grant covers %s '%s'", kind, name)
+	case len(namespaceGrants) == 0:
+		return false, fmt.Sprintf(
+			"grant(s) %s covering %s '%s' do not include namespace '%s'",
+			strings.Join(resourceGrants, ", "),
+			kind,
+			name,
+			vNamespace,
+		)
+	default:
+		return false, fmt.Sprintf(
+			"grant(s) %s covering %s '%s' in namespace '%s' do not select the labels of '%s'",
+			strings.Join(namespaceGrants, ", "),
+			kind,
+			name,
+			vNamespace,
+			obj.GetAnnotations()[VirtualNameAnnotation],
+		)
+	}
+}
+
+// GrantCache caches the grants parsed from grant configmaps by the resource version of the
+// configmaps, so that grant configmaps are only read in full when they change. A GrantCache may
+// be shared by the mutators of any number of host namespaces.
+type GrantCache struct {
+	mu         sync.Mutex
+	namespaces map[string]map[string]cachedGrant
+}
+
+// cachedGrant is the grant parsed from the grant configmap at resourceVersion, or the error
+// parsing it.
+type cachedGrant struct {
+	resourceVersion string
+	grant           *ParentResourceGrant
+	err             error
+}
+
+// NewGrantCache returns an empty GrantCache.
+func NewGrantCache() *GrantCache {
+	return &GrantCache{namespaces: map[string]map[string]cachedGrant{}}
+}
+
+// loadGrants lists the metadata of the grant configmaps in the physical namespace and returns the
+// grants they hold, sorted by name. The metadata is listed through the parent metadata reader,
+// so that the manager cache does not hold the data of every configmap of the host namespace, and
+// only the grant configmaps not yet cached at their current resource version are read in full.
+// Configmaps holding invalid grants are logged and ignored, which denies whatever they were meant
+// to allow.
+func (m *referenceMutator) loadGrants(ctx context.Context) (grantSet, error) {
+	configMaps := &metav1.PartialObjectMetadataList{}
+	configMaps.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMapList"))
+
+	err := m.parentMetadataReader.List(
+		ctx,
+		configMaps,
+		ctrlruntimeclient.InNamespace(m.physicalNamespace),
+		ctrlruntimeclient.MatchingLabels{GrantLabel: "true"},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	m.grantCache.mu.Lock()
+	defer m.grantCache.mu.Unlock()
+
+	cached := m.grantCache.namespaces[m.physicalNamespace]
+	current := make(map[string]cachedGrant, len(configMaps.Items))
+
+	var grants grantSet
+
+	for i := range configMaps.Items {
+		meta := &configMaps.Items[i]
+
+		entry, ok := cached[meta.Name]
+		if !ok || entry.resourceVersion != meta.ResourceVersion {
+			entry, err = m.readGrant(ctx, meta.Name)
+			if apimachineryerrors.IsNotFound(err) {
+				// deleted since it was listed
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		current[meta.Name] = entry
+
+		if entry.err != nil {
+			continue
+		}
+
+		grants = append(grants, entry.grant)
+	}
+
+	m.grantCache.namespaces[m.physicalNamespace] = current
+
+	sort.Slice(grants, func(i, j int) bool {
+		return grants[i].Name < grants[j].Name
+	})
+
+	return grants, nil
+}
+
+// readGrant reads the grant configmap name from the physical namespace and parses its grant.
+// Errors reading the configmap are returned, invalid grants are logged and returned as the error
+// of the cached grant.
+func (m *referenceMutator) readGrant(ctx context.Context, name string) (cachedGrant, error) {
+	configMap := &corev1.ConfigMap{}
+
+	err := m.parentReader.Get(
+		ctx,
+		types.NamespacedName{Namespace: m.physicalNamespace, Name: name},
+		configMap,
+	)
+	if err != nil {
+		return cachedGrant{}, err
+	}
+
+	entry := cachedGrant{resourceVersion: configMap.ResourceVersion}
+
+	entry.grant, entry.err = ParseParentResourceGrant([]byte(configMap.Data[GrantDataKey]))
+	if entry.err != nil {
+		m.log.Errorf(
+			"ignoring invalid grant configmap '%s/%s', error: '%s'",
+			configMap.Namespace,
+			configMap.Name,
+			entry.err,
+		)
+
+		return entry, nil
+	}
+
+	entry.grant.Name = configMap.Name
+
+	return entry, nil
+}
+
+// requiredGrants returns the grants to check the references of the object being mutated against, or
+// nil grants if the hook does not require grants. If loading the grants fails the hooks failure
+// policy is applied, when failing open empty grants are returned, which deny every parent object.
+func (m *referenceMutator) requiredGrants(ctx context.Context) (grantSet, error) {
+	if !m.requireGrants {
+		return nil, nil
+	}
+
+	var grants grantSet
+
+	err := m.withFailurePolicy(func() error {
+		var err error
+
+		grants, err = m.loadGrants(ctx)
+
+		return err
+	})
+	if err != nil {
+		m.log.Errorf("failed loading grants")
+
+		err = m.handleLookupError(&LookupError{
+			Cluster:   LookupClusterParent,
+			Kind:      "grant",
+			Namespace: m.physicalNamespace,
+			Policy:    m.failurePolicy,
+			Err:       err,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if grants == nil {
+		grants = grantSet{}
+	}
+
+	return grants, nil
+}
+
+// grantDeniedReason returns the reason the grants deny the object obj the parent object of the
+// group, or an empty string if the hook does not require grants or the grants allow it. Denials
+// are logged, recorded for every reference of the group, and recorded as an event on the virtual
+// object.
+func (m *referenceMutator) grantDeniedReason(
+	grants grantSet,
+	obj ctrlruntimeclient.Object,
+	group *parentGroup,
+) string {
+	if grants == nil {
+		return ""
+	}
+
+	vNamespace := obj.GetAnnotations()[VirtualNamespaceAnnotation]
+
+	ok, reason := grants.allows(group.kind.Name(), group.vName, vNamespace, obj, m.physicalLabelKey)
+	if ok {
+		return ""
+	}
+
+	m.denyParent(obj, group, reason)
+
+	return reason
+}
+
+// denyParent logs the reason the object obj was denied the parent object of the group, records
+// the outcome for every reference of the group, and records an event on the virtual object.
+func (m *referenceMutator) denyParent(
+	obj ctrlruntimeclient.Object,
+	group *parentGroup,
+	reason string,
+) {
+	m.log.Infof(
+		"host cluster %s '%s/%s' denied to '%s/%s', skipping... reason: '%s'",
+		group.kind.Name(),
+		m.physicalNamespace,
+		group.vName,
+		obj.GetAnnotations()[VirtualNamespaceAnnotation],
+		obj.GetAnnotations()[VirtualNameAnnotation],
+		reason,
+	)
+
+	for range group.refs {
+		m.recordMutation(group.kind, MutationOutcomeDenied)
+	}
+
+	m.recordVirtualEvent(
+		obj,
+		corev1.EventTypeWarning,
+		DeniedEventReason,
+		fmt.Sprintf("not using host cluster %s '%s': %s", group.kind.Name(), group.vName, reason),
+	)
+}
+
+// recordVirtualEvent records an event on the virtual object of the physical object obj.
+func (m *referenceMutator) recordVirtualEvent(
+	obj ctrlruntimeclient.Object,
+	eventType, reason, message string,
+) {
+	if m.recorder == nil || m.scheme == nil {
+		return
+	}
+
+	gvk, err := apiutil.GVKForObject(obj, m.scheme)
+	if err != nil {
+		m.log.Debugf("cannot record event, unknown kind of object %v", obj)
+
+		return
+	}
+
+	m.recorder.Event(
+		&corev1.ObjectReference{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+			Name:       obj.GetAnnotations()[VirtualNameAnnotation],
+			Namespace:  obj.GetAnnotations()[VirtualNamespaceAnnotation],
+		},
+		eventType,
+		reason,
+		message,
+	)
+}
@@ -0,0 +1,283 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// IngressTLSSecretsHookName is the name of the hook (and Mutator) that substitutes the tls
+	// secrets of ingresses.
+	IngressTLSSecretsHookName = "prefer-parent-ingress-tls-secrets-hook"
+
+	// SkipPreferIngressTLSSecretsHook is the ingress annotation key that, if any value is set, will
+	// cause this plugin to skip preferring the parent (physical/real) tls secrets of the ingress.
+	SkipPreferIngressTLSSecretsHook = "skip-prefer-parent-ingress-tls-secrets-hook"
+
+	// DryRunPreferIngressTLSSecretsHook is the ingress annotation key that, if set to "true" or
+	// "false", overrides the hooks dry run setting for the ingress.
+	DryRunPreferIngressTLSSecretsHook = "dry-run-prefer-parent-ingress-tls-secrets-hook"
+
+	// ReferenceSourceIngressTLS is the ReferenceSource of the secrets referenced by the tls
+	// entries of an ingress, the Reference Index is the index of the tls entry.
+	ReferenceSourceIngressTLS ReferenceSource = "tls"
+)
+
+// TLSSecretKind is the ReferenceableKind of the tls secrets referenced by ingresses. It is not
+// referenced by pods, it only exists to look up parent tls secrets.
+type TLSSecretKind struct {
+	SecretKind
+}
+
+// HookName returns the name of the hook that mutates tls secrets.
+func (TLSSecretKind) HookName() string {
+	return IngressTLSSecretsHookName
+}
+
+// SkipAnnotation returns the ingress tls secret skip annotation key.
+func (TLSSecretKind) SkipAnnotation() string {
+	return SkipPreferIngressTLSSecretsHook
+}
+
+// DryRunAnnotation returns the ingress tls secret dry run annotation key.
+func (TLSSecretKind) DryRunAnnotation() string {
+	return DryRunPreferIngressTLSSecretsHook
+}
+
+// FindReferences returns nil, pods do not reference tls secrets.
+func (TLSSecretKind) FindReferences(podSpec *corev1.PodSpec) []Reference {
+	_ = podSpec
+
+	return nil
+}
+
+// ValidateParent returns an error if the secret obj is not of type kubernetes.io/tls.
+func (TLSSecretKind) ValidateParent(obj ctrlruntimeclient.Object) error {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return fmt.Errorf("%w: object %v is not a secret", ErrWrongResourceType, obj)
+	}
+
+	if secret.Type != corev1.SecretTypeTLS {
+		return fmt.Errorf(
+			"%w: secret type '%s' is not '%s'",
+			ErrParentNotEligible,
+			secret.Type,
+			corev1.SecretTypeTLS,
+		)
+	}
+
+	return nil
+}
+
+// NewIngressTLSSecretsMutator returns a Mutator that prefers tls secrets from the parent namespace
+// over those created by/from the vcluster itself for the tls entries of ingresses.
+func NewIngressTLSSecretsMutator(opts *Options) Mutator {
+	return &ingressTLSSecretsMutator{
+		referenceMutator: newReferenceMutator(opts, TLSSecretKind{}),
+	}
+}
+
+type ingressTLSSecretsMutator struct {
+	*referenceMutator
+}
+
+// Resource returns the type of resource the Mutator mutates.
+func (m *ingressTLSSecretsMutator) Resource() ctrlruntimeclient.Object {
+	return &networkingv1.Ingress{}
+}
+
+// Mutate rewrites the tls secret names of the ingress being created to the secrets of the parent
+// namespace where possible.
+func (m *ingressTLSSecretsMutator) Mutate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (*Result, error) {
+	return collectDecisions(ctx, obj, func(ctx context.Context) error {
+		return m.mutate(ctx, obj)
+	})
+}
+
+// MutateUpdate mutates ingresses being updated. Unlike pods the tls entries of ingresses can
+// change, so updates are mutated the same as creates, the mutated by annotation lists the mutator
+// once however often the ingress is updated.
+func (m *ingressTLSSecretsMutator) MutateUpdate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (*Result, error) {
+	return m.Mutate(ctx, obj)
+}
+
+func (m *ingressTLSSecretsMutator) mutate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) error {
+	ingress, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		m.log.Errorf("mutate object is not an ingress")
+
+		return fmt.Errorf("%w: object %v is not an ingress", ErrWrongResourceType, obj)
+	}
+
+	refs := m.findIngressReferences(ingress)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	resolved, err := m.resolveIngressReferences(ctx, ingress, refs)
+	if err != nil {
+		return err
+	}
+
+	plan, err := m.planParents(ctx, ingress, resolved)
+	if err != nil {
+		return err
+	}
+
+	MutateAnnotations(ingress, m.name)
+
+	var dryRunSubstitutions []Substitution
+
+	for _, ref := range plan {
+		ref := ref
+
+		s, ok := m.substitute(ingress, ref, func() {
+			ingress.Spec.TLS[ref.Index].SecretName = ref.vName
+		})
+		if !ok {
+			dryRunSubstitutions = append(dryRunSubstitutions, s)
+		}
+	}
+
+	err = m.recordDryRun(ingress, dryRunSubstitutions)
+	if err != nil {
+		m.log.Errorf("mutate physical failed recording dry run substitutions")
+
+		return err
+	}
+
+	return nil
+}
+
+// findIngressReferences returns the references of the tls entries of the ingress to secrets,
+// unless the hooks kind is disabled. The references are marked skipped if the skip annotation of
+// the kind is set on the ingress.
+func (m *ingressTLSSecretsMutator) findIngressReferences(
+	ingress *networkingv1.Ingress,
+) []*reference {
+	var refs []*reference
+
+	for _, kind := range m.kinds {
+		skipped := m.skipKind(ingress, kind)
+
+		for i := range ingress.Spec.TLS {
+			if ingress.Spec.TLS[i].SecretName == "" {
+				continue
+			}
+
+			refs = append(refs, &reference{
+				Reference: Reference{Source: ReferenceSourceIngressTLS, Index: i},
+				kind:      kind,
+				pName:     ingress.Spec.TLS[i].SecretName,
+				skipped:   skipped,
+			})
+		}
+	}
+
+	return refs
+}
+
+// resolveIngressReferences resolves the virtual names of the refs of the ingress and returns the
+// resolved references. Names are reverse translated where possible, otherwise the virtual ingress
+// is fetched (at most once) and the name of the tls entry at the same index is used.
+func (m *ingressTLSSecretsMutator) resolveIngressReferences(
+	ctx context.Context,
+	ingress *networkingv1.Ingress,
+	refs []*reference,
+) ([]*reference, error) {
+	var (
+		vIngress       *networkingv1.Ingress
+		vIngressLoaded bool
+	)
+
+	return m.resolveObjectReferences(
+		ctx,
+		refs,
+		ingress.Annotations[VirtualNamespaceAnnotation],
+		func(ref *reference) (string, error) {
+			if !vIngressLoaded {
+				var err error
+
+				vIngress, err = m.getVirtualIngress(ctx, ingress)
+				if err != nil {
+					return "", err
+				}
+
+				vIngressLoaded = true
+			}
+
+			return m.virtualTLSSecretName(vIngress, ref), nil
+		},
+	)
+}
+
+// getVirtualIngress fetches the virtual ingress of the physical ingress, applying the hooks
+// failure policy. If the lookup fails but the failure policy does not reject the ingress, or the
+// mutator has no virtual reader, a nil ingress is returned.
+func (m *ingressTLSSecretsMutator) getVirtualIngress(
+	ctx context.Context,
+	ingress *networkingv1.Ingress,
+) (*networkingv1.Ingress, error) {
+	if m.virtualReader == nil {
+		return nil, nil
+	}
+
+	key := types.NamespacedName{
+		Name:      ingress.Annotations[VirtualNameAnnotation],
+		Namespace: ingress.Annotations[VirtualNamespaceAnnotation],
+	}
+
+	vIngress := &networkingv1.Ingress{}
+
+	err := m.withFailurePolicy(func() error {
+		return m.virtualReader.Get(ctx, key, vIngress)
+	})
+	if err != nil {
+		m.log.Errorf("mutate physical failed fetching virtual ingress")
+
+		return nil, m.handleLookupError(&LookupError{
+			Cluster:   LookupClusterVirtual,
+			Kind:      "ingress",
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Policy:    m.failurePolicy,
+			Err:       err,
+		})
+	}
+
+	return vIngress, nil
+}
+
+// virtualTLSSecretName returns the secret name of the tls entry of the virtual ingress aligned
+// with ref if it translates to the physical name of ref, otherwise an empty string.
+func (m *ingressTLSSecretsMutator) virtualTLSSecretName(
+	vIngress *networkingv1.Ingress,
+	ref *reference,
+) string {
+	if vIngress == nil || ref.Index >= len(vIngress.Spec.TLS) {
+		return ""
+	}
+
+	vName := vIngress.Spec.TLS[ref.Index].SecretName
+
+	if m.physicalName(vName, vIngress.Namespace) != ref.pName {
+		return ""
+	}
+
+	return vName
+}
@@ -0,0 +1,192 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReferenceSource is the part of a pod spec a Reference is found in. Kinds referenced from other
+// parts of the pod spec may define their own sources.
+type ReferenceSource string
+
+const (
+	// ReferenceSourceEnv is the ReferenceSource of references found in container environment
+	// variables.
+	ReferenceSourceEnv ReferenceSource = "env"
+	// ReferenceSourceEnvFrom is the ReferenceSource of references found in container environment
+	// sources (envFrom).
+	ReferenceSourceEnvFrom ReferenceSource = "envFrom"
+	// ReferenceSourceVolume is the ReferenceSource of references found in pod volumes.
+	ReferenceSourceVolume ReferenceSource = "volume"
+	// ReferenceSourceProjection is the ReferenceSource of references found in the sources of
+	// projected pod volumes.
+	ReferenceSourceProjection ReferenceSource = "projection"
+	// ReferenceSourceImagePullSecret is the ReferenceSource of references found in the image pull
+	// secrets of pods.
+	ReferenceSourceImagePullSecret ReferenceSource = "imagePullSecret"
+)
+
+// Reference locates a single reference by name from a pod spec to an object of a
+// ReferenceableKind. References are only meaningful for the pod spec (and kind) that returned
+// them.
+type Reference struct {
+	// Source is the part of the pod spec the reference is found in.
+	Source ReferenceSource
+	// ContainerType, ContainerIndex and Container are the container list, the index in it and the
+	// name of the container of ReferenceSourceEnv and ReferenceSourceEnvFrom references. An empty
+	// ContainerType is the ContainerTypeContainer.
+	ContainerType  ContainerType
+	ContainerIndex int
+	Container      string
+	// EnvIndex and Env are the index and name of the environment variable of ReferenceSourceEnv
+	// references.
+	EnvIndex int
+	Env      string
+	// EnvFromIndex is the index of the environment source of ReferenceSourceEnvFrom references.
+	EnvFromIndex int
+	// VolumeIndex and Volume are the index and name of the volume of ReferenceSourceVolume and
+	// ReferenceSourceProjection references.
+	VolumeIndex int
+	Volume      string
+	// ProjectionIndex is the index of the projected volume source of ReferenceSourceProjection
+	// references.
+	ProjectionIndex int
+	// Index is the index of references from other sources, for example the index of an image pull
+	// secret.
+	Index int
+	// Field is the concrete path of the field of references found in objects other than pods,
+	// for example "spec.tls[0].secretName".
+	Field string
+}
+
+// alignedWith returns true if the reference o, found in another pod spec, is in the same place as
+// the reference r. This is used to find the reference of a virtual pod matching the reference of
+// its physical pod. Environment variables and volumes are matched by (container and) name rather
+// than by position, as the syncer or other plugins may add volumes, sidecar containers or
+// environment variables to the physical pod that the virtual pod does not have. Container names
+// are unique across the container lists of a pod.
+func (r *Reference) alignedWith(o *Reference) bool {
+	if r.Source != o.Source {
+		return false
+	}
+
+	switch r.Source {
+	case ReferenceSourceEnv:
+		return r.Container == o.Container && r.Env == o.Env
+	case ReferenceSourceEnvFrom:
+		return r.Container == o.Container && r.EnvFromIndex == o.EnvFromIndex
+	case ReferenceSourceVolume:
+		return r.Volume == o.Volume
+	case ReferenceSourceProjection:
+		return r.Volume == o.Volume && r.ProjectionIndex == o.ProjectionIndex
+	default:
+		return r.Index == o.Index
+	}
+}
+
+// ReferenceableKind describes a kind of object that pods reference by name, and that the hooks
+// can substitute with an object of the same name from the parent namespace. Implementations are
+// registered with RegisterKind.
+type ReferenceableKind interface {
+	// Name returns the lower case name of the kind, for example "configmap". It is used in logs,
+	// metrics and substitutions and must be unique among the registered kinds.
+	Name() string
+	// HookName returns the name of the hook that mutates only this kind, its settings (such as
+	// the enabled setting) apply to the kind in every hook.
+	HookName() string
+	// SkipAnnotation returns the pod annotation key that, if set to any value, disables
+	// substituting references of this kind on the pod.
+	SkipAnnotation() string
+	// DryRunAnnotation returns the pod annotation key that overrides the hooks dry run setting for
+	// references of this kind on the pod.
+	DryRunAnnotation() string
+	// GroupVersionKind returns the GroupVersionKind of the kind, it is used to look up only the
+	// metadata of parent objects.
+	GroupVersionKind() schema.GroupVersionKind
+	// FindReferences returns the references to objects of the kind in the pod spec.
+	FindReferences(podSpec *corev1.PodSpec) []Reference
+	// GetName returns the name of the object ref refers to in the pod spec.
+	GetName(podSpec *corev1.PodSpec, ref *Reference) string
+	// SetName rewrites ref in the pod spec to refer to the object name.
+	SetName(podSpec *corev1.PodSpec, ref *Reference, name string)
+	// GetParent fetches the object with the given key, using reader.
+	GetParent(
+		ctx context.Context,
+		reader ctrlruntimeclient.Reader,
+		key types.NamespacedName,
+	) (ctrlruntimeclient.Object, error)
+}
+
+// ParentValidator is optionally implemented by a ReferenceableKind that only allows some parent
+// objects to be substituted. Parent objects of such kinds are always fetched in full.
+type ParentValidator interface {
+	// ValidateParent returns an error, wrapping ErrParentNotEligible, if the parent object obj (an
+	// object returned by GetParent) may not be substituted.
+	ValidateParent(obj ctrlruntimeclient.Object) error
+}
+
+// kindRegistry holds the registered ReferenceableKinds in registration order.
+type kindRegistry struct {
+	lock  sync.RWMutex
+	kinds []ReferenceableKind
+}
+
+//nolint:gochecknoglobals
+var kinds = &kindRegistry{
+	kinds: []ReferenceableKind{
+		ConfigMapKind{},
+		SecretKind{},
+		PersistentVolumeClaimKind{},
+		ServiceAccountKind{},
+	},
+}
+
+// RegisterKind registers kind, hooks created afterwards that handle all registered kinds (such as
+// the PreferParentResourcesHook) substitute references of the kind as well. Configmaps, secrets,
+// persistentvolumeclaims and serviceaccounts are always registered. An ErrKindAlreadyRegistered
+// error is returned if a kind of the same name is already registered.
+func RegisterKind(kind ReferenceableKind) error {
+	kinds.lock.Lock()
+	defer kinds.lock.Unlock()
+
+	for _, registered := range kinds.kinds {
+		if registered.Name() == kind.Name() {
+			return fmt.Errorf("%w: kind '%s'", ErrKindAlreadyRegistered, kind.Name())
+		}
+	}
+
+	kinds.kinds = append(kinds.kinds, kind)
+
+	return nil
+}
+
+// RegisteredKinds returns the registered kinds in registration order.
+func RegisteredKinds() []ReferenceableKind {
+	kinds.lock.RLock()
+	defer kinds.lock.RUnlock()
+
+	registered := make([]ReferenceableKind, len(kinds.kinds))
+	copy(registered, kinds.kinds)
+
+	return registered
+}
+
+// GetKind returns the registered kind with the given name.
+func GetKind(name string) (ReferenceableKind, bool) {
+	kinds.lock.RLock()
+	defer kinds.lock.RUnlock()
+
+	for _, kind := range kinds.kinds {
+		if kind.Name() == name {
+			return kind, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,108 @@
+package mutator
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "prefer_parent_resources"
+
+	// MutationOutcomeSubstituted is the outcome label value recorded when a reference was
+	// rewritten to point at the parent object.
+	MutationOutcomeSubstituted = "substituted"
+	// MutationOutcomeNotFound is the outcome label value recorded when no parent object exists
+	// and the reference falls back to the virtual object.
+	MutationOutcomeNotFound = "not_found"
+	// MutationOutcomeError is the outcome label value recorded when looking up the parent object
+	// failed with an error other than not found.
+	MutationOutcomeError = "error"
+)
+
+//nolint:gochecknoglobals
+var (
+	mutationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "mutations_total",
+			Help:      "Number of pod references evaluated by the hooks, by hook, kind and outcome.",
+		},
+		[]string{"hook", "kind", "outcome"},
+	)
+
+	parentLookupDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "parent_lookup_duration_seconds",
+			Help:      "Latency of parent (host) cluster object lookups.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"hook", "kind"},
+	)
+
+	parentLookupErrorsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "parent_lookup_errors_total",
+			Help: "Number of parent (host) cluster object lookups that failed with an " +
+				"error other than not found.",
+		},
+		[]string{"hook", "kind"},
+	)
+
+	annotationSkipsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "annotation_skips_total",
+			Help:      "Number of pods skipped by a hook due to the hooks skip annotation.",
+		},
+		[]string{"hook"},
+	)
+
+	metricsRegistry = newMetricsRegistry()
+)
+
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	registry.MustRegister(
+		mutationsTotal,
+		parentLookupDuration,
+		parentLookupErrorsTotal,
+		annotationSkipsTotal,
+	)
+
+	return registry
+}
+
+// MustRegisterMetrics registers the collectors cs with the registry served by MetricsHandler, so
+// that controllers built on the mutators report their metrics along with those of the hooks. It
+// panics if any collector cannot be registered.
+func MustRegisterMetrics(cs ...prometheus.Collector) {
+	metricsRegistry.MustRegister(cs...)
+}
+
+// MetricsHandler returns an http.Handler that serves the plugin metrics in the prometheus text
+// exposition format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+func recordMutation(hookName, kind, outcome string) {
+	mutationsTotal.WithLabelValues(hookName, kind, outcome).Inc()
+}
+
+func recordParentLookup(hookName, kind string, duration time.Duration, err error) {
+	parentLookupDuration.WithLabelValues(hookName, kind).Observe(duration.Seconds())
+
+	if err != nil {
+		parentLookupErrorsTotal.WithLabelValues(hookName, kind).Inc()
+	}
+}
+
+func recordAnnotationSkip(hookName string) {
+	annotationSkipsTotal.WithLabelValues(hookName).Inc()
+}
@@ -0,0 +1,387 @@
+// Package mutator substitutes the references of physical (host cluster) objects -- generally
+// pods -- to objects translated from a vcluster with objects of the same name from the parent
+// (host) namespace. It does not depend on the vcluster SDK: objects are looked up through
+// controller-runtime readers, names are translated by a PhysicalNameFunc, and every mutation
+// returns the mutated object along with the Decision made for each of its references. The
+// vcluster plugin hooks are thin adapters over the mutators of this package, the same mutators
+// can back an admission webhook or offline tooling.
+package mutator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// VirtualNameAnnotation is the annotation vcluster sets on physical objects holding the name
+	// of their virtual object.
+	VirtualNameAnnotation = "vcluster.loft.sh/object-name"
+	// VirtualNamespaceAnnotation is the annotation vcluster sets on physical objects holding the
+	// namespace of their virtual object.
+	VirtualNamespaceAnnotation = "vcluster.loft.sh/object-namespace"
+)
+
+// Logger is the logger the mutators log to, the vcluster SDK logger satisfies it.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+
+func (nopLogger) Infof(string, ...interface{}) {}
+
+func (nopLogger) Errorf(string, ...interface{}) {}
+
+// PhysicalNameFunc returns the physical name of the virtual object name in the virtual namespace,
+// for vcluster this is the vcluster SDK translate.PhysicalName function.
+type PhysicalNameFunc func(name, namespace string) string
+
+// PhysicalLabelKeyFunc returns the key of the label of physical objects the label key of virtual
+// objects is translated to, for vcluster this is the vcluster SDK translator.ConvertLabelKey
+// function.
+type PhysicalLabelKeyFunc func(key string) string
+
+// Options configure a Mutator.
+type Options struct {
+	// Name is the name of the mutator, it is used in logs, metrics, events and the annotations
+	// recorded on mutated objects. The vcluster hooks use their hook name.
+	Name string
+	// Logger is the logger of the mutator, if nil nothing is logged.
+	Logger Logger
+	// ParentNamespace is the namespace of the parent objects, the host namespace of the vcluster.
+	ParentNamespace string
+	// ParentMetadataReader reads the metadata (metav1.PartialObjectMetadata) of parent objects,
+	// generally a cached client, so that only the metadata of the parent objects is cached.
+	ParentMetadataReader ctrlruntimeclient.Reader
+	// ParentReader reads full parent objects and lists grants, generally a reader that is not
+	// cached, so that the data of parent objects is not kept in memory.
+	ParentReader ctrlruntimeclient.Reader
+	// VirtualReader reads the virtual objects of the objects being mutated. If nil, for example
+	// outside of a vcluster, references whose names cannot be reverse translated are not resolved.
+	VirtualReader ctrlruntimeclient.Reader
+	// VirtualAPIReader reads virtual objects shadowed by parent objects when DiffShadowed is set,
+	// generally a reader that is not cached, so that no virtual objects other than those of the
+	// objects being mutated are cached. If nil shadowed virtual objects are not compared.
+	VirtualAPIReader ctrlruntimeclient.Reader
+	// PhysicalName translates virtual names to physical names, it is required.
+	PhysicalName PhysicalNameFunc
+	// PhysicalLabelKey translates the label keys of virtual objects to those of physical objects,
+	// so that the selectors of grants and parent object restrictions, which select virtual
+	// objects, match the physical objects being mutated. If nil label keys are not translated.
+	PhysicalLabelKey PhysicalLabelKeyFunc
+	// GrantCache caches the grants loaded when RequireGrants is set, it may be shared by mutators
+	// of different host namespaces. If nil the mutator uses a cache of its own.
+	GrantCache *GrantCache
+	// Recorder records events on virtual objects, for example for denied parent objects. If nil
+	// no events are recorded.
+	Recorder record.EventRecorder
+	// Scheme is the scheme of the virtual objects, used to determine the kind of the objects events
+	// are recorded on. If nil no events are recorded.
+	Scheme *runtime.Scheme
+	// KindEnabled returns false for kinds whose references are left untouched. If nil every kind
+	// is enabled.
+	KindEnabled func(kind ReferenceableKind) bool
+	// DryRun resolves references as usual but leaves them unchanged, recording the substitutions
+	// that would have been made on the object instead. The dry run annotation of each kind
+	// overrides it per object.
+	DryRun bool
+	// FailurePolicy determines how lookup errors are handled, defaults to FailurePolicyFailOpen.
+	FailurePolicy FailurePolicy
+	// RequireGrants only substitutes parent objects a ParentResourceGrant allows.
+	RequireGrants bool
+	// Enforced ignores skip annotations and rejects objects whose references cannot be
+	// substituted.
+	Enforced bool
+	// EnforcedNames and EnforcedKinds limit Enforced to the references to parent objects of the
+	// given (virtual) names, and to the references of the named kinds, if either is set.
+	EnforcedNames []string
+	EnforcedKinds []string
+	// ReservedNames are names of parent objects that are never substituted, in addition to those
+	// reserved with ReserveNames.
+	ReservedNames []string
+	// ReservedSecretTypes are types of parent secrets that are never substituted, in addition to
+	// those reserved with ReserveSecretTypes.
+	ReservedSecretTypes []corev1.SecretType
+	// Checksums records the resource version and a hash of the data of every substituted parent
+	// object whose kind is a ParentHasher in the ChecksumsAnnotation of mutated pods. Parent
+	// objects of such kinds are then always fetched in full.
+	Checksums bool
+	// ChecksumKey is the key of the hmac the data of parent objects is hashed with for Checksums,
+	// it must be kept secret so that the data cannot be brute forced from the recorded hashes.
+	// Parent objects holding sensitive data, such as secrets, are not recorded without a key.
+	ChecksumKey []byte
+	// DiffShadowed compares the parent objects substituted for virtual objects that exist as well
+	// with the virtual objects they shadow, reporting the keys they differ by in events, decisions
+	// and dry run substitutions.
+	DiffShadowed bool
+}
+
+// Result is the outcome of a mutation.
+type Result struct {
+	// Object is the mutated object, this is the object passed to the Mutator.
+	Object ctrlruntimeclient.Object
+	// Decisions are the decisions made for the references of the object, in order.
+	Decisions []Decision
+}
+
+// Mutator substitutes the references of physical objects of a single type.
+type Mutator interface {
+	// Name returns the name of the mutator.
+	Name() string
+	// Resource returns an (empty) object of the type the mutator mutates.
+	Resource() ctrlruntimeclient.Object
+	// Mutate substitutes the references of the object obj being created. The object is only
+	// mutated once every reference has been resolved, if resolving any reference rejects the
+	// object an error is returned and the object is left unchanged.
+	Mutate(ctx context.Context, obj ctrlruntimeclient.Object) (*Result, error)
+	// MutateUpdate mutates the object obj being updated.
+	MutateUpdate(ctx context.Context, obj ctrlruntimeclient.Object) (*Result, error)
+}
+
+// NewPodMutator returns a Mutator substituting the references of pods to objects of the given
+// kinds.
+func NewPodMutator(opts *Options, kinds ...ReferenceableKind) Mutator {
+	return newReferenceMutator(opts, kinds...)
+}
+
+func newReferenceMutator(opts *Options, kinds ...ReferenceableKind) *referenceMutator {
+	log := opts.Logger
+	if log == nil {
+		log = nopLogger{}
+	}
+
+	failurePolicy := opts.FailurePolicy
+	if failurePolicy == "" {
+		failurePolicy = FailurePolicyFailOpen
+	}
+
+	m := &referenceMutator{
+		log:                  log,
+		name:                 opts.Name,
+		dryRun:               opts.DryRun,
+		failurePolicy:        failurePolicy,
+		physicalName:         opts.PhysicalName,
+		physicalLabelKey:     opts.PhysicalLabelKey,
+		physicalNamespace:    opts.ParentNamespace,
+		parentMetadataReader: opts.ParentMetadataReader,
+		parentReader:         opts.ParentReader,
+		virtualReader:        opts.VirtualReader,
+		virtualAPIReader:     opts.VirtualAPIReader,
+		reserved:             newReservedParents(opts.ReservedNames, opts.ReservedSecretTypes),
+		requireGrants:        opts.RequireGrants,
+		grantCache:           opts.GrantCache,
+		enforcement:          newEnforcement(opts.Enforced, opts.EnforcedNames, opts.EnforcedKinds),
+		checksums:            opts.Checksums,
+		checksumKey:          opts.ChecksumKey,
+		diffShadowed:         opts.DiffShadowed,
+		recorder:             opts.Recorder,
+		scheme:               opts.Scheme,
+	}
+
+	if m.grantCache == nil {
+		m.grantCache = NewGrantCache()
+	}
+
+	for _, kind := range kinds {
+		if opts.KindEnabled != nil && !opts.KindEnabled(kind) {
+			log.Infof("%s references disabled, skipping", kind.Name())
+
+			continue
+		}
+
+		m.kinds = append(m.kinds, kind)
+	}
+
+	return m
+}
+
+type referenceMutator struct {
+	log                  Logger
+	name                 string
+	dryRun               bool
+	failurePolicy        FailurePolicy
+	kinds                []ReferenceableKind
+	physicalName         PhysicalNameFunc
+	physicalLabelKey     PhysicalLabelKeyFunc
+	physicalNamespace    string
+	parentMetadataReader ctrlruntimeclient.Reader
+	parentReader         ctrlruntimeclient.Reader
+	virtualReader        ctrlruntimeclient.Reader
+	virtualAPIReader     ctrlruntimeclient.Reader
+	reserved             *reservedParents
+	requireGrants        bool
+	grantCache           *GrantCache
+	enforcement          *enforcement
+	checksums            bool
+	checksumKey          []byte
+	diffShadowed         bool
+	recorder             record.EventRecorder
+	scheme               *runtime.Scheme
+}
+
+// Name returns the name of the Mutator.
+func (m *referenceMutator) Name() string {
+	return m.name
+}
+
+// Resource returns the type of resource the Mutator mutates.
+func (m *referenceMutator) Resource() ctrlruntimeclient.Object {
+	return &corev1.Pod{}
+}
+
+// getVirtualPod fetches the virtual pod matching the physical pod, applying the failure policy.
+func (m *referenceMutator) getVirtualPod(
+	ctx context.Context,
+	pod *corev1.Pod,
+) (*corev1.Pod, error) {
+	var vPod *corev1.Pod
+
+	err := m.withFailurePolicy(func() error {
+		var err error
+
+		vPod, err = GetVirtualPod(ctx, pod, m.virtualReader)
+
+		return err
+	})
+	if err != nil {
+		lookupErr := &LookupError{}
+		if errors.As(err, &lookupErr) {
+			lookupErr.Policy = m.failurePolicy
+		}
+
+		return nil, err
+	}
+
+	return vPod, nil
+}
+
+// recordMutation records the outcome of evaluating a single pod reference to an object of the
+// given kind in the metrics.
+func (m *referenceMutator) recordMutation(kind ReferenceableKind, outcome string) {
+	recordMutation(m.name, kind.Name(), outcome)
+}
+
+// findReferences returns the references of the pod to objects of every kind of the mutator. The
+// references of kinds whose skip annotation is set on the pod are marked skipped.
+func (m *referenceMutator) findReferences(pod *corev1.Pod) []*reference {
+	var refs []*reference
+
+	for _, kind := range m.kinds {
+		skipped := m.skipKind(pod, kind)
+
+		for _, ref := range kind.FindReferences(&pod.Spec) {
+			ref := ref
+
+			refs = append(refs, &reference{
+				Reference: ref,
+				kind:      kind,
+				pName:     kind.GetName(&pod.Spec, &ref),
+				skipped:   skipped,
+			})
+		}
+	}
+
+	return refs
+}
+
+// Mutate determines if the pod being created refers to a secret or configmap (or any other kind
+// of the mutator) that exists in the parent namespace, if "yes", we replace the reference to the
+// object translated from the vcluster with the "real" object. The pod is only mutated once every
+// reference has been resolved, if resolving any reference rejects the pod it is left unchanged
+// and the error is returned.
+func (m *referenceMutator) Mutate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (*Result, error) {
+	return collectDecisions(ctx, obj, func(ctx context.Context) error {
+		return m.mutatePod(ctx, obj)
+	})
+}
+
+func (m *referenceMutator) mutatePod(ctx context.Context, obj ctrlruntimeclient.Object) error {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		m.log.Errorf("mutate object is not a pod")
+
+		return fmt.Errorf("%w: object %v is not a pod", ErrWrongResourceType, obj)
+	}
+
+	m.log.Infof("mutate pod %s/%s", pod.Namespace, pod.Name)
+
+	refs := m.findReferences(pod)
+
+	if len(refs) == 0 {
+		// nothing to do, we're outta here!
+		m.log.Infof(
+			"mutate pod %s/%s skipping, no envvars or volumes mounted",
+			pod.Namespace,
+			pod.Name,
+		)
+
+		return nil
+	}
+
+	pm := &podMutation{
+		pod: pod,
+	}
+
+	plan, err := m.planMutation(ctx, pm, refs)
+	if err != nil {
+		return err
+	}
+
+	MutateAnnotations(pod, m.name)
+
+	applied := m.applyMutation(pm, plan)
+
+	err = m.recordChecksums(pod, applied)
+	if err != nil {
+		m.log.Errorf("mutate pod failed recording parent object checksums")
+
+		return err
+	}
+
+	err = m.postApply(ctx, pm, applied)
+	if err != nil {
+		return err
+	}
+
+	err = m.recordDryRun(pod, pm.dryRunSubstitutions)
+	if err != nil {
+		m.log.Errorf("mutate pod failed recording dry run substitutions")
+
+		return err
+	}
+
+	return nil
+}
+
+// MutateUpdate makes sure the mutated by annotation of the mutator is set on pods being updated,
+// the references of pods cannot change.
+func (m *referenceMutator) MutateUpdate(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+) (*Result, error) {
+	_ = ctx
+
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		m.log.Errorf("mutate update object is not a pod")
+
+		return nil, fmt.Errorf("%w: object %v is not a pod", ErrWrongResourceType, obj)
+	}
+
+	MutateAnnotations(pod, m.name)
+
+	return &Result{Object: pod}, nil
+}
@@ -0,0 +1,910 @@
+package mutator_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimeclientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+type comparePodTestCase struct {
+	description string
+	inPod       *corev1.Pod
+	expected    *corev1.Pod
+}
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+
+	err := clientgoscheme.AddToScheme(scheme)
+	if err != nil {
+		panic(err)
+	}
+
+	return scheme
+}
+
+// physicalName is a PhysicalNameFunc translating names the same way vcluster does for a vcluster
+// named "vcluster".
+func physicalName(name, namespace string) string {
+	return name + "-x-" + namespace + "-x-vcluster"
+}
+
+func newTestPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      physicalName("somepod", "default"),
+			Namespace: "host",
+			Annotations: map[string]string{
+				mutator.VirtualNameAnnotation:      "somepod",
+				mutator.VirtualNamespaceAnnotation: "default",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "somecontainer",
+					Env: []corev1.EnvVar{
+						{
+							Name: "someenv",
+							ValueFrom: &corev1.EnvVarSource{
+								ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: physicalName("someconfigmap", "default"),
+									},
+									Key: "somekey",
+								},
+							},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "somevolume",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: physicalName("somesecret", "default"),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestPodMutator(t *testing.T) {
+	cases := map[string]struct {
+		description     string
+		dryRun          bool
+		parentObjs      []runtime.Object
+		expectedNames   []string
+		expectedOutcome map[string]string
+	}{
+		"substituted": {
+			description: "validate that references to existing parent objects are substituted",
+			parentObjs: []runtime.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "host"},
+					Data:       map[string]string{"somekey": "somevalue"},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				},
+			},
+			expectedNames: []string{"someconfigmap", "somesecret"},
+			expectedOutcome: map[string]string{
+				"container 'somecontainer' env 'someenv'": mutator.MutationOutcomeSubstituted,
+				"volume 'somevolume'":                     mutator.MutationOutcomeSubstituted,
+			},
+		},
+		"not-found": {
+			description: "validate that references to missing parent objects are left unchanged",
+			parentObjs: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				},
+			},
+			expectedNames: []string{physicalName("someconfigmap", "default"), "somesecret"},
+			expectedOutcome: map[string]string{
+				"container 'somecontainer' env 'someenv'": mutator.MutationOutcomeNotFound,
+				"volume 'somevolume'":                     mutator.MutationOutcomeSubstituted,
+			},
+		},
+		"dry-run": {
+			description: "validate that references are left unchanged in dry run mode",
+			dryRun:      true,
+			parentObjs: []runtime.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "host"},
+					Data:       map[string]string{"somekey": "somevalue"},
+				},
+			},
+			expectedNames: []string{
+				physicalName("someconfigmap", "default"),
+				physicalName("somesecret", "default"),
+			},
+			expectedOutcome: map[string]string{
+				"container 'somecontainer' env 'someenv'": mutator.MutationOutcomeDryRun,
+				"volume 'somevolume'":                     mutator.MutationOutcomeNotFound,
+			},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			parentClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(testCase.parentObjs...).
+				Build()
+
+			m := mutator.NewPodMutator(
+				&mutator.Options{
+					Name:                 "some-mutator",
+					ParentNamespace:      "host",
+					ParentMetadataReader: parentClient,
+					ParentReader:         parentClient,
+					VirtualReader:        ctrlruntimeclientfake.NewClientBuilder().Build(),
+					PhysicalName:         physicalName,
+					DryRun:               testCase.dryRun,
+				},
+				mutator.ConfigMapKind{},
+				mutator.SecretKind{},
+			)
+
+			result, err := m.Mutate(context.Background(), newTestPod())
+			if err != nil {
+				t.Fatalf("%s: mutate failed, error: %s", testName, err)
+			}
+
+			pod, ok := result.Object.(*corev1.Pod)
+			if !ok {
+				t.Fatalf("%s: mutated object is not a pod", testName)
+			}
+
+			actualNames := []string{
+				pod.Spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name,
+				pod.Spec.Volumes[0].Secret.SecretName,
+			}
+
+			if !cmp.Equal(actualNames, testCase.expectedNames) {
+				t.Fatalf(
+					"%s: actual and expected names do not match\nactual: %s\nexpected:%s",
+					testName,
+					actualNames,
+					testCase.expectedNames,
+				)
+			}
+
+			actualOutcome := map[string]string{}
+
+			for _, d := range result.Decisions {
+				actualOutcome[d.Location] = d.Outcome
+			}
+
+			if !cmp.Equal(actualOutcome, testCase.expectedOutcome) {
+				t.Fatalf(
+					"%s: actual and expected decisions do not match\nactual: %v\nexpected:%v",
+					testName,
+					actualOutcome,
+					testCase.expectedOutcome,
+				)
+			}
+		})
+	}
+}
+
+// newReferencesTestPod returns a pod without references, in the virtual namespace "default".
+func newReferencesTestPod() *corev1.Pod {
+	pod := newTestPod()
+	pod.Spec = corev1.PodSpec{Containers: []corev1.Container{{Name: "somecontainer"}}}
+
+	return pod
+}
+
+func TestPodMutatorReferences(t *testing.T) {
+	configMapName := physicalName("someconfigmap", "default")
+	secretName := physicalName("somesecret", "default")
+
+	cases := map[string]struct {
+		description      string
+		setup            func(pod *corev1.Pod)
+		name             func(pod *corev1.Pod) string
+		expectedName     string
+		expectedLocation string
+	}{
+		"init-container-env": {
+			description: "validate that environment variables of init containers are substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = []corev1.Container{{
+					Name: "someinitcontainer",
+					Env: []corev1.EnvVar{{
+						Name: "someenv",
+						ValueFrom: &corev1.EnvVarSource{
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: configMapName,
+								},
+								Key: "somekey",
+							},
+						},
+					}},
+				}}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.InitContainers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name
+			},
+			expectedName:     "someconfigmap",
+			expectedLocation: "container 'someinitcontainer' env 'someenv'",
+		},
+		"ephemeral-container-env": {
+			description: "validate that environment variables of ephemeral containers are " +
+				"substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{{
+					EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+						Name: "someephemeralcontainer",
+						Env: []corev1.EnvVar{{
+							Name: "someenv",
+							ValueFrom: &corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: secretName,
+									},
+									Key: "somekey",
+								},
+							},
+						}},
+					},
+				}}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.EphemeralContainers[0].Env[0].ValueFrom.SecretKeyRef.Name
+			},
+			expectedName:     "somesecret",
+			expectedLocation: "container 'someephemeralcontainer' env 'someenv'",
+		},
+		"env-from-configmap": {
+			description: "validate that configmap environment sources are substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.Containers[0].EnvFrom = []corev1.EnvFromSource{
+					{Prefix: "some"},
+					{
+						ConfigMapRef: &corev1.ConfigMapEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: configMapName,
+							},
+						},
+					},
+				}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.Containers[0].EnvFrom[1].ConfigMapRef.Name
+			},
+			expectedName:     "someconfigmap",
+			expectedLocation: "container 'somecontainer' envFrom 1",
+		},
+		"env-from-secret": {
+			description: "validate that secret environment sources of init containers are " +
+				"substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = []corev1.Container{{
+					Name: "someinitcontainer",
+					EnvFrom: []corev1.EnvFromSource{{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+						},
+					}},
+				}}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.InitContainers[0].EnvFrom[0].SecretRef.Name
+			},
+			expectedName:     "somesecret",
+			expectedLocation: "container 'someinitcontainer' envFrom 0",
+		},
+		"projected-configmap": {
+			description: "validate that configmap sources of projected volumes are substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.Volumes = []corev1.Volume{{
+					Name: "someprojectedvolume",
+					VolumeSource: corev1.VolumeSource{
+						Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{
+								{ServiceAccountToken: &corev1.ServiceAccountTokenProjection{}},
+								{
+									ConfigMap: &corev1.ConfigMapProjection{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: configMapName,
+										},
+									},
+								},
+							},
+						},
+					},
+				}}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.Volumes[0].Projected.Sources[1].ConfigMap.Name
+			},
+			expectedName:     "someconfigmap",
+			expectedLocation: "volume 'someprojectedvolume' source 1",
+		},
+		"projected-secret": {
+			description: "validate that secret sources of projected volumes are substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.Volumes = []corev1.Volume{{
+					Name: "someprojectedvolume",
+					VolumeSource: corev1.VolumeSource{
+						Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{{
+								Secret: &corev1.SecretProjection{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: secretName,
+									},
+								},
+							}},
+						},
+					},
+				}}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.Volumes[0].Projected.Sources[0].Secret.Name
+			},
+			expectedName:     "somesecret",
+			expectedLocation: "volume 'someprojectedvolume' source 0",
+		},
+		"image-pull-secret": {
+			description: "validate that image pull secrets are substituted",
+			setup: func(pod *corev1.Pod) {
+				pod.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: secretName}}
+			},
+			name: func(pod *corev1.Pod) string {
+				return pod.Spec.ImagePullSecrets[0].Name
+			},
+			expectedName:     "somesecret",
+			expectedLocation: "imagePullSecret 0",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			parentClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "host"},
+					},
+					&corev1.Secret{
+						ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+					},
+				).
+				Build()
+
+			m := mutator.NewPodMutator(
+				&mutator.Options{
+					Name:                 "some-mutator",
+					ParentNamespace:      "host",
+					ParentMetadataReader: parentClient,
+					ParentReader:         parentClient,
+					VirtualReader:        ctrlruntimeclientfake.NewClientBuilder().Build(),
+					PhysicalName:         physicalName,
+				},
+				mutator.ConfigMapKind{},
+				mutator.SecretKind{},
+			)
+
+			pod := newReferencesTestPod()
+			testCase.setup(pod)
+
+			result, err := m.Mutate(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("%s: mutate failed, error: %s", testName, err)
+			}
+
+			if actual := testCase.name(pod); actual != testCase.expectedName {
+				t.Fatalf(
+					"%s: actual and expected names do not match\nactual: %s\nexpected:%s",
+					testName,
+					actual,
+					testCase.expectedName,
+				)
+			}
+
+			expectedOutcome := map[string]string{
+				testCase.expectedLocation: mutator.MutationOutcomeSubstituted,
+			}
+
+			actualOutcome := map[string]string{}
+
+			for _, d := range result.Decisions {
+				actualOutcome[d.Location] = d.Outcome
+			}
+
+			if !cmp.Equal(actualOutcome, expectedOutcome) {
+				t.Fatalf(
+					"%s: actual and expected decisions do not match\nactual: %v\nexpected:%v",
+					testName,
+					actualOutcome,
+					expectedOutcome,
+				)
+			}
+		})
+	}
+}
+
+func TestPodMutatorShadowed(t *testing.T) {
+	parentObjs := []runtime.Object{
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "host"},
+			Data:       map[string]string{"somekey": "somevalue", "parentkey": "somevalue"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+			Data:       map[string][]byte{"somekey": []byte("somesecretvalue")},
+		},
+	}
+
+	cases := map[string]struct {
+		description    string
+		diffShadowed   bool
+		dryRun         bool
+		virtualObjs    []runtime.Object
+		expectedEvents []string
+		expectedDiffs  map[string]string
+	}{
+		"shadowed": {
+			description: "validate that the differences of parent objects from the virtual " +
+				"objects they shadow are reported, without secret values",
+			diffShadowed: true,
+			virtualObjs: []runtime.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "default"},
+					Data: map[string]string{
+						"somekey":    "someothervalue",
+						"virtualkey": "somevalue",
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "default"},
+					Data: map[string][]byte{
+						"somekey":    []byte("someothersecretvalue"),
+						"virtualkey": []byte("somesecretvalue"),
+					},
+				},
+			},
+			expectedEvents: []string{
+				"Normal PreferParentShadowed host cluster configmap 'someconfigmap' is used " +
+					"instead of the virtual configmap, edits of the virtual configmap have no " +
+					"effect, the host cluster configmap adds keys 'parentkey', removes keys " +
+					"'virtualkey', changes keys 'somekey'",
+				"Normal PreferParentShadowed host cluster secret 'somesecret' is used instead " +
+					"of the virtual secret, edits of the virtual secret have no effect, the host " +
+					"cluster secret removes keys 'virtualkey'",
+			},
+			expectedDiffs: map[string]string{
+				"configmap": "adds keys 'parentkey', removes keys 'virtualkey', changes keys " +
+					"'somekey'",
+				"secret": "removes keys 'virtualkey'",
+			},
+		},
+		"disabled": {
+			description: "validate that parent objects are not compared with the virtual objects " +
+				"they shadow unless enabled",
+			virtualObjs: []runtime.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "default"},
+					Data:       map[string]string{"virtualkey": "somevalue"},
+				},
+			},
+		},
+		"identical": {
+			description: "validate that virtual objects holding the same data as the parent " +
+				"objects are not reported",
+			diffShadowed: true,
+			virtualObjs: []runtime.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "default"},
+					Data:       map[string]string{"somekey": "somevalue", "parentkey": "somevalue"},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "default"},
+					Data:       map[string][]byte{"somekey": []byte("someothersecretvalue")},
+				},
+			},
+		},
+		"not-shadowed": {
+			description:  "validate that parent objects without virtual objects are not reported",
+			diffShadowed: true,
+		},
+		"dry-run": {
+			description: "validate that no events are recorded in dry run mode, the " +
+				"differences are still reported in the decisions",
+			diffShadowed: true,
+			dryRun:       true,
+			virtualObjs: []runtime.Object{
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "someconfigmap", Namespace: "default"},
+					Data:       map[string]string{"virtualkey": "somevalue"},
+				},
+			},
+			expectedDiffs: map[string]string{
+				"configmap": "adds keys 'parentkey', 'somekey', removes keys 'virtualkey'",
+			},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+			recorder := record.NewFakeRecorder(10)
+
+			parentClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(parentObjs...).
+				Build()
+
+			m := mutator.NewPodMutator(
+				&mutator.Options{
+					Name:                 "some-mutator",
+					ParentNamespace:      "host",
+					ParentMetadataReader: parentClient,
+					ParentReader:         parentClient,
+					// shadowed virtual objects must only be read with the (uncached) virtual
+					// API reader
+					VirtualReader: ctrlruntimeclientfake.NewClientBuilder().Build(),
+					VirtualAPIReader: ctrlruntimeclientfake.NewClientBuilder().
+						WithScheme(scheme).
+						WithRuntimeObjects(testCase.virtualObjs...).
+						Build(),
+					PhysicalName: physicalName,
+					Recorder:     recorder,
+					Scheme:       scheme,
+					DryRun:       testCase.dryRun,
+					DiffShadowed: testCase.diffShadowed,
+				},
+				mutator.ConfigMapKind{},
+				mutator.SecretKind{},
+			)
+
+			result, err := m.Mutate(context.Background(), newTestPod())
+			if err != nil {
+				t.Fatalf("%s: mutate failed, error: %s", testName, err)
+			}
+
+			close(recorder.Events)
+
+			var actualEvents []string
+
+			for event := range recorder.Events {
+				actualEvents = append(actualEvents, event)
+			}
+
+			if !cmp.Equal(actualEvents, testCase.expectedEvents) {
+				t.Fatalf(
+					"%s: actual and expected events do not match\n%s",
+					testName,
+					cmp.Diff(actualEvents, testCase.expectedEvents),
+				)
+			}
+
+			var actualDiffs map[string]string
+
+			for _, d := range result.Decisions {
+				if d.Diff == nil {
+					continue
+				}
+
+				if actualDiffs == nil {
+					actualDiffs = map[string]string{}
+				}
+
+				actualDiffs[d.Kind] = d.Diff.String()
+			}
+
+			if !cmp.Equal(actualDiffs, testCase.expectedDiffs) {
+				t.Fatalf(
+					"%s: actual and expected decision diffs do not match\n%s",
+					testName,
+					cmp.Diff(actualDiffs, testCase.expectedDiffs),
+				)
+			}
+		})
+	}
+}
+
+// getCounter is a reader counting the secrets and configmaps read through it in full.
+type getCounter struct {
+	ctrlruntimeclient.Reader
+	secretGets    int
+	configMapGets int
+}
+
+func (c *getCounter) Get(
+	ctx context.Context,
+	key ctrlruntimeclient.ObjectKey,
+	obj ctrlruntimeclient.Object,
+) error {
+	switch obj.(type) {
+	case *corev1.Secret:
+		c.secretGets++
+	case *corev1.ConfigMap:
+		c.configMapGets++
+	}
+
+	return c.Reader.Get(ctx, key, obj)
+}
+
+func TestPodMutatorReservedSecretTypes(t *testing.T) {
+	cases := map[string]struct {
+		description         string
+		reservedSecretTypes []corev1.SecretType
+		secret              *corev1.Secret
+		expectedName        string
+		expectedSecretGets  int
+	}{
+		"not-reserved": {
+			description: "validate that secrets are not fetched in full to check the reserved " +
+				"secret types recognized by their metadata",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				Type:       corev1.SecretTypeOpaque,
+			},
+			expectedName: "somesecret",
+		},
+		"service-account-token": {
+			description: "validate that service account token secrets are recognized as reserved " +
+				"by their metadata",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "somesecret",
+					Namespace:   "host",
+					Annotations: map[string]string{corev1.ServiceAccountNameKey: "default"},
+				},
+				Type: corev1.SecretTypeServiceAccountToken,
+			},
+			expectedName: physicalName("somesecret", "default"),
+		},
+		"custom-type": {
+			description: "validate that secrets are fetched in full to check reserved secret " +
+				"types that cannot be recognized by their metadata",
+			reservedSecretTypes: []corev1.SecretType{corev1.SecretTypeTLS},
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				Type:       corev1.SecretTypeTLS,
+			},
+			expectedName:       physicalName("somesecret", "default"),
+			expectedSecretGets: 1,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			parentClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(testCase.secret).
+				Build()
+			parentReader := &getCounter{Reader: parentClient}
+
+			m := mutator.NewPodMutator(
+				&mutator.Options{
+					Name:                 "some-mutator",
+					ParentNamespace:      "host",
+					ParentMetadataReader: parentClient,
+					ParentReader:         parentReader,
+					VirtualReader:        ctrlruntimeclientfake.NewClientBuilder().Build(),
+					PhysicalName:         physicalName,
+					ReservedSecretTypes:  testCase.reservedSecretTypes,
+				},
+				mutator.SecretKind{},
+			)
+
+			result, err := m.Mutate(context.Background(), newTestPod())
+			if err != nil {
+				t.Fatalf("%s: mutate failed, error: %s", testName, err)
+			}
+
+			pod, ok := result.Object.(*corev1.Pod)
+			if !ok {
+				t.Fatalf("%s: mutated object is not a pod", testName)
+			}
+
+			if actual := pod.Spec.Volumes[0].Secret.SecretName; actual != testCase.expectedName {
+				t.Fatalf(
+					"%s: actual and expected names do not match\nactual: %s\nexpected:%s",
+					testName,
+					actual,
+					testCase.expectedName,
+				)
+			}
+
+			if parentReader.secretGets != testCase.expectedSecretGets {
+				t.Fatalf(
+					"%s: expected %d full secret reads, got %d",
+					testName,
+					testCase.expectedSecretGets,
+					parentReader.secretGets,
+				)
+			}
+		})
+	}
+}
+
+func TestPodMutatorGrantCache(t *testing.T) {
+	scheme := newScheme()
+
+	grant := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "somegrant",
+			Namespace: "host",
+			Labels:    map[string]string{mutator.GrantLabel: "true"},
+		},
+		Data: map[string]string{
+			mutator.GrantDataKey: "{resources: [{kind: secret, names: [somesecret]}], " +
+				"namespaces: [default]}",
+		},
+	}
+
+	parentClient := ctrlruntimeclientfake.NewClientBuilder().
+		WithScheme(scheme).
+		WithRuntimeObjects(
+			grant,
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"}},
+		).
+		Build()
+	parentReader := &getCounter{Reader: parentClient}
+
+	m := mutator.NewPodMutator(
+		&mutator.Options{
+			Name:                 "some-mutator",
+			ParentNamespace:      "host",
+			ParentMetadataReader: parentClient,
+			ParentReader:         parentReader,
+			VirtualReader:        ctrlruntimeclientfake.NewClientBuilder().Build(),
+			PhysicalName:         physicalName,
+			RequireGrants:        true,
+		},
+		mutator.SecretKind{},
+	)
+
+	mutate := func(expectedName string, expectedConfigMapGets int) {
+		t.Helper()
+
+		result, err := m.Mutate(context.Background(), newTestPod())
+		if err != nil {
+			t.Fatalf("mutate failed, error: %s", err)
+		}
+
+		actual := result.Object.(*corev1.Pod).Spec.Volumes[0].Secret.SecretName
+		if actual != expectedName {
+			t.Fatalf("expected secret '%s', got '%s'", expectedName, actual)
+		}
+
+		if parentReader.configMapGets != expectedConfigMapGets {
+			t.Fatalf(
+				"expected %d full grant reads, got %d",
+				expectedConfigMapGets,
+				parentReader.configMapGets,
+			)
+		}
+	}
+
+	mutate("somesecret", 1)
+	mutate("somesecret", 1)
+
+	err := parentClient.Get(context.Background(), ctrlruntimeclient.ObjectKeyFromObject(grant), grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grant.Data[mutator.GrantDataKey] = "{resources: [{kind: secret, names: [somesecret]}], " +
+		"namespaces: [other]}"
+
+	err = parentClient.Update(context.Background(), grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mutate(physicalName("somesecret", "default"), 2)
+}
+
+func TestPodMutatorSecretChecksums(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		key         []byte
+		expected    bool
+	}{
+		"keyed": {
+			description: "validate that the data of secrets is hashed with the checksum key",
+			key:         []byte("somechecksumkey"),
+			expected:    true,
+		},
+		"no-key": {
+			description: "validate that no checksums of secrets are recorded without a key",
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := newScheme()
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				Data:       map[string][]byte{"somekey": []byte("someval")},
+			}
+
+			parentClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(secret).
+				Build()
+
+			m := mutator.NewPodMutator(
+				&mutator.Options{
+					Name:                 "some-mutator",
+					ParentNamespace:      "host",
+					ParentMetadataReader: parentClient,
+					ParentReader:         parentClient,
+					VirtualReader:        ctrlruntimeclientfake.NewClientBuilder().Build(),
+					PhysicalName:         physicalName,
+					Checksums:            true,
+					ChecksumKey:          testCase.key,
+				},
+				mutator.SecretKind{},
+			)
+
+			result, err := m.Mutate(context.Background(), newTestPod())
+			if err != nil {
+				t.Fatalf("mutate failed, error: %s", err)
+			}
+
+			checksums, err := mutator.GetChecksums(result.Object.(*corev1.Pod))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			checksum, ok := checksums[mutator.ChecksumKey("secret", "somesecret")]
+			if ok != testCase.expected {
+				t.Fatalf("expected a checksum of the secret %t, got %v", testCase.expected, checksums)
+			}
+
+			if !testCase.expected {
+				return
+			}
+
+			if !strings.HasPrefix(checksum.Hash, "hmac-sha256:") {
+				t.Fatalf("expected a keyed hash, got '%s'", checksum.Hash)
+			}
+
+			otherKey, _ := mutator.NewChecksum(mutator.SecretKind{}, secret, []byte("someotherkey"))
+			if checksum.Hash == otherKey.Hash {
+				t.Fatalf("expected hashes with different keys to differ, got '%s'", checksum.Hash)
+			}
+		})
+	}
+}
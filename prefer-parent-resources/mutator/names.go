@@ -0,0 +1,158 @@
+package mutator
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reverseTranslateName recovers the virtual name of an object from its physicalName and the
+// namespace of the virtual object. vcluster translates names to "<name>-x-<namespace>-x-<suffix>",
+// so the candidate virtual name is everything before the last "-x-<namespace>-x-", the candidate
+// is then translated with the mutators PhysicalNameFunc to verify it maps back to physicalName.
+// Names that vcluster had to shorten (by hashing) cannot be reverse translated, in that case false
+// is returned.
+func (m *referenceMutator) reverseTranslateName(physicalName, vNamespace string) (string, bool) {
+	if physicalName == "" || vNamespace == "" || m.physicalName == nil {
+		return "", false
+	}
+
+	i := strings.LastIndex(physicalName, "-x-"+vNamespace+"-x-")
+	if i <= 0 {
+		return "", false
+	}
+
+	vName := physicalName[:i]
+
+	if m.physicalName(vName, vNamespace) != physicalName {
+		return "", false
+	}
+
+	return vName, true
+}
+
+// resolveVirtualName returns the virtual name of the object referenced by ref on the physical pod.
+// The name is reverse translated using the pods virtual namespace annotation where possible, only
+// if that is not possible is the virtual pod fetched (at most once per mutation) and the name
+// found on the matching reference of the virtual pod. An empty name is returned if the reference
+// cannot be resolved, an error is only returned if fetching the virtual pod failed and the hooks
+// failure policy rejects the pod.
+func (m *referenceMutator) resolveVirtualName(
+	ctx context.Context,
+	pm *podMutation,
+	ref *reference,
+) (string, error) {
+	physicalName := ref.pName
+
+	vName, ok := m.reverseTranslateName(
+		physicalName,
+		pm.pod.Annotations[VirtualNamespaceAnnotation],
+	)
+	if ok {
+		return vName, nil
+	}
+
+	m.log.Debugf(
+		"cannot reverse translate name '%s' of pod '%s/%s', falling back to virtual pod",
+		physicalName,
+		pm.pod.Namespace,
+		pm.pod.Name,
+	)
+
+	vPod, err := m.virtualPod(ctx, pm)
+	if err != nil || vPod == nil {
+		return "", err
+	}
+
+	return m.virtualNameFromPod(vPod, ref), nil
+}
+
+// virtualPod returns the virtual pod of the pod being mutated, fetching it at most once per
+// mutation. If the mutator has no virtual reader a nil pod is returned, if fetching the virtual pod
+// failed a nil pod is returned along with an error if the hooks failure policy rejects the pod.
+func (m *referenceMutator) virtualPod(ctx context.Context, pm *podMutation) (*corev1.Pod, error) {
+	if pm.vPodFailed || m.virtualReader == nil {
+		return nil, nil
+	}
+
+	if pm.vPod == nil {
+		vPod, err := m.getVirtualPod(ctx, pm.pod)
+		if err != nil {
+			m.log.Errorf("mutate create physical failed fetching virtual pod")
+
+			pm.vPodFailed = true
+
+			lookupErr := &LookupError{}
+			if !errors.As(err, &lookupErr) {
+				return nil, err
+			}
+
+			return nil, m.handleLookupError(lookupErr)
+		}
+
+		pm.vPod = vPod
+	}
+
+	return pm.vPod, nil
+}
+
+// virtualNameFromPod returns the name of the object that the virtual pod vPod references in place
+// of the physical reference ref, that is, the name on the aligned reference of the virtual pod
+// that translates to the physical name. An empty string is returned if there is none.
+func (m *referenceMutator) virtualNameFromPod(vPod *corev1.Pod, ref *reference) string {
+	for _, vRef := range ref.kind.FindReferences(&vPod.Spec) {
+		vRef := vRef
+
+		if !ref.alignedWith(&vRef) {
+			continue
+		}
+
+		vName := ref.kind.GetName(&vPod.Spec, &vRef)
+
+		if m.physicalName(vName, vPod.Namespace) == ref.pName {
+			return vName
+		}
+	}
+
+	return ""
+}
+
+// resolveObjectReferences resolves the virtual names of the refs of an object (other than a pod)
+// in the virtual namespace vNamespace, and returns the resolved references. Names are reverse
+// translated where possible, otherwise virtualName is called to find the name on the virtual
+// object. References that cannot be resolved are dropped, an error is only returned if
+// virtualName returns one.
+func (m *referenceMutator) resolveObjectReferences(
+	ctx context.Context,
+	refs []*reference,
+	vNamespace string,
+	virtualName func(ref *reference) (string, error),
+) ([]*reference, error) {
+	var resolved []*reference
+
+	for _, ref := range refs {
+		vName, ok := m.reverseTranslateName(ref.pName, vNamespace)
+		if !ok {
+			var err error
+
+			vName, err = virtualName(ref)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if vName == "" {
+			m.recordDecision(ctx, ref, DecisionOutcomeUnresolved, "virtual name not resolved")
+
+			continue
+		}
+
+		ref.vName = vName
+
+		resolved = append(resolved, ref)
+	}
+
+	return resolved, nil
+}
@@ -0,0 +1,150 @@
+package mutator
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// MutationOutcomeIneligible is the outcome label value recorded when the parent object exists
+	// but its kind does not allow it to be substituted, so the reference falls back to the virtual
+	// object.
+	MutationOutcomeIneligible = "ineligible"
+)
+
+// getParentMetadata fetches only the metadata of the object with the given name from the
+// physical namespace. Reading metadata through the manager client means the manager cache only
+// holds metadata informers for the parent objects, rather than caching the data (and for secrets
+// the secret material) of every object in the physical namespace.
+func (m *referenceMutator) getParentMetadata(
+	ctx context.Context,
+	kind ReferenceableKind,
+	name string,
+) (*metav1.PartialObjectMetadata, error) {
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(kind.GroupVersionKind())
+
+	err := m.getParent(kind, name, func(key types.NamespacedName) error {
+		return m.parentMetadataReader.Get(ctx, key, obj)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// getParentObject fetches the full object with the given name from the physical namespace. The
+// object is read directly from the API server rather than the manager cache, so that the data of
+// the parent objects is not kept in memory beyond the lifetime of the request.
+func (m *referenceMutator) getParentObject(
+	ctx context.Context,
+	kind ReferenceableKind,
+	name string,
+) (ctrlruntimeclient.Object, error) {
+	var obj ctrlruntimeclient.Object
+
+	err := m.getParent(kind, name, func(key types.NamespacedName) error {
+		var err error
+
+		obj, err = kind.GetParent(ctx, m.parentReader, key)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// getParent fetches the object with the given name from the physical namespace using get,
+// applying the hooks failure policy. The lookup latency and any error other than not found are
+// recorded in the hook metrics. Errors other than not found are returned as a *LookupError.
+func (m *referenceMutator) getParent(
+	kind ReferenceableKind,
+	name string,
+	get func(key types.NamespacedName) error,
+) error {
+	err := m.withFailurePolicy(func() error {
+		start := time.Now()
+
+		err := get(types.NamespacedName{
+			Name:      name,
+			Namespace: m.physicalNamespace,
+		})
+
+		var recordErr error
+		if err != nil && !apimachineryerrors.IsNotFound(err) {
+			recordErr = err
+		}
+
+		recordParentLookup(m.name, kind.Name(), time.Since(start), recordErr)
+
+		return err
+	})
+	if err == nil || apimachineryerrors.IsNotFound(err) {
+		return err
+	}
+
+	return &LookupError{
+		Cluster:   LookupClusterParent,
+		Kind:      kind.Name(),
+		Namespace: m.physicalNamespace,
+		Name:      name,
+		Policy:    m.failurePolicy,
+		Err:       err,
+	}
+}
+
+// lookupParent looks up the parent object name of the given kind. Existence is checked with a
+// metadata only lookup, the full object is only fetched if fetch is true, that is, if the parent
+// object has to be validated, otherwise the objects metadata is returned. Errors are returned as
+// is, not found errors included, it is up to the caller to apply the failure policy.
+func (m *referenceMutator) lookupParent(
+	ctx context.Context,
+	kind ReferenceableKind,
+	name string,
+	fetch bool,
+) (ctrlruntimeclient.Object, error) {
+	meta, err := m.getParentMetadata(ctx, kind, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fetch {
+		return meta, nil
+	}
+
+	return m.getParentObject(ctx, kind, name)
+}
+
+// handleParentLookupError records the outcome of a failed parent lookup for each of the refs and,
+// for errors other than not found, applies the hooks failure policy.
+func (m *referenceMutator) handleParentLookupError(refs []*reference, err error) error {
+	outcome := MutationOutcomeError
+	if apimachineryerrors.IsNotFound(err) {
+		outcome = MutationOutcomeNotFound
+	}
+
+	for _, ref := range refs {
+		m.recordMutation(ref.kind, outcome)
+	}
+
+	if outcome == MutationOutcomeNotFound {
+		return nil
+	}
+
+	lookupErr := &LookupError{}
+	if !errors.As(err, &lookupErr) {
+		return err
+	}
+
+	return m.handleLookupError(lookupErr)
+}
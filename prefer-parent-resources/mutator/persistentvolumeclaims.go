@@ -0,0 +1,145 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// PersistentVolumeClaimsHookName is the name the settings of persistentvolumeclaim
+	// references, such as the enabled setting, are named by. There is no separate hook, the
+	// references are substituted by the hooks that handle every registered kind.
+	PersistentVolumeClaimsHookName = "prefer-parent-persistentvolumeclaims-hook"
+
+	// SkipPreferPersistentVolumeClaimsHook is the annotation key that, if any value is set, will
+	// cause this plugin to skip preferring the parent (physical/real) persistentvolumeclaim
+	// resources.
+	SkipPreferPersistentVolumeClaimsHook = "skip-prefer-parent-persistentvolumeclaims-hook"
+
+	// DryRunPreferPersistentVolumeClaimsHook is the annotation key that, if set to "true" or
+	// "false", overrides the hooks dry run setting for the pod. In dry run mode the
+	// persistentvolumeclaim references are resolved as usual but left unchanged, the substitutions
+	// that would have been made are recorded on the pod.
+	DryRunPreferPersistentVolumeClaimsHook = "dry-run-prefer-parent-persistentvolumeclaims-hook"
+)
+
+// PersistentVolumeClaimKind is the ReferenceableKind of persistentvolumeclaims, referenced by pods
+// as volumes.
+type PersistentVolumeClaimKind struct {
+	// ForceReadOnly mounts substituted claims read only.
+	ForceReadOnly bool
+}
+
+// Name returns the name of the kind.
+func (PersistentVolumeClaimKind) Name() string {
+	return "persistentvolumeclaim"
+}
+
+// HookName returns the name the settings of persistentvolumeclaim references are named by.
+func (PersistentVolumeClaimKind) HookName() string {
+	return PersistentVolumeClaimsHookName
+}
+
+// SkipAnnotation returns the persistentvolumeclaim skip annotation key.
+func (PersistentVolumeClaimKind) SkipAnnotation() string {
+	return SkipPreferPersistentVolumeClaimsHook
+}
+
+// DryRunAnnotation returns the persistentvolumeclaim dry run annotation key.
+func (PersistentVolumeClaimKind) DryRunAnnotation() string {
+	return DryRunPreferPersistentVolumeClaimsHook
+}
+
+// GroupVersionKind returns the GroupVersionKind of persistentvolumeclaims.
+func (PersistentVolumeClaimKind) GroupVersionKind() schema.GroupVersionKind {
+	return corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim")
+}
+
+// FindReferences returns the references to persistentvolumeclaims mounted as volumes in the pod
+// spec.
+func (PersistentVolumeClaimKind) FindReferences(podSpec *corev1.PodSpec) []Reference {
+	var refs []Reference
+
+	for volI := range podSpec.Volumes {
+		vol := &podSpec.Volumes[volI]
+
+		if vol.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		refs = append(refs, Reference{
+			Source:      ReferenceSourceVolume,
+			VolumeIndex: volI,
+			Volume:      vol.Name,
+		})
+	}
+
+	return refs
+}
+
+// GetName returns the name of the persistentvolumeclaim ref refers to.
+func (PersistentVolumeClaimKind) GetName(podSpec *corev1.PodSpec, ref *Reference) string {
+	if ref.Source != ReferenceSourceVolume {
+		return ""
+	}
+
+	return podSpec.Volumes[ref.VolumeIndex].PersistentVolumeClaim.ClaimName
+}
+
+// SetName rewrites ref to refer to the persistentvolumeclaim name, if ForceReadOnly is set the
+// claim is mounted read only as well.
+func (k PersistentVolumeClaimKind) SetName(podSpec *corev1.PodSpec, ref *Reference, name string) {
+	if ref.Source != ReferenceSourceVolume {
+		return
+	}
+
+	claim := podSpec.Volumes[ref.VolumeIndex].PersistentVolumeClaim
+
+	claim.ClaimName = name
+
+	if k.ForceReadOnly {
+		claim.ReadOnly = true
+	}
+}
+
+// GetParent fetches the persistentvolumeclaim with the given key.
+func (PersistentVolumeClaimKind) GetParent(
+	ctx context.Context,
+	reader ctrlruntimeclient.Reader,
+	key types.NamespacedName,
+) (ctrlruntimeclient.Object, error) {
+	obj := &corev1.PersistentVolumeClaim{}
+
+	err := reader.Get(ctx, key, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ValidateParent returns an error if the access modes of the persistentvolumeclaim obj do not
+// allow it to be mounted by many pods, that is, if it is neither ReadOnlyMany nor ReadWriteMany.
+func (PersistentVolumeClaimKind) ValidateParent(obj ctrlruntimeclient.Object) error {
+	claim, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return fmt.Errorf("%w: object %v is not a persistentvolumeclaim", ErrWrongResourceType, obj)
+	}
+
+	for _, mode := range claim.Spec.AccessModes {
+		if mode == corev1.ReadOnlyMany || mode == corev1.ReadWriteMany {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"%w: access modes %v do not allow sharing the claim",
+		ErrParentNotEligible,
+		claim.Spec.AccessModes,
+	)
+}
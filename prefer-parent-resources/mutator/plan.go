@@ -0,0 +1,401 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+
+	apimachineryerrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// parentGroup is the set of references of a pod to the same parent object.
+type parentGroup struct {
+	kind  ReferenceableKind
+	vName string
+	refs  []*reference
+}
+
+// splitSkipped splits the group in to the group of its skipped references and the group of its
+// other references.
+func (g *parentGroup) splitSkipped() (skipped, unskipped *parentGroup) {
+	skipped = &parentGroup{kind: g.kind, vName: g.vName}
+	unskipped = &parentGroup{kind: g.kind, vName: g.vName}
+
+	for _, ref := range g.refs {
+		if ref.skipped {
+			skipped.refs = append(skipped.refs, ref)
+		} else {
+			unskipped.refs = append(unskipped.refs, ref)
+		}
+	}
+
+	return skipped, unskipped
+}
+
+// needsData returns true if the parent object has to be fetched in full, that is, if its kind
+// validates parent objects.
+func (g *parentGroup) needsData() bool {
+	_, ok := g.kind.(ParentValidator)
+
+	return ok
+}
+
+// groupReferences groups the (resolved) refs by the parent object they refer to, preserving the
+// order in which the parent objects are first referenced.
+func groupReferences(refs []*reference) []*parentGroup {
+	var groups []*parentGroup
+
+	byParent := map[string]*parentGroup{}
+
+	for _, ref := range refs {
+		key := ref.kind.Name() + "/" + ref.vName
+
+		group, ok := byParent[key]
+		if !ok {
+			group = &parentGroup{kind: ref.kind, vName: ref.vName}
+
+			byParent[key] = group
+			groups = append(groups, group)
+		}
+
+		group.refs = append(group.refs, ref)
+	}
+
+	return groups
+}
+
+// planMutation resolves the refs of the pod being mutated and returns the references that should
+// be substituted. Each distinct parent object is looked up once, regardless of how many
+// references to it the pod holds. Nothing is written to the pod while planning, if a lookup fails
+// and the failure policy rejects the pod the error is returned and the pod is left unchanged.
+func (m *referenceMutator) planMutation(
+	ctx context.Context,
+	pm *podMutation,
+	refs []*reference,
+) ([]*reference, error) {
+	var resolved []*reference
+
+	for _, ref := range refs {
+		vName, err := m.resolveVirtualName(ctx, pm, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if vName == "" {
+			m.recordDecision(ctx, ref, DecisionOutcomeUnresolved, "virtual name not resolved")
+
+			continue
+		}
+
+		ref.vName = vName
+
+		resolved = append(resolved, ref)
+	}
+
+	return m.planParents(ctx, pm.pod, resolved)
+}
+
+// planParents looks up the parent objects of the resolved references of the object obj and
+// returns the references that should be substituted, in the order of resolved. Each distinct
+// parent object is looked up once. An error is returned if a lookup failed and the failure policy
+// rejects the object, or if references to enforced parent objects cannot be substituted.
+func (m *referenceMutator) planParents(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+	resolved []*reference,
+) ([]*reference, error) {
+	groups := groupReferences(resolved)
+	if len(groups) == 0 {
+		return nil, nil
+	}
+
+	var (
+		grants       grantSet
+		grantsLoaded bool
+	)
+
+	substitute := map[*reference]bool{}
+	unsatisfied := map[*reference]string{}
+	decisions := map[*reference]refDecision{}
+
+	for _, group := range groups {
+		gp, lookup := m.filterGroup(group)
+
+		if lookup != nil {
+			// grants are only loaded once a parent object is looked up
+			if !grantsLoaded {
+				var err error
+
+				grants, err = m.requiredGrants(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				grantsLoaded = true
+			}
+
+			err := m.planLookup(ctx, obj, grants, gp, lookup)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, ref := range group.refs {
+			d, ok := gp.decisions[ref]
+
+			switch {
+			case !ok:
+				substitute[ref] = true
+			case gp.enforced &&
+				d.outcome != DecisionOutcomeSkipped &&
+				d.outcome != MutationOutcomeReserved:
+				// reserved parent objects are never substituted, enforcing the hook does not
+				// require them
+				unsatisfied[ref] = d.reason
+			}
+
+			decisions[ref] = d
+		}
+	}
+
+	// the plan keeps the references in the order they appear on the pod rather than grouped by
+	// parent object
+	var plan []*reference
+
+	for _, ref := range resolved {
+		if substitute[ref] {
+			plan = append(plan, ref)
+		}
+	}
+
+	err := m.checkEnforced(obj, resolved, unsatisfied)
+	if err != nil {
+		return nil, err
+	}
+
+	m.diffShadowedParents(ctx, obj, plan)
+
+	for _, ref := range resolved {
+		d := decisions[ref]
+
+		if substitute[ref] {
+			d.outcome = MutationOutcomeSubstituted
+			if m.isDryRun(obj, ref.kind) {
+				d.outcome = MutationOutcomeDryRun
+			}
+		}
+
+		m.recordDecision(ctx, ref, d.outcome, d.reason)
+	}
+
+	return plan, nil
+}
+
+// refDecision is the outcome of planning a single reference, and the reason for it.
+type refDecision struct {
+	outcome string
+	reason  string
+}
+
+// groupPlan is the outcome of planning the references of a parentGroup.
+type groupPlan struct {
+	// enforced is true if the references of the group must be substituted, that is, if the hook
+	// or the parent object is enforced.
+	enforced bool
+	// decisions are the decisions for the references of the group that are not substituted.
+	decisions map[*reference]refDecision
+}
+
+// notSubstituted records the outcome and reason every reference of refs is not substituted.
+func (p *groupPlan) notSubstituted(refs []*reference, outcome, reason string) {
+	for _, ref := range refs {
+		p.decisions[ref] = refDecision{outcome: outcome, reason: reason}
+	}
+}
+
+// filterGroup returns the plan of the group and the group of its references whose parent object
+// has to be looked up, or nil if there are none. Skipped references (see skipKind) are filtered
+// out unless the mutator enforces the parent object, references to reserved names are filtered
+// out as well, neither is looked up.
+func (m *referenceMutator) filterGroup(group *parentGroup) (*groupPlan, *parentGroup) {
+	gp := &groupPlan{
+		enforced:  m.enforcement.enforces(group.kind, group.vName),
+		decisions: map[*reference]refDecision{},
+	}
+
+	skipped, unskipped := group.splitSkipped()
+
+	if gp.enforced && len(skipped.refs) > 0 {
+		m.log.Infof(
+			"ignoring %s skip annotation for enforced %s '%s'",
+			group.kind.Name(),
+			group.kind.Name(),
+			group.vName,
+		)
+
+		skipped, unskipped = &parentGroup{kind: group.kind, vName: group.vName}, group
+	}
+
+	gp.notSubstituted(skipped.refs, DecisionOutcomeSkipped, "skip annotation set")
+
+	if len(unskipped.refs) == 0 {
+		// only skipped references, the object opted out of preferring this parent object
+		return gp, nil
+	}
+
+	if m.reserved.reservedName(group.vName) {
+		m.skipReserved(unskipped)
+		gp.notSubstituted(unskipped.refs, MutationOutcomeReserved, reservedReason)
+
+		return gp, nil
+	}
+
+	return gp, unskipped
+}
+
+// planLookup looks up the parent object of the group and determines which of its references are
+// substituted, recording the decisions in gp.
+func (m *referenceMutator) planLookup(
+	ctx context.Context,
+	obj ctrlruntimeclient.Object,
+	grants grantSet,
+	gp *groupPlan,
+	group *parentGroup,
+) error {
+	parent, err := m.lookupParent(
+		ctx,
+		group.kind,
+		group.vName,
+		group.needsData() || m.reserved.needsData(group.kind) || m.checksumsNeedData(group.kind),
+	)
+	if err != nil {
+		outcome := MutationOutcomeError
+		if apimachineryerrors.IsNotFound(err) {
+			outcome = MutationOutcomeNotFound
+		}
+
+		gp.notSubstituted(group.refs, outcome, lookupFailedReason(err))
+
+		return m.handleParentLookupError(group.refs, err)
+	}
+
+	if enforcedParent(parent) {
+		gp.enforced = true
+	}
+
+	outcome, reason := m.parentDenial(obj, grants, group, parent)
+	if reason != "" {
+		gp.notSubstituted(group.refs, outcome, reason)
+
+		return nil
+	}
+
+	for _, ref := range group.refs {
+		ref.parent = parent
+	}
+
+	return nil
+}
+
+// parentDenial returns the outcome and reason the parent object of the group may not be
+// substituted for the object obj -- because it is reserved or ineligible, not granted, or
+// restricted -- or an empty reason if it may.
+func (m *referenceMutator) parentDenial(
+	obj ctrlruntimeclient.Object,
+	grants grantSet,
+	group *parentGroup,
+	parent ctrlruntimeclient.Object,
+) (outcome, reason string) {
+	reason = m.ineligibleReason(group, parent)
+
+	switch {
+	case reason == reservedReason:
+		return MutationOutcomeReserved, reason
+	case reason != "":
+		return MutationOutcomeIneligible, reason
+	}
+
+	reason = m.grantDeniedReason(grants, obj, group)
+	if reason == "" {
+		reason = m.restrictedReason(obj, group, parent)
+	}
+
+	return MutationOutcomeDenied, reason
+}
+
+// skipReserved logs and records the outcome of the references of the group to a reserved parent
+// object.
+func (m *referenceMutator) skipReserved(group *parentGroup) {
+	m.log.Infof(
+		"host cluster %s '%s/%s' is reserved, skipping...",
+		group.kind.Name(),
+		m.physicalNamespace,
+		group.vName,
+	)
+
+	for range group.refs {
+		m.recordMutation(group.kind, MutationOutcomeReserved)
+	}
+}
+
+// ineligibleReason returns the reason the parent object of the group may not be substituted, or
+// an empty string if it may, that is, if it is not reserved and its kind does not validate parent
+// objects or the parent object is valid. The outcome of reserved and ineligible parents is
+// recorded for every reference of the group.
+func (m *referenceMutator) ineligibleReason(
+	group *parentGroup,
+	parent ctrlruntimeclient.Object,
+) string {
+	if m.reserved.reservedObject(parent) {
+		m.skipReserved(group)
+
+		return reservedReason
+	}
+
+	validator, ok := group.kind.(ParentValidator)
+	if !ok {
+		return ""
+	}
+
+	err := validator.ValidateParent(parent)
+	if err == nil {
+		return ""
+	}
+
+	m.log.Infof(
+		"host cluster %s '%s/%s' is not eligible, skipping... error: '%s'",
+		group.kind.Name(),
+		m.physicalNamespace,
+		group.vName,
+		err,
+	)
+
+	for range group.refs {
+		m.recordMutation(group.kind, MutationOutcomeIneligible)
+	}
+
+	return fmt.Sprintf("not eligible: %s", err)
+}
+
+// applyMutation substitutes every reference of the plan on the pod being mutated, and returns the
+// references that were substituted, that is, the references whose kind is not in dry run mode.
+func (m *referenceMutator) applyMutation(pm *podMutation, plan []*reference) []*reference {
+	var applied []*reference
+
+	for _, ref := range plan {
+		ref := ref
+
+		s, ok := m.substitute(pm.pod, ref, func() {
+			ref.kind.SetName(&pm.pod.Spec, &ref.Reference, ref.vName)
+		})
+		if !ok {
+			pm.dryRunSubstitutions = append(pm.dryRunSubstitutions, s)
+
+			continue
+		}
+
+		applied = append(applied, ref)
+	}
+
+	return applied
+}
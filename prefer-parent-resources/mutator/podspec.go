@@ -0,0 +1,221 @@
+package mutator
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ContainerType is the list of containers of a pod spec a container is found in.
+type ContainerType string
+
+const (
+	// ContainerTypeContainer is the ContainerType of the (regular) containers of a pod spec.
+	ContainerTypeContainer ContainerType = "container"
+	// ContainerTypeInitContainer is the ContainerType of the init containers of a pod spec.
+	ContainerTypeInitContainer ContainerType = "initContainer"
+	// ContainerTypeEphemeralContainer is the ContainerType of the ephemeral containers of a pod
+	// spec.
+	ContainerTypeEphemeralContainer ContainerType = "ephemeralContainer"
+)
+
+// podContainer is a container of any of the container lists of a pod spec. The env and envFrom
+// slices share their backing arrays with the pod spec, so that references can be rewritten
+// through them.
+type podContainer struct {
+	containerType ContainerType
+	index         int
+	name          string
+	env           []corev1.EnvVar
+	envFrom       []corev1.EnvFromSource
+}
+
+// podContainers returns the containers, init containers and ephemeral containers of the pod spec.
+func podContainers(podSpec *corev1.PodSpec) []podContainer {
+	containers := make(
+		[]podContainer,
+		0,
+		len(podSpec.Containers)+len(podSpec.InitContainers)+len(podSpec.EphemeralContainers),
+	)
+
+	for i := range podSpec.Containers {
+		containers = append(containers, podContainerAt(podSpec, ContainerTypeContainer, i))
+	}
+
+	for i := range podSpec.InitContainers {
+		containers = append(containers, podContainerAt(podSpec, ContainerTypeInitContainer, i))
+	}
+
+	for i := range podSpec.EphemeralContainers {
+		containers = append(
+			containers,
+			podContainerAt(podSpec, ContainerTypeEphemeralContainer, i),
+		)
+	}
+
+	return containers
+}
+
+// podContainerAt returns the container at index of the container list containerType of the pod
+// spec.
+func podContainerAt(
+	podSpec *corev1.PodSpec,
+	containerType ContainerType,
+	index int,
+) podContainer {
+	c := podContainer{containerType: containerType, index: index}
+
+	switch containerType {
+	case ContainerTypeInitContainer:
+		container := &podSpec.InitContainers[index]
+		c.name, c.env, c.envFrom = container.Name, container.Env, container.EnvFrom
+	case ContainerTypeEphemeralContainer:
+		container := &podSpec.EphemeralContainers[index]
+		c.name, c.env, c.envFrom = container.Name, container.Env, container.EnvFrom
+	default:
+		container := &podSpec.Containers[index]
+		c.name, c.env, c.envFrom = container.Name, container.Env, container.EnvFrom
+	}
+
+	return c
+}
+
+// podSpecReferences describes where the objects of a kind are referenced in pod specs, it is
+// shared by the kinds referenced from containers and volumes, such as configmaps and secrets.
+// Each function returns a pointer to the name of the referenced object, or nil if the part of the
+// pod spec does not reference an object of the kind, a nil function means the kind is never
+// referenced from that part.
+type podSpecReferences struct {
+	env        func(env *corev1.EnvVar) *string
+	envFrom    func(envFrom *corev1.EnvFromSource) *string
+	volume     func(vol *corev1.Volume) *string
+	projection func(projection *corev1.VolumeProjection) *string
+	// imagePullSecrets is true if the kind is referenced by the image pull secrets of pods.
+	imagePullSecrets bool
+}
+
+// find returns the references of the pod spec in a single walk: the environment variables and
+// environment sources of every container, init container and ephemeral container, the volumes
+// and the sources of projected volumes, and the image pull secrets.
+func (p *podSpecReferences) find(podSpec *corev1.PodSpec) []Reference {
+	var refs []Reference
+
+	for _, c := range podContainers(podSpec) {
+		refs = append(refs, p.findContainer(c)...)
+	}
+
+	for volI := range podSpec.Volumes {
+		vol := &podSpec.Volumes[volI]
+
+		if p.volume != nil && p.volume(vol) != nil {
+			refs = append(refs, Reference{
+				Source:      ReferenceSourceVolume,
+				VolumeIndex: volI,
+				Volume:      vol.Name,
+			})
+		}
+
+		if p.projection == nil || vol.Projected == nil {
+			continue
+		}
+
+		for sourceI := range vol.Projected.Sources {
+			if p.projection(&vol.Projected.Sources[sourceI]) == nil {
+				continue
+			}
+
+			refs = append(refs, Reference{
+				Source:          ReferenceSourceProjection,
+				VolumeIndex:     volI,
+				Volume:          vol.Name,
+				ProjectionIndex: sourceI,
+			})
+		}
+	}
+
+	if p.imagePullSecrets {
+		for i := range podSpec.ImagePullSecrets {
+			refs = append(refs, Reference{Source: ReferenceSourceImagePullSecret, Index: i})
+		}
+	}
+
+	return refs
+}
+
+// findContainer returns the references of the environment variables and environment sources of
+// the container c.
+func (p *podSpecReferences) findContainer(c podContainer) []Reference {
+	var refs []Reference
+
+	for envI := range c.env {
+		if p.env == nil || p.env(&c.env[envI]) == nil {
+			continue
+		}
+
+		refs = append(refs, Reference{
+			Source:         ReferenceSourceEnv,
+			ContainerType:  c.containerType,
+			ContainerIndex: c.index,
+			Container:      c.name,
+			EnvIndex:       envI,
+			Env:            c.env[envI].Name,
+		})
+	}
+
+	for envFromI := range c.envFrom {
+		if p.envFrom == nil || p.envFrom(&c.envFrom[envFromI]) == nil {
+			continue
+		}
+
+		refs = append(refs, Reference{
+			Source:         ReferenceSourceEnvFrom,
+			ContainerType:  c.containerType,
+			ContainerIndex: c.index,
+			Container:      c.name,
+			EnvFromIndex:   envFromI,
+		})
+	}
+
+	return refs
+}
+
+// namePtr returns a pointer to the name of the object ref refers to in the pod spec, or nil if
+// ref is not a reference of the kind.
+func (p *podSpecReferences) namePtr(podSpec *corev1.PodSpec, ref *Reference) *string {
+	switch ref.Source {
+	case ReferenceSourceEnv:
+		if p.env == nil {
+			return nil
+		}
+
+		return p.env(&podContainerAt(podSpec, ref.ContainerType, ref.ContainerIndex).
+			env[ref.EnvIndex])
+	case ReferenceSourceEnvFrom:
+		if p.envFrom == nil {
+			return nil
+		}
+
+		return p.envFrom(&podContainerAt(podSpec, ref.ContainerType, ref.ContainerIndex).
+			envFrom[ref.EnvFromIndex])
+	case ReferenceSourceVolume:
+		if p.volume == nil {
+			return nil
+		}
+
+		return p.volume(&podSpec.Volumes[ref.VolumeIndex])
+	case ReferenceSourceProjection:
+		if p.projection == nil {
+			return nil
+		}
+
+		return p.projection(
+			&podSpec.Volumes[ref.VolumeIndex].Projected.Sources[ref.ProjectionIndex],
+		)
+	case ReferenceSourceImagePullSecret:
+		if !p.imagePullSecrets {
+			return nil
+		}
+
+		return &podSpec.ImagePullSecrets[ref.Index].Name
+	default:
+		return nil
+	}
+}
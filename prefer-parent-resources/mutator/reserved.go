@@ -0,0 +1,162 @@
+package mutator
+
+import (
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// MutationOutcomeReserved is the outcome label value recorded when the parent object has a
+	// reserved name or (secret) type, so the reference keeps pointing at the virtual object.
+	MutationOutcomeReserved = "reserved"
+
+	// SecretTypeHelmRelease is the type of the secrets helm stores releases in.
+	SecretTypeHelmRelease corev1.SecretType = "helm.sh/release.v1"
+
+	// helmOwnerLabel is the label helm sets to "helm" on the secrets it stores releases in.
+	helmOwnerLabel = "owner"
+)
+
+// secretTypeMatchers recognize secrets of some secret types by their metadata, so that checking
+// whether parent secrets of these types are reserved does not require fetching them in full.
+//
+//nolint:gochecknoglobals
+var secretTypeMatchers = map[corev1.SecretType]func(obj ctrlruntimeclient.Object) bool{
+	// the API server requires service account token secrets to name their service account
+	corev1.SecretTypeServiceAccountToken: func(obj ctrlruntimeclient.Object) bool {
+		_, ok := obj.GetAnnotations()[corev1.ServiceAccountNameKey]
+
+		return ok
+	},
+	SecretTypeHelmRelease: func(obj ctrlruntimeclient.Object) bool {
+		return obj.GetLabels()[helmOwnerLabel] == "helm"
+	},
+}
+
+// reservedParents is the deny list of parent objects the hooks never substitute. vcluster manages
+// some objects -- like the kube-root-ca.crt configmap and service account token secrets -- itself,
+// substituting a parent object of the same name would for example break the in-cluster API trust
+// of every pod.
+type reservedParents struct {
+	mu          sync.RWMutex
+	names       map[string]bool
+	secretTypes map[corev1.SecretType]bool
+}
+
+//nolint:gochecknoglobals
+var reserved = &reservedParents{
+	names: map[string]bool{
+		"kube-root-ca.crt": true,
+	},
+	secretTypes: map[corev1.SecretType]bool{
+		corev1.SecretTypeServiceAccountToken: true,
+		SecretTypeHelmRelease:                true,
+	},
+}
+
+// ReserveNames adds names to the names of parent objects, of any kind, that the hooks never
+// substitute. Names must be reserved before the hooks are created.
+func ReserveNames(names ...string) {
+	reserved.mu.Lock()
+	defer reserved.mu.Unlock()
+
+	for _, name := range names {
+		reserved.names[name] = true
+	}
+}
+
+// ReserveSecretTypes adds secretTypes to the types of parent secrets that the hooks never
+// substitute. Secret types must be reserved before the hooks are created.
+func ReserveSecretTypes(secretTypes ...corev1.SecretType) {
+	reserved.mu.Lock()
+	defer reserved.mu.Unlock()
+
+	for _, secretType := range secretTypes {
+		reserved.secretTypes[secretType] = true
+	}
+}
+
+// newReservedParents returns a copy of the reserved names and secret types, including the given
+// names and secretTypes.
+func newReservedParents(names []string, secretTypes []corev1.SecretType) *reservedParents {
+	reserved.mu.RLock()
+	defer reserved.mu.RUnlock()
+
+	r := &reservedParents{
+		names:       map[string]bool{},
+		secretTypes: map[corev1.SecretType]bool{},
+	}
+
+	for name := range reserved.names {
+		r.names[name] = true
+	}
+
+	for secretType := range reserved.secretTypes {
+		r.secretTypes[secretType] = true
+	}
+
+	for _, name := range names {
+		r.names[name] = true
+	}
+
+	for _, secretType := range secretTypes {
+		r.secretTypes[secretType] = true
+	}
+
+	return r
+}
+
+// reservedName returns true if parent objects named name are never substituted.
+func (r *reservedParents) reservedName(name string) bool {
+	return r.names[name]
+}
+
+// needsData returns true if parent objects of kind have to be fetched in full to check whether
+// they are reserved, that is, if kind is a secret kind and any of the reserved secret types cannot
+// be recognized by the metadata of secrets.
+func (r *reservedParents) needsData(kind ReferenceableKind) bool {
+	if !isSecretKind(kind.GroupVersionKind()) {
+		return false
+	}
+
+	for secretType := range r.secretTypes {
+		if _, ok := secretTypeMatchers[secretType]; !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reservedObject returns true if the parent object obj has a reserved name or secret type. If obj
+// only holds the metadata of a secret, its type is recognized by its metadata, see needsData.
+func (r *reservedParents) reservedObject(obj ctrlruntimeclient.Object) bool {
+	if r.reservedName(obj.GetName()) {
+		return true
+	}
+
+	if secret, ok := obj.(*corev1.Secret); ok {
+		return r.secretTypes[secret.Type]
+	}
+
+	if !isSecretKind(obj.GetObjectKind().GroupVersionKind()) {
+		return false
+	}
+
+	for secretType := range r.secretTypes {
+		matches, ok := secretTypeMatchers[secretType]
+		if ok && matches(obj) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSecretKind returns true if gvk is the GroupVersionKind of secrets.
+func isSecretKind(gvk schema.GroupVersionKind) bool {
+	return gvk == SecretKind{}.GroupVersionKind()
+}
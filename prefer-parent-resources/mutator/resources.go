@@ -0,0 +1,56 @@
+package mutator
+
+import (
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reference is a single reference of the pod being mutated to an object of a ReferenceableKind.
+type reference struct {
+	Reference
+
+	kind ReferenceableKind
+	// pName is the (physical) name of the referenced object on the pod.
+	pName string
+	// vName is the resolved virtual name of the referenced object.
+	vName string
+	// skipped is true if the skip annotation of the kind is set on the object being mutated, the
+	// reference is then only looked up and substituted if the mutator enforces its parent object.
+	skipped bool
+	// parent is the parent object of the reference, set once the reference is planned to be
+	// substituted. Unless the parent object had to be fetched in full it only holds metadata.
+	parent ctrlruntimeclient.Object
+	// diff is set if the parent object shadows a virtual object holding different data.
+	diff *ObjectDiff
+}
+
+// location returns a human-readable description of where the reference is found.
+func (r *reference) location() string {
+	return r.substitution().location()
+}
+
+// substitution returns the Substitution that rewriting the reference makes.
+func (r *reference) substitution() Substitution {
+	s := Substitution{
+		Kind:      r.kind.Name(),
+		Container: r.Container,
+		Env:       r.Env,
+		Volume:    r.Volume,
+		Field:     r.Field,
+		From:      r.pName,
+		To:        r.vName,
+		Diff:      r.diff,
+	}
+
+	switch r.Source {
+	case ReferenceSourceEnv, ReferenceSourceVolume, ReferenceSourceField:
+		// located by their container and env, volume or field
+	case ReferenceSourceEnvFrom:
+		s.Source, s.Index = r.Source, r.EnvFromIndex
+	case ReferenceSourceProjection:
+		s.Source, s.Index = r.Source, r.ProjectionIndex
+	default:
+		s.Source, s.Index = r.Source, r.Index
+	}
+
+	return s
+}
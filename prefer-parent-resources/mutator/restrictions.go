@@ -0,0 +1,79 @@
+package mutator
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// AllowedNamespacesAnnotation is the parent object annotation listing (comma separated) the
+	// virtual namespaces that may consume the parent object. If unset every namespace may.
+	AllowedNamespacesAnnotation = "prefer-parent/allowed-namespaces"
+	// AllowedSelectorAnnotation is the parent object annotation holding a label selector, for
+	// example "app=api,tier in (backend)", that the labels of the consuming objects (generally
+	// pods) must match. If unset every object may consume the parent object.
+	AllowedSelectorAnnotation = "prefer-parent/allowed-selector"
+)
+
+// restrictedReason returns the reason the annotations of the parent object deny the object obj
+// consuming it, or an empty string if they allow it. Parent objects without the
+// AllowedNamespacesAnnotation and AllowedSelectorAnnotation annotations may be consumed by any
+// object. Denials are handled as those of grants.
+func (m *referenceMutator) restrictedReason(
+	obj ctrlruntimeclient.Object,
+	group *parentGroup,
+	parent ctrlruntimeclient.Object,
+) string {
+	reason := consumerRestriction(obj, parent, m.physicalLabelKey)
+	if reason != "" {
+		m.denyParent(obj, group, reason)
+	}
+
+	return reason
+}
+
+// consumerRestriction returns the reason the annotations of the parent object deny the object obj
+// consuming it, or an empty string if they allow it. The allowed selector selects virtual
+// objects, its keys are translated with labelKey before matching the labels of obj.
+func consumerRestriction(
+	obj, parent ctrlruntimeclient.Object,
+	labelKey PhysicalLabelKeyFunc,
+) string {
+	annotations := parent.GetAnnotations()
+
+	if v, ok := annotations[AllowedNamespacesAnnotation]; ok {
+		vNamespace := obj.GetAnnotations()[VirtualNamespaceAnnotation]
+
+		allowed := SplitList(v)
+		if !containsString(allowed, vNamespace) {
+			return fmt.Sprintf(
+				"namespace '%s' is not in the allowed namespaces %v of the parent object",
+				vNamespace,
+				allowed,
+			)
+		}
+	}
+
+	if v, ok := annotations[AllowedSelectorAnnotation]; ok {
+		selector, err := labels.Parse(v)
+		if err == nil {
+			selector, err = physicalSelector(selector, labelKey)
+		}
+
+		if err != nil {
+			return fmt.Sprintf("invalid allowed selector '%s' of the parent object: %s", v, err)
+		}
+
+		if !selector.Matches(labels.Set(obj.GetLabels())) {
+			return fmt.Sprintf(
+				"labels of '%s' do not match the allowed selector '%s' of the parent object",
+				obj.GetAnnotations()[VirtualNameAnnotation],
+				v,
+			)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,178 @@
+//nolint:dupl
+package mutator
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SecretsHookName is the name of the hook (and Mutator) that substitutes only secrets.
+	SecretsHookName = "prefer-parent-secrets-hook"
+
+	// SkipPreferSecretsHook is the annotation key that, if any value is set, will cause this
+	// plugin to skip preferring the parent (physical/real) secret resources.
+	SkipPreferSecretsHook = "skip-prefer-parent-secrets-hook"
+
+	// DryRunPreferSecretsHook is the annotation key that, if set to "true" or "false", overrides the
+	// hooks dry run setting for the pod. In dry run mode the secret references are resolved as usual
+	// but left unchanged, the substitutions that would have been made are recorded on the pod.
+	DryRunPreferSecretsHook = "dry-run-prefer-parent-secrets-hook"
+)
+
+// SecretKind is the ReferenceableKind of secrets, referenced by pods as environment variables
+// (secretKeyRef), environment sources (secretRef), volumes, projected volume sources and image
+// pull secrets.
+type SecretKind struct{}
+
+// Name returns the name of the kind.
+func (SecretKind) Name() string {
+	return "secret"
+}
+
+// HookName returns the name of the hook that mutates only secrets.
+func (SecretKind) HookName() string {
+	return SecretsHookName
+}
+
+// SkipAnnotation returns the secret skip annotation key.
+func (SecretKind) SkipAnnotation() string {
+	return SkipPreferSecretsHook
+}
+
+// DryRunAnnotation returns the secret dry run annotation key.
+func (SecretKind) DryRunAnnotation() string {
+	return DryRunPreferSecretsHook
+}
+
+// GroupVersionKind returns the GroupVersionKind of secrets.
+func (SecretKind) GroupVersionKind() schema.GroupVersionKind {
+	return corev1.SchemeGroupVersion.WithKind("Secret")
+}
+
+// FindReferences returns the references to secrets in the pod spec: environment variables
+// and environment sources of every container, init container and ephemeral container, volumes and
+// projected volume sources, and image pull secrets.
+func (k SecretKind) FindReferences(podSpec *corev1.PodSpec) []Reference {
+	return k.references().find(podSpec)
+}
+
+// GetName returns the name of the secret ref refers to.
+func (k SecretKind) GetName(podSpec *corev1.PodSpec, ref *Reference) string {
+	name := k.references().namePtr(podSpec, ref)
+	if name == nil {
+		return ""
+	}
+
+	return *name
+}
+
+// SetName rewrites ref to refer to the secret name.
+func (k SecretKind) SetName(podSpec *corev1.PodSpec, ref *Reference, name string) {
+	namePtr := k.references().namePtr(podSpec, ref)
+	if namePtr == nil {
+		return
+	}
+
+	*namePtr = name
+}
+
+// references returns where secrets are referenced in pod specs.
+func (SecretKind) references() *podSpecReferences {
+	return &podSpecReferences{
+		env: func(env *corev1.EnvVar) *string {
+			if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+				return nil
+			}
+
+			return &env.ValueFrom.SecretKeyRef.Name
+		},
+		envFrom: func(envFrom *corev1.EnvFromSource) *string {
+			if envFrom.SecretRef == nil {
+				return nil
+			}
+
+			return &envFrom.SecretRef.Name
+		},
+		volume: func(vol *corev1.Volume) *string {
+			if vol.Secret == nil {
+				return nil
+			}
+
+			return &vol.Secret.SecretName
+		},
+		projection: func(projection *corev1.VolumeProjection) *string {
+			if projection.Secret == nil {
+				return nil
+			}
+
+			return &projection.Secret.Name
+		},
+		imagePullSecrets: true,
+	}
+}
+
+// GetParent fetches the secret with the given key.
+func (SecretKind) GetParent(
+	ctx context.Context,
+	reader ctrlruntimeclient.Reader,
+	key types.NamespacedName,
+) (ctrlruntimeclient.Object, error) {
+	obj := &corev1.Secret{}
+
+	err := reader.Get(ctx, key, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// HashParent returns the hmac of the data of the secret obj keyed with key, string data takes
+// precedence over data like it does when the API server merges it. The data of secrets is never
+// hashed without a key, so that it cannot be brute forced from the pods the hash is recorded on,
+// an empty string is returned if key is empty.
+func (SecretKind) HashParent(obj ctrlruntimeclient.Object, key []byte) string {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok || len(key) == 0 {
+		return ""
+	}
+
+	return hashData(secretData(secret), key)
+}
+
+// DiffParent returns the keys the parent secret adds and removes compared to the virtual secret
+// it shadows. The values of secrets are never compared, so no changed keys are returned.
+func (SecretKind) DiffParent(virtual, parent ctrlruntimeclient.Object) ObjectDiff {
+	vSecret, ok := virtual.(*corev1.Secret)
+	if !ok {
+		return ObjectDiff{}
+	}
+
+	pSecret, ok := parent.(*corev1.Secret)
+	if !ok {
+		return ObjectDiff{}
+	}
+
+	return diffData(secretData(vSecret), secretData(pSecret), false)
+}
+
+// secretData returns the data of the secret, string data takes precedence over data like it does
+// when the API server merges it.
+func secretData(secret *corev1.Secret) map[string][]byte {
+	data := make(map[string][]byte, len(secret.Data)+len(secret.StringData))
+
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+
+	for k, v := range secret.StringData {
+		data[k] = []byte(v)
+	}
+
+	return data
+}
@@ -0,0 +1,219 @@
+package mutator
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ServiceAccountsHookName is the name the settings of serviceaccount references, such as the
+	// enabled setting, are named by. There is no separate hook, the references are substituted by
+	// the hooks that handle every registered kind.
+	ServiceAccountsHookName = "prefer-parent-serviceaccounts-hook"
+
+	// SkipPreferServiceAccountsHook is the annotation key that, if any value is set, will cause
+	// this plugin to skip preferring the parent (physical/real) serviceaccount resources.
+	SkipPreferServiceAccountsHook = "skip-prefer-parent-serviceaccounts-hook"
+
+	// DryRunPreferServiceAccountsHook is the annotation key that, if set to "true" or "false",
+	// overrides the hooks dry run setting for the pod. In dry run mode the serviceaccount is
+	// resolved as usual but left unchanged, the substitution that would have been made is recorded
+	// on the pod.
+	DryRunPreferServiceAccountsHook = "dry-run-prefer-parent-serviceaccounts-hook"
+
+	// ReferenceSourceServiceAccountName is the ReferenceSource of the pods service account name.
+	ReferenceSourceServiceAccountName ReferenceSource = "serviceAccountName"
+)
+
+// ServiceAccountKind is the ReferenceableKind of serviceaccounts, referenced by the pods service
+// account name. Pods run with a serviceaccount from the parent namespace rather than the
+// serviceaccount translated from the vcluster, if the virtual pod requests a serviceaccount of the
+// same name and it is allowed. This lets vcluster pods use cloud workload identity (IRSA, GKE
+// workload identity, Azure workload identity) bound to serviceaccounts in the parent namespace.
+//
+// vcluster issues the projected service account tokens of pods itself, so once the serviceaccount
+// is substituted, tokens for the TokenAudiences -- those of the cloud identity providers -- are
+// projected from the parent cluster instead, meaning they are issued for the parent
+// serviceaccount.
+type ServiceAccountKind struct {
+	// Allowed are the names of the parent serviceaccounts that may be substituted.
+	Allowed []string
+	// TokenAudiences are the audiences of the projected service account tokens that are issued
+	// for the parent serviceaccount.
+	TokenAudiences []string
+}
+
+// Name returns the name of the kind.
+func (ServiceAccountKind) Name() string {
+	return "serviceaccount"
+}
+
+// HookName returns the name the settings of serviceaccount references are named by.
+func (ServiceAccountKind) HookName() string {
+	return ServiceAccountsHookName
+}
+
+// SkipAnnotation returns the serviceaccount skip annotation key.
+func (ServiceAccountKind) SkipAnnotation() string {
+	return SkipPreferServiceAccountsHook
+}
+
+// DryRunAnnotation returns the serviceaccount dry run annotation key.
+func (ServiceAccountKind) DryRunAnnotation() string {
+	return DryRunPreferServiceAccountsHook
+}
+
+// GroupVersionKind returns the GroupVersionKind of serviceaccounts.
+func (ServiceAccountKind) GroupVersionKind() schema.GroupVersionKind {
+	return corev1.SchemeGroupVersion.WithKind("ServiceAccount")
+}
+
+// FindReferences returns the reference to the pods service account, if it has one.
+func (ServiceAccountKind) FindReferences(podSpec *corev1.PodSpec) []Reference {
+	if podSpec.ServiceAccountName == "" {
+		return nil
+	}
+
+	return []Reference{{Source: ReferenceSourceServiceAccountName}}
+}
+
+// GetName returns the name of the pods service account.
+func (ServiceAccountKind) GetName(podSpec *corev1.PodSpec, ref *Reference) string {
+	if ref.Source != ReferenceSourceServiceAccountName {
+		return ""
+	}
+
+	return podSpec.ServiceAccountName
+}
+
+// SetName sets the pods service account to the serviceaccount name.
+func (ServiceAccountKind) SetName(podSpec *corev1.PodSpec, ref *Reference, name string) {
+	if ref.Source != ReferenceSourceServiceAccountName {
+		return
+	}
+
+	podSpec.ServiceAccountName = name
+
+	if podSpec.DeprecatedServiceAccount != "" {
+		podSpec.DeprecatedServiceAccount = name
+	}
+}
+
+// GetParent fetches the serviceaccount with the given key.
+func (ServiceAccountKind) GetParent(
+	ctx context.Context,
+	reader ctrlruntimeclient.Reader,
+	key types.NamespacedName,
+) (ctrlruntimeclient.Object, error) {
+	obj := &corev1.ServiceAccount{}
+
+	err := reader.Get(ctx, key, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// ValidateParent returns an error if the serviceaccount obj is not in the allow list.
+func (k ServiceAccountKind) ValidateParent(obj ctrlruntimeclient.Object) error {
+	for _, allowed := range k.Allowed {
+		if obj.GetName() == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf(
+		"%w: serviceaccount '%s' is not in the allow list",
+		ErrParentNotEligible,
+		obj.GetName(),
+	)
+}
+
+// postApply is called by Mutate after the references in applied have been substituted on the pod
+// being mutated. If the serviceaccount was substituted, the tokens for its TokenAudiences are
+// projected from the parent cluster.
+func (m *referenceMutator) postApply(
+	ctx context.Context,
+	pm *podMutation,
+	applied []*reference,
+) error {
+	for _, ref := range applied {
+		kind, ok := ref.kind.(ServiceAccountKind)
+		if !ok {
+			continue
+		}
+
+		return m.projectServiceAccountTokens(ctx, pm, kind.TokenAudiences)
+	}
+
+	return nil
+}
+
+// projectServiceAccountTokens restores the projected service account token sources of the virtual
+// pod whose audience is one of audiences on the pod being mutated. vcluster replaces projected
+// service account tokens with tokens it issues itself, after substituting the serviceaccount the
+// tokens for the given audiences are issued by the parent cluster for the parent serviceaccount.
+func (m *referenceMutator) projectServiceAccountTokens(
+	ctx context.Context,
+	pm *podMutation,
+	audiences []string,
+) error {
+	if len(audiences) == 0 {
+		return nil
+	}
+
+	vPod, err := m.virtualPod(ctx, pm)
+	if err != nil || vPod == nil {
+		return err
+	}
+
+	pVolumes := map[string]*corev1.Volume{}
+
+	for i := range pm.pod.Spec.Volumes {
+		pVolumes[pm.pod.Spec.Volumes[i].Name] = &pm.pod.Spec.Volumes[i]
+	}
+
+	for _, vVol := range vPod.Spec.Volumes {
+		pVol, ok := pVolumes[vVol.Name]
+		if !ok || vVol.Projected == nil || pVol.Projected == nil ||
+			len(vVol.Projected.Sources) != len(pVol.Projected.Sources) {
+			continue
+		}
+
+		for i, vSource := range vVol.Projected.Sources {
+			if vSource.ServiceAccountToken == nil ||
+				!containsString(audiences, vSource.ServiceAccountToken.Audience) {
+				continue
+			}
+
+			m.log.Infof(
+				"projecting pod '%s/%s' volume '%s' token for audience '%s' from serviceaccount '%s'",
+				pm.pod.Namespace,
+				pm.pod.Name,
+				pVol.Name,
+				vSource.ServiceAccountToken.Audience,
+				pm.pod.Spec.ServiceAccountName,
+			)
+
+			pVol.Projected.Sources[i] = *vSource.DeepCopy()
+		}
+	}
+
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
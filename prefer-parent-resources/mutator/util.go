@@ -0,0 +1,183 @@
+package mutator
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// MutateAnnotations ensures that the provided hook name is set for the 'mutated-by-hook'
+// annotation of the object obj. The hook name is only added if it is not already listed, so that
+// mutating an object on every update does not grow the annotation.
+func MutateAnnotations(obj ctrlruntimeclient.Object, hookName string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+
+	existing, ok := annotations["vcluster.loft.sh/mutated-by-hook"]
+	if !ok {
+		annotations["vcluster.loft.sh/mutated-by-hook"] = hookName
+	} else {
+		for _, name := range strings.Split(existing, ",") {
+			if name == hookName {
+				return
+			}
+		}
+
+		annotations["vcluster.loft.sh/mutated-by-hook"] = existing + "," + hookName
+	}
+
+	obj.SetAnnotations(annotations)
+}
+
+// EnvAtPos is a simple object representing a corev1.EnvVar and its position in the container
+// list, and position in the env list of that container.
+type EnvAtPos struct {
+	// ContainerPos is the index of the container in the containers of the pod spec.
+	ContainerPos int
+	// Env is the environment variable referencing the object.
+	Env corev1.EnvVar
+}
+
+// FindMountedEnvsOfType finds all objects of the registered kind named t (for example
+// "configmap" or "secret") that are mounted as environment variables in the given pod.
+func FindMountedEnvsOfType(podSpec *corev1.PodSpec, t string) []EnvAtPos {
+	kind, ok := GetKind(t)
+	if !ok {
+		return nil
+	}
+
+	var envsOfType []EnvAtPos
+
+	for _, ref := range kind.FindReferences(podSpec) {
+		if ref.Source != ReferenceSourceEnv || ref.ContainerType != ContainerTypeContainer {
+			continue
+		}
+
+		envsOfType = append(
+			envsOfType,
+			EnvAtPos{
+				ContainerPos: ref.ContainerIndex,
+				Env:          podSpec.Containers[ref.ContainerIndex].Env[ref.EnvIndex],
+			},
+		)
+	}
+
+	return envsOfType
+}
+
+// VolAtPos is a simple object representing the volume and its position in the volumes slice.
+type VolAtPos struct {
+	// Pos is the index of the volume in the volumes of the pod spec.
+	Pos int
+	// Vol is the source of the volume referencing the object.
+	Vol corev1.VolumeSource
+}
+
+// FindMountedVolumesOfType finds all objects of the registered kind named t (for example
+// "configmap" or "secret") that are mounted as volumes in the given pod.
+func FindMountedVolumesOfType(podSpec *corev1.PodSpec, t string) []VolAtPos {
+	kind, ok := GetKind(t)
+	if !ok {
+		return nil
+	}
+
+	var volumesOfType []VolAtPos
+
+	for _, ref := range kind.FindReferences(podSpec) {
+		if ref.Source != ReferenceSourceVolume {
+			continue
+		}
+
+		volumesOfType = append(
+			volumesOfType,
+			VolAtPos{
+				Pos: ref.VolumeIndex,
+				Vol: podSpec.Volumes[ref.VolumeIndex].VolumeSource,
+			},
+		)
+	}
+
+	return volumesOfType
+}
+
+// GetVirtualPod returns the pod in the virtualReader matching the provided pod. If the virtual pod
+// cannot be fetched a *LookupError is returned.
+func GetVirtualPod(
+	ctx context.Context,
+	pod *corev1.Pod,
+	virtualReader ctrlruntimeclient.Reader,
+) (*corev1.Pod, error) {
+	// get the "real" name of the pod (as in "real" in the vcluster)
+	vName := pod.Annotations[VirtualNameAnnotation]
+	vNamespace := pod.Annotations[VirtualNamespaceAnnotation]
+
+	vPod := &corev1.Pod{}
+
+	err := virtualReader.Get(
+		ctx,
+		types.NamespacedName{Name: vName, Namespace: vNamespace},
+		vPod,
+	)
+	if err != nil {
+		return nil, &LookupError{
+			Cluster:   LookupClusterVirtual,
+			Kind:      "pod",
+			Namespace: vNamespace,
+			Name:      vName,
+			Policy:    FailurePolicyFailOpen,
+			Err:       err,
+		}
+	}
+
+	return vPod, nil
+}
+
+// SplitList returns the comma separated values of s, surrounding whitespace and empty values are
+// dropped.
+func SplitList(s string) []string {
+	var values []string
+
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		values = append(values, v)
+	}
+
+	return values
+}
+
+// physicalSelector returns the selector selecting the physical objects of the virtual objects the
+// selector selects, its keys translated with labelKey. If labelKey is nil the selector is
+// returned as is.
+func physicalSelector(
+	selector labels.Selector,
+	labelKey PhysicalLabelKeyFunc,
+) (labels.Selector, error) {
+	if labelKey == nil {
+		return selector, nil
+	}
+
+	requirements, _ := selector.Requirements()
+
+	translated := labels.NewSelector()
+
+	for _, r := range requirements {
+		requirement, err := labels.NewRequirement(labelKey(r.Key()), r.Operator(), r.Values().List())
+		if err != nil {
+			return nil, err
+		}
+
+		translated = translated.Add(*requirement)
+	}
+
+	return translated, nil
+}
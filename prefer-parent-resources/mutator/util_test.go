@@ -0,0 +1,162 @@
+package mutator_test
+
+import (
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testMutateAnnotations(testName string, testCase *comparePodTestCase) func(t *testing.T) {
+	return func(t *testing.T) {
+		t.Logf("%s: starting", testName)
+
+		mutator.MutateAnnotations(testCase.inPod, "prefer-parent-configmaps-hook")
+
+		if !cmp.Equal(testCase.inPod, testCase.expected) {
+			t.Fatalf(
+				"%s: actual and expected inputs do not match\nactual: %s\nexpected:%s",
+				testName,
+				testCase.inPod,
+				testCase.expected,
+			)
+		}
+	}
+}
+
+func TestMutateAnnotations(t *testing.T) {
+	cases := map[string]*comparePodTestCase{
+		"no-existing-annotations": {
+			inPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: nil,
+				},
+			},
+			expected: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"vcluster.loft.sh/mutated-by-hook": "prefer-parent-configmaps-hook",
+					},
+				},
+			},
+		},
+		"existing-annotations": {
+			inPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"someannotation": "somevalue",
+					},
+				},
+			},
+			expected: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"someannotation":                   "somevalue",
+						"vcluster.loft.sh/mutated-by-hook": "prefer-parent-configmaps-hook",
+					},
+				},
+			},
+		},
+		"other-hook": {
+			inPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"vcluster.loft.sh/mutated-by-hook": "some-other-hook",
+					},
+				},
+			},
+			expected: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"vcluster.loft.sh/mutated-by-hook": "some-other-hook," +
+							"prefer-parent-configmaps-hook",
+					},
+				},
+			},
+		},
+		"already-mutated": {
+			inPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"vcluster.loft.sh/mutated-by-hook": "prefer-parent-configmaps-hook," +
+							"some-other-hook",
+					},
+				},
+			},
+			expected: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						"vcluster.loft.sh/mutated-by-hook": "prefer-parent-configmaps-hook," +
+							"some-other-hook",
+					},
+				},
+			},
+		},
+	}
+
+	for testName, testCase := range cases {
+		f := testMutateAnnotations(testName, testCase)
+		t.Run(testName, f)
+	}
+}
+
+func TestFindMountedOfType(t *testing.T) {
+	podSpec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "first"},
+			{
+				Name: "second",
+				Env: []corev1.EnvVar{
+					{Name: "PLAIN", Value: "value"},
+					{
+						Name: "FROM_CONFIGMAP",
+						ValueFrom: &corev1.EnvVarSource{
+							ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{
+									Name: "someconfigmap",
+								},
+								Key: "somekey",
+							},
+						},
+					},
+				},
+			},
+		},
+		Volumes: []corev1.Volume{
+			{Name: "empty", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			{
+				Name: "configmap",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "someconfigmap"},
+					},
+				},
+			},
+		},
+	}
+
+	t.Logf("%s: starting", "find-mounted-of-type")
+
+	envs := mutator.FindMountedEnvsOfType(podSpec, "configmap")
+	expectedEnvs := []mutator.EnvAtPos{
+		{ContainerPos: 1, Env: podSpec.Containers[1].Env[1]},
+	}
+
+	if !cmp.Equal(envs, expectedEnvs) {
+		t.Fatalf("actual and expected envs do not match\n%s", cmp.Diff(envs, expectedEnvs))
+	}
+
+	vols := mutator.FindMountedVolumesOfType(podSpec, "configmap")
+	expectedVols := []mutator.VolAtPos{{Pos: 1, Vol: podSpec.Volumes[1].VolumeSource}}
+
+	if !cmp.Equal(vols, expectedVols) {
+		t.Fatalf("actual and expected volumes do not match\n%s", cmp.Diff(vols, expectedVols))
+	}
+
+	if envs := mutator.FindMountedEnvsOfType(podSpec, "unregistered"); envs != nil {
+		t.Fatalf("expected no envs of an unregistered kind, got %v", envs)
+	}
+}
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultBindAddress is the address the webhook listens on (with tls) when the configuration
+	// does not set one.
+	DefaultBindAddress = ":9443"
+	// DefaultHealthBindAddress is the address the health and metrics endpoints are served on when
+	// the configuration does not set one.
+	DefaultHealthBindAddress = ":8081"
+)
+
+// Config is the configuration of the webhook. The settings mirror the settings the plugin hooks
+// read from their environment variables.
+type Config struct {
+	// BindAddress is the address the webhook listens on, defaults to DefaultBindAddress.
+	BindAddress string `json:"bindAddress,omitempty"`
+	// HealthBindAddress is the address the health endpoints and metrics are served on (without
+	// tls), defaults to DefaultHealthBindAddress.
+	HealthBindAddress string `json:"healthBindAddress,omitempty"`
+	// CertFile and KeyFile are the paths of the tls certificate and key of the webhook, they are
+	// reloaded when they change.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// VClusterName is the name of the vcluster of pods that do not carry the vcluster managed-by
+	// label. If unset such pods are not mutated.
+	VClusterName string `json:"vclusterName,omitempty"`
+	// Kinds are the names of the registered kinds whose references are substituted, for example
+	// "configmap" and "secret". Defaults to every registered kind.
+	Kinds []string `json:"kinds,omitempty"`
+	// DryRun resolves references as usual but leaves them unchanged, recording the substitutions
+	// that would have been made on the pod instead.
+	DryRun bool `json:"dryRun,omitempty"`
+	// FailurePolicy determines how lookup errors are handled, defaults to "fail-open".
+	FailurePolicy mutator.FailurePolicy `json:"failurePolicy,omitempty"`
+	// RequireGrants only substitutes parent objects a ParentResourceGrant allows.
+	RequireGrants bool `json:"requireGrants,omitempty"`
+	// Enforced ignores skip annotations and rejects pods whose references cannot be substituted.
+	Enforced bool `json:"enforced,omitempty"`
+	// EnforcedNames and EnforcedKinds limit Enforced to the references to parent objects of the
+	// given names, and to the references of the named kinds, if either is set.
+	EnforcedNames []string `json:"enforcedNames,omitempty"`
+	EnforcedKinds []string `json:"enforcedKinds,omitempty"`
+	// ReservedNames and ReservedSecretTypes are the names of parent objects and the types of
+	// parent secrets that are never substituted, in addition to the built-in reserved ones.
+	ReservedNames       []string            `json:"reservedNames,omitempty"`
+	ReservedSecretTypes []corev1.SecretType `json:"reservedSecretTypes,omitempty"`
+}
+
+// LoadConfig reads and validates the webhook configuration (YAML or JSON) from the file at path.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	return ParseConfig(b)
+}
+
+// ParseConfig parses and validates the webhook configuration (YAML or JSON) b, unset addresses
+// and the failure policy are defaulted.
+func ParseConfig(b []byte) (*Config, error) {
+	config := &Config{}
+
+	err := yaml.UnmarshalStrict(b, config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	if config.BindAddress == "" {
+		config.BindAddress = DefaultBindAddress
+	}
+
+	if config.HealthBindAddress == "" {
+		config.HealthBindAddress = DefaultHealthBindAddress
+	}
+
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("%w: certFile and keyFile are required", ErrInvalidConfig)
+	}
+
+	config.FailurePolicy, err = mutator.ParseFailurePolicy(string(config.FailurePolicy))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, err)
+	}
+
+	_, err = config.kinds()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// kinds returns the registered kinds named by the configuration, or every registered kind if the
+// configuration names none.
+func (c *Config) kinds() ([]mutator.ReferenceableKind, error) {
+	if len(c.Kinds) == 0 {
+		return mutator.RegisteredKinds(), nil
+	}
+
+	kinds := make([]mutator.ReferenceableKind, 0, len(c.Kinds))
+
+	for _, name := range c.Kinds {
+		kind, ok := mutator.GetKind(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown kind '%s'", ErrInvalidConfig, name)
+		}
+
+		kinds = append(kinds, kind)
+	}
+
+	return kinds, nil
+}
@@ -0,0 +1,104 @@
+package webhook_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/webhook"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseConfig(t *testing.T) {
+	cases := map[string]struct {
+		description string
+		config      string
+		expected    *webhook.Config
+		expectedErr error
+	}{
+		"defaults": {
+			description: "validate that unset addresses and the failure policy are defaulted",
+			config:      "certFile: tls.crt\nkeyFile: tls.key\n",
+			expected: &webhook.Config{
+				BindAddress:       webhook.DefaultBindAddress,
+				HealthBindAddress: webhook.DefaultHealthBindAddress,
+				CertFile:          "tls.crt",
+				KeyFile:           "tls.key",
+				FailurePolicy:     mutator.FailurePolicyFailOpen,
+			},
+		},
+		"settings": {
+			description: "validate that the mutation settings are parsed",
+			config: `bindAddress: ":8443"
+certFile: tls.crt
+keyFile: tls.key
+vclusterName: my-vcluster
+kinds: [secret]
+dryRun: true
+failurePolicy: fail-closed
+reservedSecretTypes: [kubernetes.io/tls]
+`,
+			expected: &webhook.Config{
+				BindAddress:         ":8443",
+				HealthBindAddress:   webhook.DefaultHealthBindAddress,
+				CertFile:            "tls.crt",
+				KeyFile:             "tls.key",
+				VClusterName:        "my-vcluster",
+				Kinds:               []string{"secret"},
+				DryRun:              true,
+				FailurePolicy:       mutator.FailurePolicyFailClosed,
+				ReservedSecretTypes: []corev1.SecretType{"kubernetes.io/tls"},
+			},
+		},
+		"missing-tls": {
+			description: "validate that the tls certificate and key are required",
+			config:      "certFile: tls.crt\n",
+			expectedErr: webhook.ErrInvalidConfig,
+		},
+		"unknown-kind": {
+			description: "validate that unknown kinds are rejected",
+			config:      "certFile: tls.crt\nkeyFile: tls.key\nkinds: [unknown]\n",
+			expectedErr: webhook.ErrInvalidConfig,
+		},
+		"unknown-failure-policy": {
+			description: "validate that unknown failure policies are rejected",
+			config:      "certFile: tls.crt\nkeyFile: tls.key\nfailurePolicy: unknown\n",
+			expectedErr: webhook.ErrInvalidConfig,
+		},
+		"unknown-field": {
+			description: "validate that unknown fields are rejected",
+			config:      "certFile: tls.crt\nkeyFile: tls.key\nunknown: true\n",
+			expectedErr: webhook.ErrInvalidConfig,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			actual, err := webhook.ParseConfig([]byte(testCase.config))
+			if testCase.expectedErr != nil {
+				if !errors.Is(err, testCase.expectedErr) {
+					t.Fatalf("%s: expected error '%s', got '%v'", testName, testCase.expectedErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cmp.Equal(actual, testCase.expected) {
+				t.Fatalf(
+					"%s: actual and expected configs do not match\nactual: %v\nexpected:%v",
+					testName,
+					actual,
+					testCase.expected,
+				)
+			}
+		})
+	}
+}
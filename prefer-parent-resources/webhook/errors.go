@@ -0,0 +1,6 @@
+package webhook
+
+import "errors"
+
+// ErrInvalidConfig is an error returned when loading an invalid webhook configuration.
+var ErrInvalidConfig = errors.New("errInvalidConfig")
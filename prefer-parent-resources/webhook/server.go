@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+)
+
+const (
+	// HealthzPath is the http path of the liveness endpoint.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the http path of the readiness endpoint, it reports ready once the webhook is
+	// listening.
+	ReadyzPath = "/readyz"
+	// MetricsPath is the http path the metrics are served on.
+	MetricsPath = "/metrics"
+
+	readHeaderTimeout = 5 * time.Second
+	shutdownTimeout   = 5 * time.Second
+)
+
+// HealthHandler returns an http.Handler serving the liveness and readiness endpoints and the
+// metrics. The readiness endpoint fails until ready returns true.
+func HealthHandler(ready func() bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(HealthzPath, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc(ReadyzPath, func(w http.ResponseWriter, _ *http.Request) {
+		if !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	mux.Handle(MetricsPath, mutator.MetricsHandler())
+
+	return mux
+}
+
+// Serve serves handler with tls on the BindAddress of config, and the HealthHandler on the
+// HealthBindAddress of config, until the provided context is cancelled or either server fails.
+// The tls certificate is reloaded when the CertFile or KeyFile of config change.
+func Serve(ctx context.Context, config *Config, handler http.Handler) error {
+	watcher, err := certwatcher.New(config.CertFile, config.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+
+	listener, err := net.Listen("tcp", config.BindAddress)
+	if err != nil {
+		return err
+	}
+
+	var ready atomic.Bool
+
+	servers := []*http.Server{
+		{
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+			TLSConfig: &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: watcher.GetCertificate,
+			},
+		},
+		{
+			Addr:              config.HealthBindAddress,
+			Handler:           HealthHandler(ready.Load),
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+	}
+
+	errs := make(chan error, len(servers))
+
+	go func() {
+		errs <- servers[0].ServeTLS(listener, "", "")
+	}()
+
+	go func() {
+		errs <- servers[1].ListenAndServe()
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(
+			context.Background(),
+			shutdownTimeout,
+		)
+		defer shutdownCancel()
+
+		for _, server := range servers {
+			_ = server.Shutdown(shutdownCtx)
+		}
+	}()
+
+	ready.Store(true)
+
+	var serveErr error
+
+	for range servers {
+		err = <-errs
+		if err != nil && !errors.Is(err, http.ErrServerClosed) && serveErr == nil {
+			serveErr = err
+		}
+
+		// once either server stops, stop the other
+		cancel()
+	}
+
+	return serveErr
+}
@@ -0,0 +1,78 @@
+package webhook_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/webhook"
+)
+
+func TestHealthHandler(t *testing.T) {
+	cases := map[string]struct {
+		description  string
+		ready        bool
+		path         string
+		expectedCode int
+	}{
+		"healthz": {
+			description:  "validate that the liveness endpoint is always healthy",
+			path:         webhook.HealthzPath,
+			expectedCode: http.StatusOK,
+		},
+		"readyz-not-ready": {
+			description:  "validate that the readiness endpoint fails until the webhook is ready",
+			path:         webhook.ReadyzPath,
+			expectedCode: http.StatusServiceUnavailable,
+		},
+		"readyz-ready": {
+			description:  "validate that the readiness endpoint succeeds once the webhook is ready",
+			ready:        true,
+			path:         webhook.ReadyzPath,
+			expectedCode: http.StatusOK,
+		},
+		"metrics": {
+			description:  "validate that the metrics are served",
+			path:         webhook.MetricsPath,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			server := httptest.NewServer(
+				webhook.HealthHandler(func() bool { return testCase.ready }),
+			)
+			defer server.Close()
+
+			req, err := http.NewRequestWithContext(
+				context.Background(),
+				http.MethodGet,
+				server.URL+testCase.path,
+				http.NoBody,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_ = resp.Body.Close()
+
+			if resp.StatusCode != testCase.expectedCode {
+				t.Fatalf(
+					"%s: actual and expected status codes do not match\nactual: %d\nexpected:%d",
+					testName,
+					resp.StatusCode,
+					testCase.expectedCode,
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package webhook serves the prefer parent resources mutation as a mutating admission webhook on
+// the host cluster, for vclusters that do not run the plugin. Pods synced by a vcluster are
+// recognized by the vcluster translator annotations, their references are substituted with the
+// objects of the same name in the namespace of the pod -- the host namespace of the vcluster.
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/hooks"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+
+	vclustersdktranslate "github.com/loft-sh/vcluster-sdk/translate"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	ctrlruntimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlruntimelog "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// Name is the name of the webhook, it is the mutator name recorded in the mutated by
+	// annotation, the dry run annotation and the metrics of mutated pods.
+	Name = "prefer-parent-resources-webhook"
+
+	// MutatePath is the http path the webhook serves pod admission reviews on.
+	MutatePath = "/mutate-pods"
+)
+
+// Webhook is an admission.Handler that substitutes the references of pods synced by a vcluster
+// with the objects of the same name in the host namespace of the vcluster.
+//
+// The webhook trusts the translator annotations and the vcluster managed-by label of the pod, which
+// are set by whoever creates the pod in the host namespace, not only by vcluster. This is safe as
+// parents are only ever looked up in the namespace of the pod itself, so a pod author faking the
+// annotations can only substitute objects the pod could have referenced directly; the webhook
+// configuration should nevertheless select only the host namespaces of vclusters. The webhook has
+// no access to the virtual cluster, so references whose names cannot be reverse translated -- names
+// vcluster shortened by hashing -- are left unchanged rather than resolved from the virtual pod.
+type Webhook struct {
+	config               *Config
+	log                  mutator.Logger
+	kinds                []mutator.ReferenceableKind
+	parentMetadataReader ctrlruntimeclient.Reader
+	parentReader         ctrlruntimeclient.Reader
+	grantCache           *mutator.GrantCache
+}
+
+// New returns a Webhook for the configuration config. Parent objects are read with the given
+// readers, see mutator.Options for how they are used. If log is nil nothing is logged.
+func New(
+	config *Config,
+	parentMetadataReader ctrlruntimeclient.Reader,
+	parentReader ctrlruntimeclient.Reader,
+	log mutator.Logger,
+) (*Webhook, error) {
+	kinds, err := config.kinds()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook{
+		config:               config,
+		log:                  log,
+		kinds:                kinds,
+		parentMetadataReader: parentMetadataReader,
+		parentReader:         parentReader,
+		grantCache:           mutator.NewGrantCache(),
+	}, nil
+}
+
+// Handler returns an http.Handler serving the webhook admission reviews at MutatePath.
+func (w *Webhook) Handler() http.Handler {
+	wh := &admission.Webhook{Handler: w}
+
+	_ = wh.InjectLogger(ctrlruntimelog.Log.WithName(Name))
+
+	mux := http.NewServeMux()
+	mux.Handle(MutatePath, wh)
+
+	return mux
+}
+
+// Handle mutates the pod of the admission request req. Requests for anything but the creation of
+// a pod synced by a vcluster are allowed unchanged. The request is denied if enforced references
+// of the pod cannot be substituted, and fails if a lookup failed and the failure policy rejects
+// the pod.
+func (w *Webhook) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Kind.Kind != "Pod" || req.Operation != admissionv1.Create {
+		return admission.Allowed("not a pod creation")
+	}
+
+	pod := &corev1.Pod{}
+
+	err := json.Unmarshal(req.Object.Raw, pod)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	vClusterName, ok := w.vClusterName(pod)
+	if !ok {
+		return admission.Allowed("not a vcluster pod")
+	}
+
+	if pod.Namespace == "" {
+		pod.Namespace = req.Namespace
+	}
+
+	_, err = w.newMutator(pod.Namespace, vClusterName).Mutate(ctx, pod)
+	if err != nil {
+		if errors.Is(err, mutator.ErrParentRequired) {
+			return admission.Denied(err.Error())
+		}
+
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	b, err := json.Marshal(pod)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, b)
+}
+
+// vClusterName returns the name of the vcluster that synced the pod, and false if the pod was not
+// synced by a vcluster. Synced pods carry the translator annotations, the vcluster name is the
+// value of the vcluster managed-by label, or the configured VClusterName if the label is unset.
+func (w *Webhook) vClusterName(pod *corev1.Pod) (string, bool) {
+	if pod.Annotations[mutator.VirtualNameAnnotation] == "" ||
+		pod.Annotations[mutator.VirtualNamespaceAnnotation] == "" {
+		return "", false
+	}
+
+	name := pod.Labels[vclustersdktranslate.MarkerLabel]
+	if name == "" {
+		name = w.config.VClusterName
+	}
+
+	return name, name != ""
+}
+
+// newMutator returns the pod mutator for the pods of the vcluster vClusterName in the host
+// namespace.
+func (w *Webhook) newMutator(namespace, vClusterName string) mutator.Mutator {
+	return mutator.NewPodMutator(
+		&mutator.Options{
+			Name:                 Name,
+			Logger:               w.log,
+			ParentNamespace:      namespace,
+			ParentMetadataReader: w.parentMetadataReader,
+			ParentReader:         w.parentReader,
+			PhysicalName:         hooks.PhysicalNameFor(vClusterName),
+			PhysicalLabelKey:     hooks.PhysicalLabelKeyFor(vClusterName),
+			GrantCache:           w.grantCache,
+			DryRun:               w.config.DryRun,
+			FailurePolicy:        w.config.FailurePolicy,
+			RequireGrants:        w.config.RequireGrants,
+			Enforced:             w.config.Enforced,
+			EnforcedNames:        w.config.EnforcedNames,
+			EnforcedKinds:        w.config.EnforcedKinds,
+			ReservedNames:        w.config.ReservedNames,
+			ReservedSecretTypes:  w.config.ReservedSecretTypes,
+		},
+		w.kinds...,
+	)
+}
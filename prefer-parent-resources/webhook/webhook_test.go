@@ -0,0 +1,320 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/mutator"
+	"github.com/carlmontanari/vcluster-plugin-prefer-parent-resources/prefer-parent-resources/webhook"
+
+	"github.com/google/go-cmp/cmp"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrlruntimeclientfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	configMapNamePath = "/spec/containers/0/env/0/valueFrom/configMapKeyRef/name"
+	secretNamePath    = "/spec/volumes/0/secret/secretName"
+	mutatedByPath     = "/metadata/annotations/vcluster.loft.sh~1mutated-by-hook"
+)
+
+func newTestPod(labels, annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "somepod-x-default-x-vcluster",
+			Namespace:   "host",
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "somecontainer",
+					Env: []corev1.EnvVar{
+						{
+							Name: "someenv",
+							ValueFrom: &corev1.EnvVarSource{
+								ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{
+										Name: "someconfigmap-x-default-x-vcluster",
+									},
+									Key: "somekey",
+								},
+							},
+						},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "somevolume",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: "somesecret-x-default-x-vcluster",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// withReferenceNames sets the names of the configmap and the secret referenced by pod.
+func withReferenceNames(pod *corev1.Pod, configMapName, secretName string) *corev1.Pod {
+	pod.Spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name = configMapName
+	pod.Spec.Volumes[0].Secret.SecretName = secretName
+
+	return pod
+}
+
+func newTestConfigMap(annotations map[string]string, key string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "someconfigmap",
+			Namespace:   "host",
+			Annotations: annotations,
+		},
+		Data: map[string]string{key: "somevalue"},
+	}
+}
+
+// review posts an admission review of the creation of pod to the webhook server and returns the
+// admission response.
+func review(t *testing.T, url string, pod *corev1.Pod) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(&admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "someuid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Operation: admissionv1.Create,
+			Namespace: "host",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		context.Background(),
+		http.MethodPost,
+		url+webhook.MutatePath,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	reviewResp := &admissionv1.AdmissionReview{}
+
+	err = json.NewDecoder(resp.Body).Decode(reviewResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reviewResp.Response == nil || reviewResp.Response.UID != "someuid" {
+		t.Fatalf("unexpected admission review response %v", reviewResp.Response)
+	}
+
+	return reviewResp.Response
+}
+
+// patchValues returns the values of the json patch operations of resp by path.
+func patchValues(t *testing.T, resp *admissionv1.AdmissionResponse) map[string]interface{} {
+	t.Helper()
+
+	values := map[string]interface{}{}
+
+	if len(resp.Patch) == 0 {
+		return values
+	}
+
+	var patch []struct {
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+
+	err := json.Unmarshal(resp.Patch, &patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range patch {
+		values[op.Path] = op.Value
+	}
+
+	return values
+}
+
+func TestWebhook(t *testing.T) {
+	vClusterAnnotations := map[string]string{
+		mutator.VirtualNameAnnotation:      "somepod",
+		mutator.VirtualNamespaceAnnotation: "default",
+	}
+	vClusterLabels := map[string]string{"vcluster.loft.sh/managed-by": "vcluster"}
+
+	cases := map[string]struct {
+		description     string
+		config          *webhook.Config
+		pod             *corev1.Pod
+		pClientObjs     []runtime.Object
+		expectedAllowed bool
+		expectedPatches map[string]interface{}
+	}{
+		"substituted": {
+			description: "validate that the references of vcluster pods are substituted",
+			config:      &webhook.Config{},
+			pod:         newTestPod(vClusterLabels, vClusterAnnotations),
+			pClientObjs: []runtime.Object{
+				newTestConfigMap(nil, "somekey"),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				},
+			},
+			expectedAllowed: true,
+			expectedPatches: map[string]interface{}{
+				configMapNamePath: "someconfigmap",
+				secretNamePath:    "somesecret",
+				mutatedByPath:     webhook.Name,
+			},
+		},
+		"configured-vcluster-name": {
+			description:     "validate that unlabelled pods use the configured vcluster name",
+			config:          &webhook.Config{VClusterName: "vcluster"},
+			pod:             newTestPod(nil, vClusterAnnotations),
+			pClientObjs:     []runtime.Object{newTestConfigMap(nil, "somekey")},
+			expectedAllowed: true,
+			expectedPatches: map[string]interface{}{
+				configMapNamePath: "someconfigmap",
+				mutatedByPath:     webhook.Name,
+			},
+		},
+		"not-found": {
+			description:     "validate that references without parent objects are left unchanged",
+			config:          &webhook.Config{},
+			pod:             newTestPod(vClusterLabels, vClusterAnnotations),
+			expectedAllowed: true,
+			expectedPatches: map[string]interface{}{
+				mutatedByPath: webhook.Name,
+			},
+		},
+		"unresolvable-names": {
+			description: "validate that references whose names cannot be reverse translated, " +
+				"as the webhook has no virtual pod to fall back to, are left unchanged",
+			config: &webhook.Config{},
+			pod: withReferenceNames(
+				newTestPod(vClusterLabels, vClusterAnnotations),
+				"someconfigmap-x-default-x-vcluster-3f2a9c1b7e",
+				"somesecret-with-a-long-name-8d4b2e6f1a",
+			),
+			pClientObjs: []runtime.Object{
+				newTestConfigMap(nil, "somekey"),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "somesecret", Namespace: "host"},
+				},
+			},
+			expectedAllowed: true,
+			expectedPatches: map[string]interface{}{
+				mutatedByPath: webhook.Name,
+			},
+		},
+		"not-vcluster-pod": {
+			description:     "validate that pods not synced by a vcluster are not mutated",
+			config:          &webhook.Config{},
+			pod:             newTestPod(vClusterLabels, nil),
+			pClientObjs:     []runtime.Object{newTestConfigMap(nil, "somekey")},
+			expectedAllowed: true,
+			expectedPatches: map[string]interface{}{},
+		},
+		"denied": {
+			description: "validate that pods whose enforced references cannot be substituted " +
+				"are denied",
+			config: &webhook.Config{},
+			pod:    newTestPod(vClusterLabels, vClusterAnnotations),
+			pClientObjs: []runtime.Object{
+				newTestConfigMap(
+					map[string]string{
+						mutator.EnforcedAnnotation:          "true",
+						mutator.AllowedNamespacesAnnotation: "someothernamespace",
+					},
+					"somekey",
+				),
+			},
+			expectedAllowed: false,
+			expectedPatches: map[string]interface{}{},
+		},
+	}
+
+	for testName, testCase := range cases {
+		t.Run(testName, func(t *testing.T) {
+			t.Logf("%s: starting", testName)
+
+			scheme := runtime.NewScheme()
+
+			err := clientgoscheme.AddToScheme(scheme)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pClient := ctrlruntimeclientfake.NewClientBuilder().
+				WithScheme(scheme).
+				WithRuntimeObjects(testCase.pClientObjs...).
+				Build()
+
+			wh, err := webhook.New(testCase.config, pClient, pClient, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := httptest.NewServer(wh.Handler())
+			defer server.Close()
+
+			resp := review(t, server.URL, testCase.pod)
+
+			if resp.Allowed != testCase.expectedAllowed {
+				t.Fatalf(
+					"%s: actual and expected allowed do not match\nactual: %t\nexpected:%t",
+					testName,
+					resp.Allowed,
+					testCase.expectedAllowed,
+				)
+			}
+
+			actualPatches := patchValues(t, resp)
+
+			if !cmp.Equal(actualPatches, testCase.expectedPatches) {
+				t.Fatalf(
+					"%s: actual and expected patches do not match\nactual: %v\nexpected:%v",
+					testName,
+					actualPatches,
+					testCase.expectedPatches,
+				)
+			}
+		})
+	}
+}